@@ -2,4 +2,7 @@ module atlas
 
 go 1.25
 
-require github.com/mattn/go-sqlite3 v1.14.17
+require (
+	github.com/mattn/go-sqlite3 v1.14.17
+	gopkg.in/yaml.v3 v3.0.1
+)
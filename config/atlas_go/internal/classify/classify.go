@@ -0,0 +1,361 @@
+// Package classify guesses what kind of device a host is from the evidence the scans collect:
+// MAC vendor, open ports and services, nmap OS classes, hostname, mDNS/SSDP announcements and
+// Docker images. Classification is rule based; every matching rule adds its weight to its device
+// type and the type with the highest score wins.
+package classify
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Device types.
+const (
+	Router      = "router"
+	Switch      = "switch"
+	Printer     = "printer"
+	NAS         = "nas"
+	IoT         = "iot"
+	Hypervisor  = "hypervisor"
+	Workstation = "workstation"
+	Phone       = "phone"
+	Container   = "container"
+	Unknown     = "unknown"
+)
+
+// Types lists the device types rules may assign.
+var Types = []string{Router, Switch, Printer, NAS, IoT, Hypervisor, Workstation, Phone, Container}
+
+//go:embed rules.yaml
+var defaultRules []byte
+
+// Evidence is everything known about one host. Empty fields simply match no rule.
+type Evidence struct {
+	Vendor    string // MAC vendor
+	Hostname  string
+	OS        []string // OS match names and families, e.g. "Linux 5.0 - 5.4", "RouterOS"
+	OSTypes   []string // nmap osclass types, e.g. "router", "printer", "general purpose"
+	Ports     []string // open ports as "port/proto", e.g. "9100/tcp"
+	Services  []string // service names, e.g. "ipp"
+	MDNS      []string // advertised mDNS service types, e.g. "_ipp._tcp"
+	SSDP      []string // SSDP SERVER and device type headers
+	Image     string   // Docker image of a container
+	Container bool     // the host is a container
+	Gateway   bool     // the host is the default gateway of the scanned network
+}
+
+// Result is the outcome of a classification. Confidence is 0-100; Rules names the rules that voted
+// for Type.
+type Result struct {
+	Type       string
+	Confidence int
+	Rules      []string
+}
+
+// Match lists the conditions of a rule. Every non-empty field must match (a rule with ports and
+// vendor needs both); within a field any entry may match. Entries of vendor, hostname, os,
+// os_type, mdns, ssdp and image are case-insensitive regular expressions, ports are "port/proto" or
+// a bare port number, services are exact service names; container and gateway are booleans.
+type Match struct {
+	Vendor    []string `yaml:"vendor"`
+	Hostname  []string `yaml:"hostname"`
+	OS        []string `yaml:"os"`
+	OSType    []string `yaml:"os_type"`
+	Ports     []string `yaml:"ports"`
+	Services  []string `yaml:"services"`
+	MDNS      []string `yaml:"mdns"`
+	SSDP      []string `yaml:"ssdp"`
+	Image     []string `yaml:"image"`
+	Container *bool    `yaml:"container"`
+	Gateway   *bool    `yaml:"gateway"`
+}
+
+// Rule adds Weight to Type when Match matches. A user rule with the name of a built-in rule
+// replaces it; Disabled drops it.
+type Rule struct {
+	Name     string `yaml:"name"`
+	Type     string `yaml:"type"`
+	Weight   int    `yaml:"weight"`
+	Disabled bool   `yaml:"disabled"`
+	Match    Match  `yaml:"match"`
+}
+
+// RuleSet is the layout of the rules file.
+type RuleSet struct {
+	// Defaults set to false discards the built-in rules instead of merging into them.
+	Defaults *bool  `yaml:"defaults"`
+	Rules    []Rule `yaml:"rules"`
+}
+
+// Classifier holds compiled rules. It is safe for concurrent use.
+type Classifier struct {
+	rules []compiledRule
+}
+
+type compiledRule struct {
+	Rule
+	vendor, hostname, os, osType, mdns, ssdp, image []*regexp.Regexp
+	ports                                           map[string]bool
+	services                                        map[string]bool
+}
+
+// Load returns the built-in rules merged with the rules file at path. A missing file is not an error.
+func Load(path string) (*Classifier, error) {
+	builtin, err := parseRuleSet(defaultRules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid built-in classification rules: %v", err)
+	}
+	if path == "" {
+		return New(builtin.Rules)
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return New(builtin.Rules)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	user, err := parseRuleSet(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if user.Defaults != nil && !*user.Defaults {
+		return New(user.Rules)
+	}
+	return New(MergeRules(builtin.Rules, user.Rules))
+}
+
+func parseRuleSet(data []byte) (RuleSet, error) {
+	var set RuleSet
+	if err := yaml.Unmarshal(data, &set); err != nil {
+		return RuleSet{}, err
+	}
+	return set, nil
+}
+
+// MergeRules applies overrides to base: a rule with an existing name replaces it in place, others
+// are appended.
+func MergeRules(base, overrides []Rule) []Rule {
+	merged := append([]Rule(nil), base...)
+	index := make(map[string]int)
+	for i, r := range merged {
+		if r.Name != "" {
+			index[r.Name] = i
+		}
+	}
+	for _, r := range overrides {
+		if i, ok := index[r.Name]; ok && r.Name != "" {
+			merged[i] = r
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// New compiles rules. Disabled rules are skipped.
+func New(rules []Rule) (*Classifier, error) {
+	c := &Classifier{}
+	for i, r := range rules {
+		if r.Disabled {
+			continue
+		}
+		name := r.Name
+		if name == "" {
+			name = "#" + strconv.Itoa(i+1)
+		}
+		if !validType(r.Type) {
+			return nil, fmt.Errorf("rule %s: unknown device type %q", name, r.Type)
+		}
+		if r.Weight <= 0 {
+			return nil, fmt.Errorf("rule %s: weight must be positive", name)
+		}
+		cr, err := compile(r)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %v", name, err)
+		}
+		if cr.empty() {
+			return nil, fmt.Errorf("rule %s: no match conditions", name)
+		}
+		c.rules = append(c.rules, cr)
+	}
+	return c, nil
+}
+
+func validType(t string) bool {
+	for _, known := range Types {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+func compile(r Rule) (compiledRule, error) {
+	cr := compiledRule{Rule: r}
+	patterns := []struct {
+		dst *[]*regexp.Regexp
+		src []string
+	}{
+		{&cr.vendor, r.Match.Vendor},
+		{&cr.hostname, r.Match.Hostname},
+		{&cr.os, r.Match.OS},
+		{&cr.osType, r.Match.OSType},
+		{&cr.mdns, r.Match.MDNS},
+		{&cr.ssdp, r.Match.SSDP},
+		{&cr.image, r.Match.Image},
+	}
+	for _, p := range patterns {
+		for _, expr := range p.src {
+			re, cerr := regexp.Compile("(?i)" + expr)
+			if cerr != nil {
+				return cr, fmt.Errorf("invalid pattern %q: %v", expr, cerr)
+			}
+			*p.dst = append(*p.dst, re)
+		}
+	}
+	if len(r.Match.Ports) > 0 {
+		cr.ports = make(map[string]bool)
+		for _, p := range r.Match.Ports {
+			cr.ports[strings.ToLower(strings.TrimSpace(p))] = true
+		}
+	}
+	if len(r.Match.Services) > 0 {
+		cr.services = make(map[string]bool)
+		for _, s := range r.Match.Services {
+			cr.services[strings.ToLower(strings.TrimSpace(s))] = true
+		}
+	}
+	return cr, nil
+}
+
+func (r compiledRule) empty() bool {
+	return len(r.vendor)+len(r.hostname)+len(r.os)+len(r.osType)+len(r.mdns)+len(r.ssdp)+len(r.image)+
+		len(r.ports)+len(r.services) == 0 && r.Match.Container == nil && r.Match.Gateway == nil
+}
+
+func (r compiledRule) matches(e Evidence) bool {
+	if len(r.vendor) > 0 && !anyMatch(r.vendor, e.Vendor) {
+		return false
+	}
+	if len(r.hostname) > 0 && !anyMatch(r.hostname, e.Hostname) {
+		return false
+	}
+	if len(r.os) > 0 && !anyMatch(r.os, e.OS...) {
+		return false
+	}
+	if len(r.osType) > 0 && !anyMatch(r.osType, e.OSTypes...) {
+		return false
+	}
+	if len(r.mdns) > 0 && !anyMatch(r.mdns, e.MDNS...) {
+		return false
+	}
+	if len(r.ssdp) > 0 && !anyMatch(r.ssdp, e.SSDP...) {
+		return false
+	}
+	if len(r.image) > 0 && !anyMatch(r.image, e.Image) {
+		return false
+	}
+	if r.ports != nil && !r.matchPort(e.Ports) {
+		return false
+	}
+	if r.services != nil && !r.matchService(e.Services) {
+		return false
+	}
+	if r.Match.Container != nil && *r.Match.Container != e.Container {
+		return false
+	}
+	if r.Match.Gateway != nil && *r.Match.Gateway != e.Gateway {
+		return false
+	}
+	return true
+}
+
+func anyMatch(patterns []*regexp.Regexp, values ...string) bool {
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		for _, re := range patterns {
+			if re.MatchString(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r compiledRule) matchPort(ports []string) bool {
+	for _, p := range ports {
+		p = strings.ToLower(p)
+		if r.ports[p] || r.ports[strings.SplitN(p, "/", 2)[0]] {
+			return true
+		}
+	}
+	return false
+}
+
+func (r compiledRule) matchService(services []string) bool {
+	for _, s := range services {
+		if r.services[strings.ToLower(s)] {
+			return true
+		}
+	}
+	return false
+}
+
+// Classify scores e against every rule. Confidence is the winning score (capped at 100) scaled by
+// the winner's share of all votes, so contradicting evidence lowers it. Hosts no rule matches are
+// Unknown with confidence 0.
+func (c *Classifier) Classify(e Evidence) Result {
+	scores := make(map[string]int)
+	voters := make(map[string][]string)
+	total := 0
+	for _, r := range c.rules {
+		if !r.matches(e) {
+			continue
+		}
+		scores[r.Type] += r.Weight
+		voters[r.Type] = append(voters[r.Type], r.Name)
+		total += r.Weight
+	}
+	if total == 0 {
+		return Result{Type: Unknown}
+	}
+
+	types := make([]string, 0, len(scores))
+	for t := range scores {
+		types = append(types, t)
+	}
+	// Highest score first; ties go to the type listed first in Types so results are stable
+	sort.Slice(types, func(i, j int) bool {
+		if scores[types[i]] != scores[types[j]] {
+			return scores[types[i]] > scores[types[j]]
+		}
+		return typeRank(types[i]) < typeRank(types[j])
+	})
+	best := types[0]
+	score := scores[best]
+	capped := score
+	if capped > 100 {
+		capped = 100
+	}
+	return Result{Type: best, Confidence: capped * score / total, Rules: voters[best]}
+}
+
+func typeRank(t string) int {
+	for i, known := range Types {
+		if t == known {
+			return i
+		}
+	}
+	return len(Types)
+}
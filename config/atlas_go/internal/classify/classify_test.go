@@ -0,0 +1,144 @@
+package classify
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClassifyBuiltinRules(t *testing.T) {
+	c, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		evidence Evidence
+		want     string
+		rules    []string
+	}{
+		{"nothing known", Evidence{}, Unknown, nil},
+		{"default gateway", Evidence{Gateway: true, Services: []string{"domain", "http"}}, Router, []string{"default-gateway", "router-dns-service"}},
+		{"fritzbox", Evidence{Hostname: "fritz.box", Vendor: "AVM Audiovisuelles Marketing und Computersysteme GmbH"}, Router, []string{"router-vendor", "router-hostname"}},
+		{"managed switch", Evidence{OSTypes: []string{"switch"}, Hostname: "sw-core-01"}, Switch, []string{"switch-os-class", "switch-hostname"}},
+		{"network printer", Evidence{Ports: []string{"9100/tcp", "631/tcp"}, Services: []string{"jetdirect", "ipp"}, MDNS: []string{"_ipp._tcp"}}, Printer,
+			[]string{"printer-jetdirect", "printer-ipp-lpd", "printer-mdns"}},
+		{"printer by bare port", Evidence{Ports: []string{"9100/TCP"}}, Printer, []string{"printer-jetdirect"}},
+		{"synology", Evidence{Vendor: "Synology Incorporated", Hostname: "diskstation", Services: []string{"ssh", "nfs"}}, NAS,
+			[]string{"nas-vendor", "nas-hostname", "nas-file-services"}},
+		{"esphome plug", Evidence{Vendor: "Espressif Inc.", MDNS: []string{"_esphomelib._tcp"}}, IoT, []string{"iot-vendor", "iot-mdns"}},
+		{"camera", Evidence{Hostname: "cam-garage", Services: []string{"rtsp"}}, IoT, []string{"iot-rtsp", "iot-hostname"}},
+		{"proxmox", Evidence{Hostname: "pve01", Ports: []string{"22/tcp", "8006/tcp"}, OS: []string{"Linux 5.15"}}, Hypervisor,
+			[]string{"hypervisor-ports", "hypervisor-hostname"}},
+		{"windows desktop", Evidence{OS: []string{"Microsoft Windows 11 21H2"}, OSTypes: []string{"general purpose"}, Services: []string{"ms-wbt-server"}},
+			Workstation, []string{"workstation-os-class", "workstation-os", "workstation-remote-desktop"}},
+		{"iphone", Evidence{Hostname: "kims-iphone", MDNS: []string{"_apple-mobdev2._tcp"}}, Phone, []string{"phone-hostname", "phone-mdns"}},
+		{"container", Evidence{Container: true, Image: "nginx:1.27", Ports: []string{"80/tcp"}}, Container, []string{"container"}},
+		{"gateway named nas", Evidence{Gateway: true, Hostname: "nas"}, Router, []string{"default-gateway"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := c.Classify(tt.evidence)
+			if got.Type != tt.want || !reflect.DeepEqual(got.Rules, tt.rules) {
+				t.Errorf("Classify = %s by %v, want %s by %v", got.Type, got.Rules, tt.want, tt.rules)
+			}
+			if (got.Type == Unknown) != (got.Confidence == 0) {
+				t.Errorf("confidence %d for type %s", got.Confidence, got.Type)
+			}
+		})
+	}
+}
+
+func TestClassifyConfidence(t *testing.T) {
+	c, err := New([]Rule{
+		{Name: "a", Type: Printer, Weight: 60, Match: Match{Ports: []string{"9100"}}},
+		{Name: "b", Type: Printer, Weight: 60, Match: Match{Services: []string{"ipp"}}},
+		{Name: "c", Type: NAS, Weight: 40, Match: Match{Hostname: []string{"nas"}}},
+		{Name: "d", Type: Router, Weight: 40, Match: Match{Hostname: []string{"gw"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		evidence   Evidence
+		want       string
+		confidence int
+	}{
+		{"one rule", Evidence{Ports: []string{"9100/tcp"}}, Printer, 60},
+		{"capped at 100", Evidence{Ports: []string{"9100/tcp"}, Services: []string{"IPP"}}, Printer, 100},
+		{"contradicted", Evidence{Ports: []string{"9100/tcp"}, Hostname: "nas"}, Printer, 36}, // 60 * 60 / 100
+		{"tie goes to the first type", Evidence{Hostname: "gw-nas"}, Router, 20},              // 40 * 40 / 80
+	}
+	for _, tt := range tests {
+		got := c.Classify(tt.evidence)
+		if got.Type != tt.want || got.Confidence != tt.confidence {
+			t.Errorf("%s: Classify = %s (%d), want %s (%d)", tt.name, got.Type, got.Confidence, tt.want, tt.confidence)
+		}
+	}
+}
+
+func TestNewInvalidRules(t *testing.T) {
+	tests := []struct {
+		rule Rule
+		err  string
+	}{
+		{Rule{Name: "x", Type: "toaster", Weight: 10, Match: Match{Hostname: []string{"x"}}}, `rule x: unknown device type "toaster"`},
+		{Rule{Name: "x", Type: NAS, Match: Match{Hostname: []string{"x"}}}, "rule x: weight must be positive"},
+		{Rule{Name: "x", Type: NAS, Weight: 10, Match: Match{Vendor: []string{"("}}}, `rule x: invalid pattern "("`},
+		{Rule{Type: NAS, Weight: 10}, "rule #1: no match conditions"},
+	}
+	for _, tt := range tests {
+		if _, err := New([]Rule{tt.rule}); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("New(%+v) error = %v, want %q", tt.rule, err, tt.err)
+		}
+	}
+	if _, err := New([]Rule{{Name: "off", Type: "toaster", Disabled: true}}); err != nil {
+		t.Errorf("a disabled rule is still checked: %v", err)
+	}
+}
+
+func TestLoadRulesFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		evidence Evidence
+		want     string
+	}{
+		{"missing file keeps the built-in rules", "", Evidence{Ports: []string{"9100/tcp"}}, Printer},
+		{"rule replaced by name", "rules:\n  - name: printer-jetdirect\n    type: iot\n    weight: 50\n    match:\n      ports: [\"9100/tcp\"]\n",
+			Evidence{Ports: []string{"9100/tcp"}}, IoT},
+		{"rule disabled", "rules:\n  - name: printer-jetdirect\n    disabled: true\n", Evidence{Ports: []string{"9100/tcp"}}, Unknown},
+		{"rule added", "rules:\n  - name: home-assistant\n    type: iot\n    weight: 80\n    match:\n      image: [\"home-assistant\"]\n",
+			Evidence{Image: "ghcr.io/home-assistant/home-assistant:stable"}, IoT},
+		{"defaults dropped", "defaults: false\nrules:\n  - name: only\n    type: nas\n    weight: 10\n    match:\n      hostname: [\"^box$\"]\n",
+			Evidence{Gateway: true, Hostname: "box"}, NAS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "device_rules.yaml")
+			if tt.file != "" {
+				if err := os.WriteFile(path, []byte(tt.file), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			c, err := Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.Classify(tt.evidence); got.Type != tt.want {
+				t.Errorf("Classify = %s by %v, want %s", got.Type, got.Rules, tt.want)
+			}
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "device_rules.yaml")
+	if err := os.WriteFile(path, []byte("rules: [\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "failed to parse "+path) {
+		t.Errorf("Load of a broken file: error = %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Device is a physical or virtual machine that may appear under several addresses.
+type Device struct {
+	ID           int64
+	MAC          string
+	Name         string
+	FirstSeen    string
+	LastSeen     string
+	Fingerprints []string
+	Addresses    []DeviceAddress
+}
+
+// DeviceAddress is an address a device has been seen at.
+type DeviceAddress struct {
+	IP            string
+	InterfaceName string
+	FirstSeen     string
+	LastSeen      string
+}
+
+// LinkDevice finds or creates the device behind a hosts row and links the row to it. Observations
+// are matched by MAC address first, then by SSH/TLS key fingerprint, then by hostname (only when
+// exactly one device carries it), and finally by the device the row was already linked to.
+func LinkDevice(q DBTX, host HostState, fingerprints []string) (int64, error) {
+	mac := ""
+	if known(host.MAC) {
+		mac = strings.ToLower(host.MAC)
+	}
+	name := ""
+	if usableDeviceName(host.Name) {
+		name = host.Name
+	}
+
+	id, err := findDevice(q, host, mac, name, fingerprints)
+	if err != nil {
+		return 0, err
+	}
+	if id == 0 {
+		res, err := q.Exec(`INSERT INTO devices (mac_address, name) VALUES (?, ?)`, nullString(mac), nullString(name))
+		if err != nil {
+			return 0, fmt.Errorf("failed to create device for %s: %v", host.IP, err)
+		}
+		if id, err = res.LastInsertId(); err != nil {
+			return 0, err
+		}
+	} else {
+		// Fill in what the device did not know yet; a MAC that already belongs to another device stays there
+		if _, err := q.Exec(`
+			UPDATE devices SET
+				last_seen = CURRENT_TIMESTAMP,
+				name = COALESCE(?, name),
+				mac_address = CASE
+					WHEN mac_address IS NULL AND ? IS NOT NULL AND NOT EXISTS (SELECT 1 FROM devices WHERE mac_address = ?) THEN ?
+					ELSE mac_address END
+			WHERE id = ?
+		`, nullString(name), nullString(mac), nullString(mac), nullString(mac), id); err != nil {
+			return 0, fmt.Errorf("failed to update device %d: %v", id, err)
+		}
+	}
+
+	for _, fp := range fingerprints {
+		if _, err := q.Exec(`
+			INSERT INTO device_fingerprints (device_id, fingerprint) VALUES (?, ?)
+			ON CONFLICT(fingerprint) DO UPDATE SET last_seen = CURRENT_TIMESTAMP
+		`, id, fp); err != nil {
+			return 0, fmt.Errorf("failed to record fingerprint for device %d: %v", id, err)
+		}
+	}
+	if _, err := q.Exec(`
+		INSERT INTO device_address_history (device_id, ip, interface_name) VALUES (?, ?, ?)
+		ON CONFLICT(device_id, ip, interface_name) DO UPDATE SET last_seen = CURRENT_TIMESTAMP
+	`, id, host.IP, host.InterfaceName); err != nil {
+		return 0, fmt.Errorf("failed to record address of device %d: %v", id, err)
+	}
+	if _, err := q.Exec(`UPDATE hosts SET device_id = ? WHERE id = ?`, id, host.ID); err != nil {
+		return 0, fmt.Errorf("failed to link host %s to device %d: %v", host.IP, id, err)
+	}
+	return id, nil
+}
+
+func findDevice(q DBTX, host HostState, mac, name string, fingerprints []string) (int64, error) {
+	var id int64
+	lookup := func(query string, args ...any) (bool, error) {
+		err := q.QueryRow(query, args...).Scan(&id)
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	if mac != "" {
+		if ok, err := lookup(`SELECT id FROM devices WHERE mac_address = ?`, mac); ok || err != nil {
+			return id, err
+		}
+	}
+	for _, fp := range fingerprints {
+		if ok, err := lookup(`SELECT device_id FROM device_fingerprints WHERE fingerprint = ?`, fp); ok || err != nil {
+			return id, err
+		}
+	}
+	if name != "" {
+		// A device with a different MAC is a different machine that happens to share the name
+		if ok, err := lookup(`
+			SELECT MIN(id) FROM devices
+			WHERE name = ? AND (? IS NULL OR mac_address IS NULL)
+			HAVING COUNT(*) = 1
+		`, name, nullString(mac)); ok || err != nil {
+			return id, err
+		}
+	}
+	// Without anything identifying, keep the link the address already had, unless that device
+	// is known by a different MAC
+	if ok, err := lookup(`
+		SELECT d.id FROM hosts h JOIN devices d ON d.id = h.device_id
+		WHERE h.id = ? AND (? IS NULL OR d.mac_address IS NULL OR d.mac_address = ?)
+	`, host.ID, nullString(mac), nullString(mac)); ok || err != nil {
+		return id, err
+	}
+	return 0, nil
+}
+
+// usableDeviceName reports whether a host name is specific enough to identify a device.
+func usableDeviceName(name string) bool {
+	switch strings.ToLower(name) {
+	case "", "unknown", "noname", "localhost":
+		return false
+	}
+	return net.ParseIP(name) == nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// GetDevice returns a device with its fingerprints and address history, or nil if there is none.
+func (s *Store) GetDevice(id int64) (*Device, error) {
+	var d Device
+	err := s.DB.QueryRow(`SELECT id, COALESCE(mac_address, ''), COALESCE(name, ''), COALESCE(first_seen, ''), COALESCE(last_seen, '')
+		FROM devices WHERE id = ?`, id).Scan(&d.ID, &d.MAC, &d.Name, &d.FirstSeen, &d.LastSeen)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.DB.Query(`SELECT fingerprint FROM device_fingerprints WHERE device_id = ? ORDER BY fingerprint`, id)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var fp string
+		if err := rows.Scan(&fp); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		d.Fingerprints = append(d.Fingerprints, fp)
+	}
+	rows.Close()
+
+	rows, err = s.DB.Query(`SELECT ip, COALESCE(interface_name, ''), COALESCE(first_seen, ''), COALESCE(last_seen, '')
+		FROM device_address_history WHERE device_id = ? ORDER BY first_seen, id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a DeviceAddress
+		if err := rows.Scan(&a.IP, &a.InterfaceName, &a.FirstSeen, &a.LastSeen); err != nil {
+			return nil, err
+		}
+		d.Addresses = append(d.Addresses, a)
+	}
+	return &d, rows.Err()
+}
+
+// DeviceForHost returns the id of the device linked to the host ip on iface (0 if none).
+func (s *Store) DeviceForHost(ip, iface string) (int64, error) {
+	var id sql.NullInt64
+	err := s.DB.QueryRow(`SELECT device_id FROM hosts WHERE ip = ? AND interface_name = ?`, ip, iface).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id.Int64, err
+}
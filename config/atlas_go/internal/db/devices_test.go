@@ -0,0 +1,88 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLinkDevice(t *testing.T) {
+	type observation struct {
+		ip, mac, name string
+		fingerprints  []string
+	}
+	tests := []struct {
+		name string
+		seen []observation
+		want []int // device of each observation, numbered in order of creation
+	}{
+		{"same mac on two addresses", []observation{
+			{"192.168.1.10", "52:54:00:ab:cd:ef", "nas.lan", nil},
+			{"192.168.1.11", "52:54:00:AB:CD:EF", "Unknown", nil},
+		}, []int{1, 1}},
+		{"different macs sharing a name", []observation{
+			{"192.168.1.10", "52:54:00:00:00:01", "printer.lan", nil},
+			{"192.168.1.11", "52:54:00:00:00:02", "printer.lan", nil},
+		}, []int{1, 2}},
+		{"ssh key follows a new mac", []observation{
+			{"192.168.1.10", "52:54:00:00:00:01", "NoName", []string{"ssh-ed25519:abc"}},
+			{"192.168.1.20", "da:a1:19:00:00:01", "NoName", []string{"ssh-ed25519:abc"}},
+		}, []int{1, 1}},
+		{"unique name without mac", []observation{
+			{"192.168.1.10", "52:54:00:00:00:01", "nas.lan", nil},
+			{"2001:db8::10", "Unknown", "nas.lan", nil},
+		}, []int{1, 1}},
+		{"ambiguous name without mac", []observation{
+			{"192.168.1.10", "52:54:00:00:00:01", "printer.lan", nil},
+			{"192.168.1.11", "52:54:00:00:00:02", "printer.lan", nil},
+			{"192.168.1.12", "Unknown", "printer.lan", nil},
+		}, []int{1, 2, 3}},
+		{"names that identify nothing", []observation{
+			{"192.168.1.10", "Unknown", "NoName", nil},
+			{"192.168.1.11", "Unknown", "NoName", nil},
+			{"192.168.1.12", "Unknown", "192.168.1.12", nil},
+		}, []int{1, 2, 3}},
+		{"address keeps its device", []observation{
+			{"192.168.1.10", "52:54:00:00:00:01", "NoName", nil},
+			{"192.168.1.10", "Unknown", "NoName", nil},
+		}, []int{1, 1}},
+		{"address taken over by another mac", []observation{
+			{"192.168.1.10", "52:54:00:00:00:01", "NoName", nil},
+			{"192.168.1.10", "52:54:00:00:00:02", "NoName", nil},
+		}, []int{1, 2}},
+		{"mac learned later", []observation{
+			{"192.168.1.10", "Unknown", "nas.lan", nil},
+			{"192.168.1.10", "52:54:00:00:00:01", "nas.lan", nil},
+			{"192.168.1.11", "52:54:00:00:00:01", "NoName", nil},
+		}, []int{1, 1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := openFixture(t, "")
+			if err := s.Migrate(); err != nil {
+				t.Fatal(err)
+			}
+			numbers := make(map[int64]int)
+			var got []int
+			for _, o := range tt.seen {
+				var id int64
+				err := s.DB.QueryRow(`INSERT INTO hosts (ip, interface_name, name, mac_address) VALUES (?, 'eth0', ?, ?)
+					ON CONFLICT(ip, interface_name) DO UPDATE SET name = excluded.name, mac_address = excluded.mac_address
+					RETURNING id`, o.ip, o.name, o.mac).Scan(&id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				device, err := LinkDevice(s.DB, HostState{ID: id, IP: o.ip, InterfaceName: "eth0", Name: o.name, MAC: o.mac}, o.fingerprints)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if numbers[device] == 0 {
+					numbers[device] = len(numbers) + 1
+				}
+				got = append(got, numbers[device])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("devices = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
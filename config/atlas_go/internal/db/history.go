@@ -0,0 +1,243 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Host event types recorded in host_events.
+const (
+	EventFirstSeen   = "first_seen"
+	EventOnline      = "online"
+	EventOffline     = "offline"
+	EventPortOpened  = "port_opened"
+	EventPortClosed  = "port_closed"
+	EventOSChanged   = "os_changed"
+	EventMACChanged  = "mac_changed"
+	EventNameChanged = "name_changed"
+)
+
+// DBTX is satisfied by both *sql.DB and *sql.Tx, so history can be written inside a scanner's
+// own transaction.
+type DBTX interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// ScanRef identifies the scan that made an observation.
+type ScanRef struct {
+	Type    string // fastscan, deepscan, ...
+	RunID   int64  // scan run id, 0 when unknown
+	Profile string // deep scan profile, empty for other scans
+}
+
+// HostState is the tracked part of a hosts row.
+type HostState struct {
+	ID            int64
+	IP            string
+	InterfaceName string
+	Name          string
+	OS            string
+	MAC           string
+	OpenPorts     string
+	Status        string
+}
+
+// HostEvent is one change in a host's timeline.
+type HostEvent struct {
+	ID            int64
+	HostID        int64
+	IP            string
+	InterfaceName string
+	Type          string
+	OldValue      string
+	NewValue      string
+	ScanType      string
+	ScanRunID     int64
+	ObservedAt    string
+}
+
+const hostStateColumns = `id, ip, COALESCE(interface_name, ''), COALESCE(name, ''), COALESCE(os_details, ''),
+	COALESCE(mac_address, ''), COALESCE(open_ports, ''), COALESCE(online_status, '')`
+
+func scanHostState(row interface{ Scan(...any) error }) (HostState, error) {
+	var h HostState
+	err := row.Scan(&h.ID, &h.IP, &h.InterfaceName, &h.Name, &h.OS, &h.MAC, &h.OpenPorts, &h.Status)
+	return h, err
+}
+
+// LoadHostState returns the current state of the host ip on iface, or nil if it is not known yet.
+func LoadHostState(q DBTX, ip, iface string) (*HostState, error) {
+	h, err := scanHostState(q.QueryRow(`SELECT `+hostStateColumns+` FROM hosts WHERE ip = ? AND interface_name = ?`, ip, iface))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// LoadHostStates returns the current state of every host on iface, keyed by IP.
+func LoadHostStates(q DBTX, iface string) (map[string]HostState, error) {
+	rows, err := q.Query(`SELECT `+hostStateColumns+` FROM hosts WHERE interface_name = ?`, iface)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	states := make(map[string]HostState)
+	for rows.Next() {
+		h, err := scanHostState(rows)
+		if err != nil {
+			return nil, err
+		}
+		states[h.IP] = h
+	}
+	return states, rows.Err()
+}
+
+// DiffHostState returns the events that lead from prev (nil for a new host) to cur. Fields a scan
+// could not determine ("" or "Unknown") never produce an event, so a fast scan that knows no ports
+// does not close every port a deep scan found.
+func DiffHostState(prev *HostState, cur HostState) []HostEvent {
+	event := func(typ, oldValue, newValue string) HostEvent {
+		return HostEvent{HostID: cur.ID, IP: cur.IP, InterfaceName: cur.InterfaceName, Type: typ, OldValue: oldValue, NewValue: newValue}
+	}
+	if prev == nil {
+		return []HostEvent{event(EventFirstSeen, "", cur.Status)}
+	}
+
+	var events []HostEvent
+	if prev.Status != cur.Status && cur.Status != "" {
+		typ := EventOffline
+		if cur.Status == "online" {
+			typ = EventOnline
+		}
+		events = append(events, event(typ, prev.Status, cur.Status))
+	}
+	if known(cur.Name) && prev.Name != cur.Name {
+		events = append(events, event(EventNameChanged, prev.Name, cur.Name))
+	}
+	if known(cur.OS) && prev.OS != cur.OS {
+		events = append(events, event(EventOSChanged, prev.OS, cur.OS))
+	}
+	if known(cur.MAC) && !strings.EqualFold(prev.MAC, cur.MAC) {
+		events = append(events, event(EventMACChanged, prev.MAC, cur.MAC))
+	}
+	if known(cur.OpenPorts) {
+		before, after := portSet(prev.OpenPorts), portSet(cur.OpenPorts)
+		for _, p := range sortedSetKeys(after) {
+			if !before[p] {
+				events = append(events, event(EventPortOpened, "", p))
+			}
+		}
+		for _, p := range sortedSetKeys(before) {
+			if !after[p] {
+				events = append(events, event(EventPortClosed, p, ""))
+			}
+		}
+	}
+	return events
+}
+
+// RecordHostObservation appends a snapshot of cur and the events since prev. Pass snapshot=false
+// for bookkeeping updates (such as marking unseen hosts offline) that only need events.
+func RecordHostObservation(q DBTX, prev *HostState, cur HostState, scan ScanRef, snapshot bool) error {
+	runID := scan.RunIDValue()
+	if snapshot {
+		if _, err := q.Exec(`
+			INSERT INTO host_snapshots (host_id, ip, interface_name, name, os_details, mac_address, open_ports, online_status, scan_type, scan_run_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, cur.ID, cur.IP, cur.InterfaceName, cur.Name, cur.OS, cur.MAC, cur.OpenPorts, cur.Status, scan.Type, runID); err != nil {
+			return fmt.Errorf("failed to write snapshot of %s: %v", cur.IP, err)
+		}
+	}
+	for _, e := range DiffHostState(prev, cur) {
+		if _, err := q.Exec(`
+			INSERT INTO host_events (host_id, ip, interface_name, event_type, old_value, new_value, scan_type, scan_run_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, e.HostID, e.IP, e.InterfaceName, e.Type, e.OldValue, e.NewValue, scan.Type, runID); err != nil {
+			return fmt.Errorf("failed to write %s event for %s: %v", e.Type, cur.IP, err)
+		}
+	}
+	return nil
+}
+
+// HostTimeline returns the events of the host ip, oldest first. An empty iface matches the host
+// on every interface.
+func (s *Store) HostTimeline(ip, iface string) ([]HostEvent, error) {
+	if iface != "" {
+		return s.queryEvents(`WHERE ip = ? AND interface_name = ?`, ip, iface)
+	}
+	return s.queryEvents(`WHERE ip = ?`, ip)
+}
+
+func (s *Store) queryEvents(where string, args ...any) ([]HostEvent, error) {
+	rows, err := s.DB.Query(`SELECT id, COALESCE(host_id, 0), ip, COALESCE(interface_name, ''), event_type, COALESCE(old_value, ''),
+		COALESCE(new_value, ''), COALESCE(scan_type, ''), COALESCE(scan_run_id, 0), COALESCE(observed_at, '')
+		FROM host_events `+where+` ORDER BY observed_at, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []HostEvent
+	for rows.Next() {
+		var e HostEvent
+		if err := rows.Scan(&e.ID, &e.HostID, &e.IP, &e.InterfaceName, &e.Type, &e.OldValue, &e.NewValue, &e.ScanType, &e.ScanRunID, &e.ObservedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// HostSnapshots returns the recorded states of the host ip on iface, oldest first.
+func (s *Store) HostSnapshots(ip, iface string) ([]HostState, error) {
+	rows, err := s.DB.Query(`SELECT COALESCE(host_id, 0), ip, COALESCE(interface_name, ''), COALESCE(name, ''), COALESCE(os_details, ''),
+		COALESCE(mac_address, ''), COALESCE(open_ports, ''), COALESCE(online_status, '')
+		FROM host_snapshots WHERE ip = ? AND interface_name = ? ORDER BY observed_at, id`, ip, iface)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var states []HostState
+	for rows.Next() {
+		h, err := scanHostState(rows)
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, h)
+	}
+	return states, rows.Err()
+}
+
+func known(v string) bool {
+	return v != "" && v != "Unknown"
+}
+
+var portPattern = regexp.MustCompile(`\b\d+/(tcp|udp|sctp)\b`)
+
+// portSet extracts "22/tcp"-style keys from an open_ports string such as
+// "22/tcp (ssh OpenSSH 8.9p1), 80/tcp (http)".
+func portSet(openPorts string) map[string]bool {
+	set := make(map[string]bool)
+	for _, p := range portPattern.FindAllString(openPorts, -1) {
+		set[p] = true
+	}
+	return set
+}
+
+func sortedSetKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
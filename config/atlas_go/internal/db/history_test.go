@@ -0,0 +1,60 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffHostState(t *testing.T) {
+	nas := HostState{ID: 7, IP: "192.168.1.10", InterfaceName: "eth0", Name: "nas.lan", OS: "Linux 5.15",
+		MAC: "52:54:00:ab:cd:ef", OpenPorts: "22/tcp (ssh), 445/tcp (microsoft-ds)", Status: "online"}
+	with := func(change func(*HostState)) HostState {
+		h := nas
+		change(&h)
+		return h
+	}
+	type ev struct{ Type, Old, New string }
+
+	tests := []struct {
+		name string
+		prev *HostState
+		cur  HostState
+		want []ev
+	}{
+		{"new host", nil, nas, []ev{{EventFirstSeen, "", "online"}}},
+		{"unchanged", &nas, nas, nil},
+		{"goes offline", &nas, with(func(h *HostState) { h.Status = "offline" }), []ev{{EventOffline, "online", "offline"}}},
+		{"comes back", ptr(with(func(h *HostState) { h.Status = "offline" })), nas, []ev{{EventOnline, "offline", "online"}}},
+		{"status not determined", &nas, with(func(h *HostState) { h.Status = "" }), nil},
+		{"renamed", &nas, with(func(h *HostState) { h.Name = "storage.lan" }), []ev{{EventNameChanged, "nas.lan", "storage.lan"}}},
+		{"os changed", &nas, with(func(h *HostState) { h.OS = "Linux 6.1" }), []ev{{EventOSChanged, "Linux 5.15", "Linux 6.1"}}},
+		{"os unknown", &nas, with(func(h *HostState) { h.OS = "Unknown" }), nil},
+		{"mac changed", &nas, with(func(h *HostState) { h.MAC = "52:54:00:12:34:56" }), []ev{{EventMACChanged, "52:54:00:ab:cd:ef", "52:54:00:12:34:56"}}},
+		{"mac case only", &nas, with(func(h *HostState) { h.MAC = "52:54:00:AB:CD:EF" }), nil},
+		{"mac unknown", &nas, with(func(h *HostState) { h.MAC = "Unknown" }), nil},
+		{"ports opened and closed", &nas, with(func(h *HostState) { h.OpenPorts = "22/tcp (ssh), 80/tcp (http), 53/udp (domain)" }),
+			[]ev{{EventPortOpened, "", "53/udp"}, {EventPortOpened, "", "80/tcp"}, {EventPortClosed, "445/tcp", ""}}},
+		{"service renamed only", &nas, with(func(h *HostState) { h.OpenPorts = "22/tcp (ssh OpenSSH 9.6), 445/tcp (netbios-ssn)" }), nil},
+		{"ports unknown", &nas, with(func(h *HostState) { h.OpenPorts = "Unknown" }), nil},
+		{"first ports", ptr(with(func(h *HostState) { h.OpenPorts = "Unknown" })), nas,
+			[]ev{{EventPortOpened, "", "22/tcp"}, {EventPortOpened, "", "445/tcp"}}},
+		{"several changes", &nas, with(func(h *HostState) { h.Status, h.Name, h.OpenPorts = "offline", "old-nas.lan", "22/tcp (ssh)" }),
+			[]ev{{EventOffline, "online", "offline"}, {EventNameChanged, "nas.lan", "old-nas.lan"}, {EventPortClosed, "445/tcp", ""}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []ev
+			for _, e := range DiffHostState(tt.prev, tt.cur) {
+				if e.HostID != tt.cur.ID || e.IP != tt.cur.IP || e.InterfaceName != tt.cur.InterfaceName {
+					t.Errorf("event %+v is not for host %d %s on %s", e, tt.cur.ID, tt.cur.IP, tt.cur.InterfaceName)
+				}
+				got = append(got, ev{e.Type, e.OldValue, e.NewValue})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
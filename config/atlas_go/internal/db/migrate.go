@@ -0,0 +1,314 @@
+package db
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Migrations live in migrations/ as NNNN_name.up.sql / NNNN_name.down.sql pairs. Never edit a
+// released migration; add a new one with the next number instead.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migration is one numbered schema change.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState is a migration and whether (and when) it has been applied.
+type MigrationState struct {
+	Migration
+	Applied   bool
+	AppliedAt string
+}
+
+// Migrations returns the embedded migrations ordered by version.
+func Migrations() ([]Migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		file := e.Name()
+		base, direction := strings.TrimSuffix(file, ".sql"), ""
+		switch {
+		case strings.HasSuffix(base, ".up"):
+			base, direction = strings.TrimSuffix(base, ".up"), "up"
+		case strings.HasSuffix(base, ".down"):
+			base, direction = strings.TrimSuffix(base, ".down"), "down"
+		default:
+			return nil, fmt.Errorf("migration %s: name must end in .up.sql or .down.sql", file)
+		}
+		num, name, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: invalid version %q", file, num)
+		}
+		body, err := migrationFiles.ReadFile(path.Join("migrations", file))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	var migrations []Migration
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrate applies every pending migration.
+func (s *Store) Migrate() error {
+	return s.MigrateUp(0)
+}
+
+// MigrateUp applies pending migrations up to and including version target (0 means all).
+// Each migration runs in its own transaction together with its schema_migrations row.
+func (s *Store) MigrateUp(target int) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	if err := s.prepareMigrations(); err != nil {
+		return err
+	}
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if target > 0 && m.Version > target {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := s.applyMigration(m, m.Up, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateDown reverts applied migrations newer than version target, newest first.
+func (s *Store) MigrateDown(target int) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	if err := s.prepareMigrations(); err != nil {
+		return err
+	}
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return err
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version <= target {
+			break
+		}
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == "" {
+			return fmt.Errorf("migration %d_%s cannot be reverted", m.Version, m.Name)
+		}
+		if err := s.applyMigration(m, m.Down, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrationStatus lists every known migration with its applied state.
+func (s *Store) MigrationStatus() ([]MigrationState, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.prepareMigrations(); err != nil {
+		return nil, err
+	}
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	var states []MigrationState
+	for _, m := range migrations {
+		at, ok := applied[m.Version]
+		states = append(states, MigrationState{Migration: m, Applied: ok, AppliedAt: at})
+	}
+	return states, nil
+}
+
+// SchemaVersion returns the highest applied migration version (0 for an empty database).
+func (s *Store) SchemaVersion() (int, error) {
+	if err := s.prepareMigrations(); err != nil {
+		return 0, err
+	}
+	var version sql.NullInt64
+	err := s.DB.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version)
+	return int(version.Int64), err
+}
+
+func (s *Store) applyMigration(m Migration, script string, up bool) error {
+	direction := "up"
+	if !up {
+		direction = "down"
+	}
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(script); err != nil {
+		return fmt.Errorf("migration %d_%s (%s) failed: %v", m.Version, m.Name, direction, err)
+	}
+	if up {
+		_, err = tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, m.Version, m.Name)
+	} else {
+		_, err = tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, m.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record migration %d_%s: %v", m.Version, m.Name, err)
+	}
+	return tx.Commit()
+}
+
+// appliedMigrations returns version -> applied_at for every applied migration.
+func (s *Store) appliedMigrations() (map[int]string, error) {
+	rows, err := s.DB.Query(`SELECT version, COALESCE(applied_at, '') FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := make(map[int]string)
+	for rows.Next() {
+		var version int
+		var at string
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// prepareMigrations creates schema_migrations. Databases created before migrations existed have
+// tables but no schema_migrations; those are brought to a known version first (see adoptLegacySchema).
+func (s *Store) prepareMigrations() error {
+	var tracked int
+	if err := s.DB.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`).Scan(&tracked); err != nil {
+		return err
+	}
+	if tracked > 0 {
+		return nil
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`
+CREATE TABLE schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %v", err)
+	}
+	if err := adoptLegacySchema(tx); err != nil {
+		return fmt.Errorf("failed to adopt existing schema: %v", err)
+	}
+	return tx.Commit()
+}
+
+// adoptLegacySchema records the migrations an unversioned database already has. The oldest
+// known schema lacks hosts.interface_name; it gets the column the way older releases added it,
+// which puts it at the end of the row. Later migrations are detected by their columns.
+func adoptLegacySchema(tx *sql.Tx) error {
+	columns, err := tableColumns(tx, "hosts")
+	if err != nil || len(columns) == 0 {
+		return err
+	}
+
+	if !columns["interface_name"] {
+		for _, stmt := range []string{
+			`ALTER TABLE hosts ADD COLUMN interface_name TEXT`,
+			`UPDATE hosts SET interface_name = 'unknown' WHERE interface_name IS NULL OR interface_name = ''`,
+		} {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+	}
+	// Apply the rest of the initial schema (missing tables and indexes)
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(migrations[0].Up); err != nil {
+		return err
+	}
+
+	present := map[int]bool{
+		1: true,
+		2: columns["os_accuracy"],
+		3: columns["address_family"],
+	}
+	for _, m := range migrations {
+		if !present[m.Version] {
+			break
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, m.Version, m.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func tableColumns(tx *sql.Tx, table string) (map[string]bool, error) {
+	rows, err := tx.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
@@ -0,0 +1,328 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// openFixture returns a store on a new database loaded from testdata/<fixture>, or an empty one
+// when fixture is "".
+func openFixture(t *testing.T, fixture string) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "atlas.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	if fixture != "" {
+		script, err := os.ReadFile(filepath.Join("testdata", fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.DB.Exec(string(script)); err != nil {
+			t.Fatalf("loading %s: %v", fixture, err)
+		}
+	}
+	return s
+}
+
+// columns returns the columns of table in order.
+func columns(t *testing.T, s *Store, table string) []string {
+	t.Helper()
+	rows, err := s.DB.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// schema describes every table, index and view, with the columns of each table, so two schemas
+// can be compared regardless of how SQLite rewrote their CREATE statements.
+func schema(t *testing.T, s *Store) map[string]string {
+	t.Helper()
+	rows, err := s.DB.Query(`SELECT type, name FROM sqlite_master WHERE name NOT LIKE 'sqlite_%' AND name != 'schema_migrations'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := make(map[string]string)
+	for rows.Next() {
+		var typ, name string
+		if err := rows.Scan(&typ, &name); err != nil {
+			t.Fatal(err)
+		}
+		objects[name] = typ
+	}
+	rows.Close()
+	for name, typ := range objects {
+		if typ == "table" {
+			objects[name] = "table(" + strings.Join(columns(t, s, name), ", ") + ")"
+		}
+	}
+	return objects
+}
+
+func schemaVersion(t *testing.T, s *Store) int {
+	t.Helper()
+	v, err := s.SchemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func latestVersion(t *testing.T) int {
+	t.Helper()
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %d_%s: want version %d, versions must have no gaps", m.Version, m.Name, i+1)
+		}
+		if m.Down == "" {
+			t.Errorf("migration %d_%s has no down script", m.Version, m.Name)
+		}
+	}
+}
+
+// TestMigrationsReverse applies every migration, reverts it and applies it again, checking that
+// its down script restores the schema it started from.
+func TestMigrationsReverse(t *testing.T) {
+	s := openFixture(t, "")
+	for v := 1; v <= latestVersion(t); v++ {
+		before := schema(t, s)
+		if err := s.MigrateUp(v); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.MigrateDown(v - 1); err != nil {
+			t.Fatal(err)
+		}
+		if after := schema(t, s); !reflect.DeepEqual(after, before) {
+			t.Errorf("reverting migration %d left\n%v\nwant\n%v", v, after, before)
+		}
+		if got := schemaVersion(t, s); got != v-1 {
+			t.Errorf("after reverting migration %d the schema version is %d", v, got)
+		}
+		if err := s.MigrateUp(v); err != nil {
+			t.Fatalf("reapplying migration %d: %v", v, err)
+		}
+	}
+}
+
+// TestHostPortsFollowHosts deletes a host: its ports go with it, those of the container that has
+// the same id stay.
+func TestHostPortsFollowHosts(t *testing.T) {
+	s := openFixture(t, "")
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`INSERT INTO hosts (id, ip, name, interface_name) VALUES (1, '192.168.1.10', 'nas.lan', 'eth0')`,
+		`INSERT INTO docker_hosts (id, container_id, name, network_name) VALUES (1, 'c0ffee', 'db', 'bridge')`,
+		`INSERT INTO host_ports (host_kind, host_id, port, protocol, state) VALUES ('host', 1, 22, 'tcp', 'open'), ('host', 1, 445, 'tcp', 'open')`,
+		`INSERT INTO host_ports (host_kind, host_id, port, protocol, state) VALUES ('docker', 1, 5432, 'tcp', 'open')`,
+		`DELETE FROM hosts WHERE id = 1`,
+	} {
+		if _, err := s.DB.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var left []string
+	rows, err := s.DB.Query(`SELECT host_kind || ' ' || port FROM host_ports ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var row string
+		if err := rows.Scan(&row); err != nil {
+			t.Fatal(err)
+		}
+		left = append(left, row)
+	}
+	rows.Close()
+	if want := []string{"docker 5432"}; !reflect.DeepEqual(left, want) {
+		t.Errorf("host_ports after deleting the host = %v, want %v", left, want)
+	}
+}
+
+// TestMigrateBaseline upgrades a database written by the last release before migrations to the
+// latest schema and back down, checking that its rows survive both ways.
+func TestMigrateBaseline(t *testing.T) {
+	s := openFixture(t, "baseline.sql")
+	baseline := schema(t, s)
+
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := schemaVersion(t, s), latestVersion(t); got != want {
+		t.Fatalf("schema version = %d, want %d", got, want)
+	}
+
+	wantColumns := map[string][]string{
+		"hosts": {"id", "ip", "name", "os_details", "mac_address", "open_ports", "next_hop", "network_name", "interface_name",
+			"last_seen", "online_status", "os_accuracy", "os_guesses", "uptime_seconds", "last_boot", "distance", "address_family",
+			"last_scan_run_id", "device_id", "vendor", "mac_local_admin", "device_type", "device_confidence", "scan_profile"},
+		"docker_hosts": {"id", "container_id", "ip", "name", "os_details", "mac_address", "open_ports", "next_hop", "network_name",
+			"last_seen", "online_status", "last_scan_run_id", "device_type", "device_confidence", "engine", "runtime"},
+		"host_ports": {"id", "host_kind", "host_id", "port", "protocol", "state", "service", "product", "version", "extra_info",
+			"method", "first_seen", "last_seen"},
+		"docker_networks": {"id", "engine", "network_id", "name", "driver", "scope", "subnet", "gateway", "ipam_config", "internal",
+			"attachable", "bridge_name", "host_address", "last_seen", "last_scan_run_id"},
+		"scan_runs": {"id", "scan_type", "targets", "started_at", "finished_at", "status", "hosts_found", "hosts_updated", "error",
+			"version", "profile"},
+	}
+	for table, want := range wantColumns {
+		if got := columns(t, s, table); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s columns = %v, want %v", table, got, want)
+		}
+	}
+
+	// Existing rows keep their values and get the new columns' defaults
+	type hostRow struct {
+		IP, Name, Ports, Iface, Family string
+		LocalAdmin, Confidence         int
+	}
+	var hosts []hostRow
+	rows, err := s.DB.Query(`SELECT ip, name, open_ports, interface_name, address_family, mac_local_admin, device_confidence FROM hosts ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var h hostRow
+		if err := rows.Scan(&h.IP, &h.Name, &h.Ports, &h.Iface, &h.Family, &h.LocalAdmin, &h.Confidence); err != nil {
+			t.Fatal(err)
+		}
+		hosts = append(hosts, h)
+	}
+	rows.Close()
+	wantHosts := []hostRow{
+		{"192.168.1.1", "router", "22/tcp (ssh), 53/tcp (domain), 80/tcp (http)", "eth0", "ipv4", 0, 0},
+		{"192.168.1.10", "nas.lan", "22/tcp (ssh), 443/tcp (https)", "eth0", "ipv4", 0, 0},
+		{"10.0.0.7", "NoName", "Unknown", "unknown", "ipv4", 0, 0},
+	}
+	if !reflect.DeepEqual(hosts, wantHosts) {
+		t.Errorf("hosts = %+v, want %+v", hosts, wantHosts)
+	}
+
+	var engine, runtime string
+	var containers int
+	if err := s.DB.QueryRow(`SELECT COUNT(*), MIN(engine), MIN(runtime) FROM docker_hosts`).Scan(&containers, &engine, &runtime); err != nil {
+		t.Fatal(err)
+	}
+	if containers != 2 || engine != "local" || runtime != "docker" {
+		t.Errorf("docker_hosts: %d rows on engine %q runtime %q, want 2 on local docker", containers, engine, runtime)
+	}
+
+	// Rows only the new schema can hold: an IPv6 host, a container on a remote engine and their ports
+	for _, stmt := range []string{
+		`INSERT INTO hosts (ip, name, interface_name, address_family, os_accuracy) VALUES ('2001:db8::1', 'router', 'eth0', 'ipv6', 96)`,
+		`INSERT INTO docker_hosts (container_id, name, network_name, engine, runtime) VALUES ('c0ffee', 'db', 'bridge', 'nas', 'podman')`,
+		`INSERT INTO host_ports (host_kind, host_id, port, protocol, state) VALUES ('host', 1, 22, 'tcp', 'open')`,
+		`INSERT INTO host_ports (host_kind, host_id, port, protocol, state) SELECT 'docker', id, 5432, 'tcp', 'open' FROM docker_hosts WHERE engine = 'nas'`,
+		`INSERT INTO docker_networks (engine, network_id, name, driver) VALUES ('nas', 'abc123', 'podman', 'bridge')`,
+	} {
+		if _, err := s.DB.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.MigrateDown(1); err != nil {
+		t.Fatal(err)
+	}
+	if got := schemaVersion(t, s); got != 1 {
+		t.Fatalf("schema version after MigrateDown(1) = %d, want 1", got)
+	}
+	if got := schema(t, s); !reflect.DeepEqual(got, baseline) {
+		t.Errorf("schema after MigrateDown(1) =\n%v\nwant the baseline\n%v", got, baseline)
+	}
+	var names []string
+	rows, err = s.DB.Query(`SELECT name FROM hosts ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if want := []string{"router", "nas.lan", "NoName", "router"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("hosts after MigrateDown(1) = %v, want %v", names, want)
+	}
+	// Only the local engine's containers fit the baseline docker_hosts
+	if err := s.DB.QueryRow(`SELECT COUNT(*) FROM docker_hosts`).Scan(&containers); err != nil {
+		t.Fatal(err)
+	}
+	if containers != 2 {
+		t.Errorf("docker_hosts after MigrateDown(1) has %d rows, want the 2 local ones", containers)
+	}
+
+	// And back up again
+	if err := s.Migrate(); err != nil {
+		t.Fatalf("migrating up again: %v", err)
+	}
+	if got, want := schemaVersion(t, s), latestVersion(t); got != want {
+		t.Errorf("schema version = %d, want %d", got, want)
+	}
+}
+
+// TestMigrateLegacySchema adopts the oldest schema, whose hosts table has no interface_name.
+func TestMigrateLegacySchema(t *testing.T) {
+	s := openFixture(t, "legacy.sql")
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	states, err := s.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, st := range states {
+		if !st.Applied {
+			t.Errorf("migration %d_%s not applied", st.Version, st.Name)
+		}
+	}
+
+	// The column added to the legacy table comes last, like older releases added it
+	cols := columns(t, s, "hosts")
+	if i := strings.Join(cols, ","); !strings.HasPrefix(i, "id,ip,name,os_details,mac_address,open_ports,next_hop,network_name,last_seen,online_status,interface_name,") {
+		t.Errorf("hosts columns = %v, want interface_name after online_status", cols)
+	}
+	var unknown int
+	if err := s.DB.QueryRow(`SELECT COUNT(*) FROM hosts WHERE interface_name = 'unknown'`).Scan(&unknown); err != nil {
+		t.Fatal(err)
+	}
+	if unknown != 2 {
+		t.Errorf("%d hosts have interface_name 'unknown', want 2", unknown)
+	}
+	// The initial schema's missing tables and indexes were created
+	objects := schema(t, s)
+	for _, name := range []string{"external_networks", "logs", "idx_hosts_ip_interface", "idx_external_networks_ip"} {
+		if objects[name] == "" {
+			t.Errorf("%s was not created", name)
+		}
+	}
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS logs;
+DROP TABLE IF EXISTS external_networks;
+DROP TABLE IF EXISTS docker_hosts;
+DROP TABLE IF EXISTS hosts;
@@ -0,0 +1,5 @@
+ALTER TABLE hosts DROP COLUMN distance;
+ALTER TABLE hosts DROP COLUMN last_boot;
+ALTER TABLE hosts DROP COLUMN uptime_seconds;
+ALTER TABLE hosts DROP COLUMN os_guesses;
+ALTER TABLE hosts DROP COLUMN os_accuracy;
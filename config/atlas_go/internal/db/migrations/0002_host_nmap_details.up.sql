@@ -0,0 +1,6 @@
+-- Deep scan details decoded from nmap XML output (OS accuracy, alternative guesses, uptime, hop distance).
+ALTER TABLE hosts ADD COLUMN os_accuracy INTEGER;
+ALTER TABLE hosts ADD COLUMN os_guesses TEXT;
+ALTER TABLE hosts ADD COLUMN uptime_seconds INTEGER;
+ALTER TABLE hosts ADD COLUMN last_boot TEXT;
+ALTER TABLE hosts ADD COLUMN distance INTEGER;
@@ -0,0 +1,3 @@
+DROP VIEW IF EXISTS device_addresses;
+DROP INDEX IF EXISTS idx_hosts_mac;
+ALTER TABLE hosts DROP COLUMN address_family;
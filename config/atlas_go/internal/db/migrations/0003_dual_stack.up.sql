@@ -0,0 +1,16 @@
+-- Dual-stack devices show up as one hosts row per address; the MAC address links a device's
+-- IPv4 and IPv6 rows together.
+ALTER TABLE hosts ADD COLUMN address_family TEXT DEFAULT 'ipv4';
+
+CREATE INDEX IF NOT EXISTS idx_hosts_mac ON hosts(mac_address);
+
+CREATE VIEW IF NOT EXISTS device_addresses AS
+SELECT
+    mac_address,
+    interface_name,
+    group_concat(CASE WHEN address_family = 'ipv4' THEN ip END) AS ipv4_addresses,
+    group_concat(CASE WHEN address_family = 'ipv6' THEN ip END) AS ipv6_addresses,
+    MAX(last_seen) AS last_seen
+FROM hosts
+WHERE mac_address IS NOT NULL AND mac_address NOT IN ('', 'Unknown')
+GROUP BY mac_address, interface_name;
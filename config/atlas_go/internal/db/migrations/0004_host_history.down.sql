@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS host_events;
+DROP TABLE IF EXISTS host_snapshots;
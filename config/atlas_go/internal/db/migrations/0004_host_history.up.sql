@@ -0,0 +1,33 @@
+-- Append-only host history. Every scan writes a snapshot of each host it observed and one event
+-- per tracked field that changed; the hosts table itself keeps only the latest state.
+CREATE TABLE IF NOT EXISTS host_snapshots (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    host_id INTEGER,
+    ip TEXT,
+    interface_name TEXT,
+    name TEXT,
+    os_details TEXT,
+    mac_address TEXT,
+    open_ports TEXT,
+    online_status TEXT,
+    scan_type TEXT,
+    scan_run_id INTEGER,
+    observed_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS host_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    host_id INTEGER,
+    ip TEXT,
+    interface_name TEXT,
+    event_type TEXT NOT NULL,
+    old_value TEXT,
+    new_value TEXT,
+    scan_type TEXT,
+    scan_run_id INTEGER,
+    observed_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_host_snapshots_host ON host_snapshots(ip, interface_name, observed_at);
+CREATE INDEX IF NOT EXISTS idx_host_events_host ON host_events(ip, interface_name, observed_at);
+CREATE INDEX IF NOT EXISTS idx_host_events_type ON host_events(event_type, observed_at);
@@ -0,0 +1,3 @@
+ALTER TABLE docker_hosts DROP COLUMN last_scan_run_id;
+ALTER TABLE hosts DROP COLUMN last_scan_run_id;
+DROP TABLE IF EXISTS scan_runs;
@@ -0,0 +1,19 @@
+-- One row per fastscan/deepscan/dockerscan invocation. Host rows and history entries point at
+-- the run that last updated them.
+CREATE TABLE IF NOT EXISTS scan_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    scan_type TEXT NOT NULL,
+    targets TEXT,
+    started_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    finished_at DATETIME,
+    status TEXT DEFAULT 'running',
+    hosts_found INTEGER DEFAULT 0,
+    hosts_updated INTEGER DEFAULT 0,
+    error TEXT,
+    version TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_scan_runs_type ON scan_runs(scan_type, started_at);
+
+ALTER TABLE hosts ADD COLUMN last_scan_run_id INTEGER;
+ALTER TABLE docker_hosts ADD COLUMN last_scan_run_id INTEGER;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_hosts_device;
+ALTER TABLE hosts DROP COLUMN device_id;
+DROP TABLE IF EXISTS device_address_history;
+DROP TABLE IF EXISTS device_fingerprints;
+DROP TABLE IF EXISTS devices;
@@ -0,0 +1,33 @@
+-- Devices outlive addresses: hosts rows (one per ip/interface) point at the device they belong to,
+-- correlated by MAC address, then SSH/TLS key fingerprints, then hostname.
+CREATE TABLE IF NOT EXISTS devices (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    mac_address TEXT,
+    name TEXT,
+    first_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_seen DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_devices_mac ON devices(mac_address) WHERE mac_address IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_devices_name ON devices(name);
+
+CREATE TABLE IF NOT EXISTS device_fingerprints (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    device_id INTEGER NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    fingerprint TEXT NOT NULL UNIQUE,
+    first_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_seen DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS device_address_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    device_id INTEGER NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    ip TEXT NOT NULL,
+    interface_name TEXT,
+    first_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(device_id, ip, interface_name)
+);
+
+ALTER TABLE hosts ADD COLUMN device_id INTEGER;
+CREATE INDEX IF NOT EXISTS idx_hosts_device ON hosts(device_id);
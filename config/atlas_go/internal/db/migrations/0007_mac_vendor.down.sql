@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS oui_vendors;
+ALTER TABLE hosts DROP COLUMN mac_local_admin;
+ALTER TABLE hosts DROP COLUMN vendor;
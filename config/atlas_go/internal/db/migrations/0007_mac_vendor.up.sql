@@ -0,0 +1,10 @@
+-- Vendor of each host's MAC address (IEEE OUI lookup). mac_local_admin flags locally administered
+-- addresses (randomized, container or VM MACs) that carry no vendor.
+ALTER TABLE hosts ADD COLUMN vendor TEXT;
+ALTER TABLE hosts ADD COLUMN mac_local_admin INTEGER DEFAULT 0;
+
+-- Vendor prefixes loaded with `atlas oui update`; they take precedence over the built-in list.
+CREATE TABLE IF NOT EXISTS oui_vendors (
+    prefix TEXT PRIMARY KEY,
+    vendor TEXT NOT NULL
+);
@@ -0,0 +1,4 @@
+ALTER TABLE docker_hosts DROP COLUMN device_confidence;
+ALTER TABLE docker_hosts DROP COLUMN device_type;
+ALTER TABLE hosts DROP COLUMN device_confidence;
+ALTER TABLE hosts DROP COLUMN device_type;
@@ -0,0 +1,5 @@
+-- Device classification (router, printer, nas, ...) with a 0-100 confidence, see internal/classify.
+ALTER TABLE hosts ADD COLUMN device_type TEXT;
+ALTER TABLE hosts ADD COLUMN device_confidence INTEGER DEFAULT 0;
+ALTER TABLE docker_hosts ADD COLUMN device_type TEXT;
+ALTER TABLE docker_hosts ADD COLUMN device_confidence INTEGER DEFAULT 0;
@@ -0,0 +1,20 @@
+-- One row per port a scan has seen on a host. Ports that disappear are kept with state 'closed'
+-- so their first_seen survives a reopen. method is how the service was identified: "table" (nmap's
+-- guess from the port number), "probed" (nmap -sV) or "banner" (native banner grab).
+CREATE TABLE IF NOT EXISTS host_ports (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    host_id INTEGER NOT NULL REFERENCES hosts(id) ON DELETE CASCADE,
+    port INTEGER NOT NULL,
+    protocol TEXT NOT NULL,
+    state TEXT NOT NULL,
+    service TEXT,
+    product TEXT,
+    version TEXT,
+    extra_info TEXT,
+    method TEXT,
+    first_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(host_id, port, protocol)
+);
+
+CREATE INDEX IF NOT EXISTS idx_host_ports_port ON host_ports(port, protocol, state);
@@ -0,0 +1,26 @@
+DROP TRIGGER IF EXISTS host_ports_host_deleted;
+
+CREATE TABLE host_ports_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    host_id INTEGER NOT NULL REFERENCES hosts(id) ON DELETE CASCADE,
+    port INTEGER NOT NULL,
+    protocol TEXT NOT NULL,
+    state TEXT NOT NULL,
+    service TEXT,
+    product TEXT,
+    version TEXT,
+    extra_info TEXT,
+    method TEXT,
+    first_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(host_id, port, protocol)
+);
+
+INSERT INTO host_ports_old (id, host_id, port, protocol, state, service, product, version, extra_info, method, first_seen, last_seen)
+SELECT id, host_id, port, protocol, state, service, product, version, extra_info, method, first_seen, last_seen FROM host_ports
+WHERE host_kind = 'host';
+
+DROP TABLE host_ports;
+ALTER TABLE host_ports_old RENAME TO host_ports;
+
+CREATE INDEX IF NOT EXISTS idx_host_ports_port ON host_ports(port, protocol, state);
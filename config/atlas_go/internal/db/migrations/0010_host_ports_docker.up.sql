@@ -0,0 +1,34 @@
+-- host_ports also holds the ports of Docker containers: host_kind says whether host_id points at
+-- hosts ('host') or docker_hosts ('docker'). SQLite cannot change a UNIQUE constraint in place, so
+-- the table is rebuilt.
+CREATE TABLE host_ports_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    host_kind TEXT NOT NULL DEFAULT 'host',
+    host_id INTEGER NOT NULL,
+    port INTEGER NOT NULL,
+    protocol TEXT NOT NULL,
+    state TEXT NOT NULL,
+    service TEXT,
+    product TEXT,
+    version TEXT,
+    extra_info TEXT,
+    method TEXT,
+    first_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(host_kind, host_id, port, protocol)
+);
+
+INSERT INTO host_ports_new (id, host_kind, host_id, port, protocol, state, service, product, version, extra_info, method, first_seen, last_seen)
+SELECT id, 'host', host_id, port, protocol, state, service, product, version, extra_info, method, first_seen, last_seen FROM host_ports;
+
+DROP TABLE host_ports;
+ALTER TABLE host_ports_new RENAME TO host_ports;
+
+CREATE INDEX IF NOT EXISTS idx_host_ports_port ON host_ports(port, protocol, state);
+
+-- host_id can no longer reference hosts, so a trigger takes over the ON DELETE CASCADE of 0009.
+-- Container ports are dropped with their rows by PruneContainerPorts.
+CREATE TRIGGER IF NOT EXISTS host_ports_host_deleted AFTER DELETE ON hosts
+BEGIN
+    DELETE FROM host_ports WHERE host_kind = 'host' AND host_id = OLD.id;
+END;
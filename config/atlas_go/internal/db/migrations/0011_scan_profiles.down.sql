@@ -0,0 +1,2 @@
+ALTER TABLE hosts DROP COLUMN scan_profile;
+ALTER TABLE scan_runs DROP COLUMN profile;
@@ -0,0 +1,3 @@
+-- Deep scan profile (quick, standard, full, ...) of a run and of the deep scan that last stored a host.
+ALTER TABLE scan_runs ADD COLUMN profile TEXT;
+ALTER TABLE hosts ADD COLUMN scan_profile TEXT;
@@ -0,0 +1,29 @@
+-- Only the local engine's containers fit the old (container_id, network_name) key
+CREATE TABLE docker_hosts_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    container_id TEXT NOT NULL,
+    ip TEXT,
+    name TEXT,
+    os_details TEXT,
+    mac_address TEXT,
+    open_ports TEXT,
+    next_hop TEXT,
+    network_name TEXT,
+    last_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+    online_status TEXT DEFAULT 'online',
+    last_scan_run_id INTEGER,
+    device_type TEXT,
+    device_confidence INTEGER DEFAULT 0,
+    UNIQUE(container_id, network_name)
+);
+
+INSERT INTO docker_hosts_old (id, container_id, ip, name, os_details, mac_address, open_ports, next_hop, network_name, last_seen,
+    online_status, last_scan_run_id, device_type, device_confidence)
+SELECT id, container_id, ip, name, os_details, mac_address, open_ports, next_hop, network_name, last_seen,
+    online_status, last_scan_run_id, device_type, device_confidence FROM docker_hosts
+WHERE engine = 'local';
+
+DROP TABLE docker_hosts;
+ALTER TABLE docker_hosts_old RENAME TO docker_hosts;
+
+DELETE FROM host_ports WHERE host_kind = 'docker' AND host_id NOT IN (SELECT id FROM docker_hosts);
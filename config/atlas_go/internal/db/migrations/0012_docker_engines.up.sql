@@ -0,0 +1,29 @@
+-- docker_hosts rows carry the Docker engine they were read from, and container/network pairs are
+-- unique per engine. SQLite cannot change a UNIQUE constraint in place, so the table is rebuilt;
+-- ids are kept because host_ports points at them. engine is the last column for SELECT * readers.
+CREATE TABLE docker_hosts_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    container_id TEXT NOT NULL,
+    ip TEXT,
+    name TEXT,
+    os_details TEXT,
+    mac_address TEXT,
+    open_ports TEXT,
+    next_hop TEXT,
+    network_name TEXT,
+    last_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+    online_status TEXT DEFAULT 'online',
+    last_scan_run_id INTEGER,
+    device_type TEXT,
+    device_confidence INTEGER DEFAULT 0,
+    engine TEXT NOT NULL DEFAULT 'local',
+    UNIQUE(engine, container_id, network_name)
+);
+
+INSERT INTO docker_hosts_new (id, container_id, ip, name, os_details, mac_address, open_ports, next_hop, network_name, last_seen,
+    online_status, last_scan_run_id, device_type, device_confidence, engine)
+SELECT id, container_id, ip, name, os_details, mac_address, open_ports, next_hop, network_name, last_seen,
+    online_status, last_scan_run_id, device_type, device_confidence, 'local' FROM docker_hosts;
+
+DROP TABLE docker_hosts;
+ALTER TABLE docker_hosts_new RENAME TO docker_hosts;
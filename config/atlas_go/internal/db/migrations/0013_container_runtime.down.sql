@@ -0,0 +1 @@
+ALTER TABLE docker_hosts DROP COLUMN runtime;
@@ -0,0 +1,2 @@
+-- Container runtime (docker, podman or containerd) of the engine a row was read from
+ALTER TABLE docker_hosts ADD COLUMN runtime TEXT DEFAULT 'docker';
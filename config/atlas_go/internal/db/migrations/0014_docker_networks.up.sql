@@ -0,0 +1,21 @@
+-- Networks of every container engine. subnet and gateway are those of the first IPv4 pool;
+-- ipam_config holds all pools as JSON. host_address is the machine the engine runs on, which
+-- links a network into the topology.
+CREATE TABLE docker_networks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    engine TEXT NOT NULL DEFAULT 'local',
+    network_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    driver TEXT,
+    scope TEXT,
+    subnet TEXT,
+    gateway TEXT,
+    ipam_config TEXT,
+    internal INTEGER DEFAULT 0,
+    attachable INTEGER DEFAULT 0,
+    bridge_name TEXT,
+    host_address TEXT,
+    last_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_scan_run_id INTEGER,
+    UNIQUE(engine, network_id)
+);
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"fmt"
+
+	"atlas/internal/oui"
+)
+
+// LoadOUI returns the built-in vendor list overridden by the prefixes stored with ReplaceOUI.
+func (s *Store) LoadOUI() (*oui.DB, error) {
+	rows, err := s.DB.Query(`SELECT prefix, vendor FROM oui_vendors`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stored := make(map[string]string)
+	for rows.Next() {
+		var prefix, vendor string
+		if err := rows.Scan(&prefix, &vendor); err != nil {
+			return nil, err
+		}
+		stored[prefix] = vendor
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return oui.Embedded().Merge(oui.New(stored)), nil
+}
+
+// ReplaceOUI replaces the stored vendor prefixes with those of d in one transaction.
+func (s *Store) ReplaceOUI(d *oui.DB) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM oui_vendors`); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO oui_vendors (prefix, vendor) VALUES (?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, prefix := range d.Prefixes() {
+		if _, err := stmt.Exec(prefix, d.Vendor(prefix)); err != nil {
+			return fmt.Errorf("failed to store prefix %s: %v", prefix, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// UpdateHostVendors recomputes the vendor of every host with a known MAC, e.g. after new
+// prefixes were loaded. A host whose prefix d does not know keeps its vendor. It returns the
+// number of hosts given a vendor.
+func (s *Store) UpdateHostVendors(d *oui.DB) (int, error) {
+	rows, err := s.DB.Query(`SELECT id, mac_address FROM hosts WHERE mac_address IS NOT NULL AND mac_address NOT IN ('', 'Unknown')`)
+	if err != nil {
+		return 0, err
+	}
+	macs := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var mac string
+		if err := rows.Scan(&id, &mac); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		macs[id] = mac
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	updated := 0
+	for id, mac := range macs {
+		vendor := d.Lookup(mac)
+		if _, err := tx.Exec(`UPDATE hosts SET vendor = CASE WHEN ? != '' THEN ? ELSE vendor END, mac_local_admin = ? WHERE id = ?`,
+			vendor, vendor, oui.IsLocallyAdministered(mac), id); err != nil {
+			return 0, err
+		}
+		if vendor != "" {
+			updated++
+		}
+	}
+	return updated, tx.Commit()
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+
+	"atlas/internal/oui"
+)
+
+func TestUpdateHostVendors(t *testing.T) {
+	s := openFixture(t, "")
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := s.DB.Exec(`INSERT INTO hosts (ip, interface_name, mac_address, vendor, mac_local_admin) VALUES
+		('192.168.1.2', 'eth0', '00:0c:29:ab:cd:ef', 'VMware', 0),
+		('192.168.1.3', 'eth0', 'b8:27:eb:00:00:01', '', 0),
+		('192.168.1.4', 'eth0', 'a4:5e:60:00:00:01', 'Apple', 0),
+		('192.168.1.5', 'eth0', '02:42:ac:11:00:02', '', 0),
+		('192.168.1.6', 'eth0', 'Unknown', 'Stale', 0)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a4:5e:60 is not in the new list, so the host keeps the vendor it had
+	n, err := s.UpdateHostVendors(oui.New(map[string]string{"000C29": "VMware, Inc.", "B827EB": "Raspberry Pi Foundation"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("UpdateHostVendors updated %d hosts, want 2", n)
+	}
+
+	rows, err := s.DB.Query(`SELECT ip || ' | ' || vendor || ' | ' || mac_local_admin FROM hosts ORDER BY ip`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var row string
+		if err := rows.Scan(&row); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, row)
+	}
+	want := []string{
+		"192.168.1.2 | VMware, Inc. | 0",
+		"192.168.1.3 | Raspberry Pi Foundation | 0",
+		"192.168.1.4 | Apple | 0",
+		"192.168.1.5 |  | 1",
+		"192.168.1.6 | Stale | 0",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("hosts = %q, want %q", got, want)
+	}
+}
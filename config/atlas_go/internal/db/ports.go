@@ -0,0 +1,141 @@
+package db
+
+import "fmt"
+
+// Kinds of host_ports owner: HostID points at hosts or at docker_hosts.
+const (
+	PortsOfHost      = "host"
+	PortsOfContainer = "docker"
+)
+
+// HostPort is one row of host_ports.
+type HostPort struct {
+	HostKind  string
+	HostID    int64
+	Port      int
+	Protocol  string
+	State     string
+	Service   string
+	Product   string
+	Version   string
+	ExtraInfo string
+	Method    string
+	FirstSeen string
+	LastSeen  string
+}
+
+// SyncHostPorts records the result of scanning protocols (e.g. "tcp") on a host of the given kind
+// (PortsOfHost or PortsOfContainer). Listed ports are inserted or refreshed; ports of those
+// protocols the host had before but the scan did not list are marked closed. Only call it with a
+// complete result: a scan that failed knows nothing about the missing ports.
+func SyncHostPorts(q DBTX, kind string, hostID int64, protocols []string, ports []HostPort) error {
+	seen := make(map[string]bool)
+	for _, p := range ports {
+		seen[fmt.Sprintf("%d/%s", p.Port, p.Protocol)] = true
+		if _, err := q.Exec(`
+			INSERT INTO host_ports (host_kind, host_id, port, protocol, state, service, product, version, extra_info, method)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(host_kind, host_id, port, protocol) DO UPDATE SET
+				state=excluded.state,
+				service=excluded.service,
+				product=excluded.product,
+				version=excluded.version,
+				extra_info=excluded.extra_info,
+				method=excluded.method,
+				last_seen=CURRENT_TIMESTAMP
+		`, kind, hostID, p.Port, p.Protocol, p.State, p.Service, p.Product, p.Version, p.ExtraInfo, p.Method); err != nil {
+			return fmt.Errorf("failed to write port %d/%s: %v", p.Port, p.Protocol, err)
+		}
+	}
+
+	scanned := make(map[string]bool)
+	for _, proto := range protocols {
+		scanned[proto] = true
+	}
+	current, err := loadHostPorts(q, kind, hostID)
+	if err != nil {
+		return err
+	}
+	for _, p := range current {
+		if p.State == "closed" || !scanned[p.Protocol] || seen[fmt.Sprintf("%d/%s", p.Port, p.Protocol)] {
+			continue
+		}
+		if _, err := q.Exec(`UPDATE host_ports SET state = 'closed' WHERE host_kind = ? AND host_id = ? AND port = ? AND protocol = ?`,
+			kind, hostID, p.Port, p.Protocol); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HostPorts returns the ports recorded for a host of the given kind (including closed ones), ordered
+// by protocol and port.
+func (s *Store) HostPorts(kind string, hostID int64) ([]HostPort, error) {
+	return loadHostPorts(s.DB, kind, hostID)
+}
+
+func loadHostPorts(q DBTX, kind string, hostID int64) ([]HostPort, error) {
+	return queryPorts(q, `WHERE host_kind = ? AND host_id = ? ORDER BY protocol, port`, kind, hostID)
+}
+
+// OpenPort is an open port together with the address of the host or container it belongs to.
+type OpenPort struct {
+	HostPort
+	IP            string
+	Name          string
+	InterfaceName string // interface of a host, Docker network of a container
+}
+
+// PortsOpen returns every host and container with port/protocol open, e.g. all hosts with 445/tcp.
+func (s *Store) PortsOpen(port int, protocol string) ([]OpenPort, error) {
+	rows, err := s.DB.Query(`SELECT p.host_kind, p.host_id, p.port, p.protocol, p.state, COALESCE(p.service, ''),
+		COALESCE(p.product, ''), COALESCE(p.version, ''), COALESCE(p.extra_info, ''), COALESCE(p.method, ''),
+		COALESCE(p.first_seen, ''), COALESCE(p.last_seen, ''),
+		COALESCE(h.ip, d.ip, ''), COALESCE(h.name, d.name, ''), COALESCE(h.interface_name, d.network_name, '')
+		FROM host_ports p
+		LEFT JOIN hosts h ON p.host_kind = 'host' AND h.id = p.host_id
+		LEFT JOIN docker_hosts d ON p.host_kind = 'docker' AND d.id = p.host_id
+		WHERE p.port = ? AND p.protocol = ? AND p.state = 'open'
+		ORDER BY p.host_kind, p.host_id`, port, protocol)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var open []OpenPort
+	for rows.Next() {
+		var o OpenPort
+		p := &o.HostPort
+		if err := rows.Scan(&p.HostKind, &p.HostID, &p.Port, &p.Protocol, &p.State, &p.Service, &p.Product, &p.Version,
+			&p.ExtraInfo, &p.Method, &p.FirstSeen, &p.LastSeen, &o.IP, &o.Name, &o.InterfaceName); err != nil {
+			return nil, err
+		}
+		open = append(open, o)
+	}
+	return open, rows.Err()
+}
+
+// PruneContainerPorts drops the ports of containers whose docker_hosts row no longer exists.
+func PruneContainerPorts(q DBTX) error {
+	_, err := q.Exec(`DELETE FROM host_ports WHERE host_kind = ? AND host_id NOT IN (SELECT id FROM docker_hosts)`, PortsOfContainer)
+	return err
+}
+
+func queryPorts(q DBTX, where string, args ...any) ([]HostPort, error) {
+	rows, err := q.Query(`SELECT host_kind, host_id, port, protocol, state, COALESCE(service, ''), COALESCE(product, ''),
+		COALESCE(version, ''), COALESCE(extra_info, ''), COALESCE(method, ''), COALESCE(first_seen, ''), COALESCE(last_seen, '')
+		FROM host_ports `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ports []HostPort
+	for rows.Next() {
+		var p HostPort
+		if err := rows.Scan(&p.HostKind, &p.HostID, &p.Port, &p.Protocol, &p.State, &p.Service, &p.Product, &p.Version,
+			&p.ExtraInfo, &p.Method, &p.FirstSeen, &p.LastSeen); err != nil {
+			return nil, err
+		}
+		ports = append(ports, p)
+	}
+	return ports, rows.Err()
+}
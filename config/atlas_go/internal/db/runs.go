@@ -0,0 +1,115 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Scan run statuses.
+const (
+	RunRunning   = "running"
+	RunSuccess   = "success"
+	RunFailed    = "failed"
+	RunCancelled = "cancelled"
+)
+
+// ScanRun is a row of scan_runs.
+type ScanRun struct {
+	ID           int64
+	Type         string
+	Targets      []string
+	StartedAt    string
+	FinishedAt   string
+	Status       string
+	HostsFound   int
+	HostsUpdated int
+	Error        string
+	Version      string
+	Profile      string // deep scan profile, empty for other scans
+}
+
+// RunIDValue returns the run id for SQL parameters (NULL when the run is unknown).
+func (r ScanRef) RunIDValue() sql.NullInt64 {
+	return sql.NullInt64{Int64: r.RunID, Valid: r.RunID > 0}
+}
+
+// StartRun inserts a running scan_runs row and returns its id.
+func (s *Store) StartRun(scanType, version string) (int64, error) {
+	res, err := s.DB.Exec(`INSERT INTO scan_runs (scan_type, status, version) VALUES (?, ?, ?)`, scanType, RunRunning, version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record scan run: %v", err)
+	}
+	return res.LastInsertId()
+}
+
+// FinishRun stores the outcome of run.ID and stamps finished_at.
+func (s *Store) FinishRun(run ScanRun) error {
+	_, err := s.DB.Exec(`
+		UPDATE scan_runs
+		SET finished_at = CURRENT_TIMESTAMP, status = ?, targets = ?, hosts_found = ?, hosts_updated = ?, error = ?, profile = ?
+		WHERE id = ?
+	`, run.Status, strings.Join(run.Targets, ","), run.HostsFound, run.HostsUpdated, run.Error, nullString(run.Profile), run.ID)
+	if err != nil {
+		return fmt.Errorf("failed to finish scan run %d: %v", run.ID, err)
+	}
+	return nil
+}
+
+const scanRunColumns = `id, scan_type, COALESCE(targets, ''), COALESCE(started_at, ''), COALESCE(finished_at, ''), COALESCE(status, ''),
+	COALESCE(hosts_found, 0), COALESCE(hosts_updated, 0), COALESCE(error, ''), COALESCE(version, ''),
+	COALESCE(profile, '')`
+
+func scanScanRun(row interface{ Scan(...any) error }) (ScanRun, error) {
+	var r ScanRun
+	var targets string
+	err := row.Scan(&r.ID, &r.Type, &targets, &r.StartedAt, &r.FinishedAt, &r.Status, &r.HostsFound, &r.HostsUpdated, &r.Error, &r.Version, &r.Profile)
+	if targets != "" {
+		r.Targets = strings.Split(targets, ",")
+	}
+	return r, err
+}
+
+// ListRuns returns the most recent runs, newest first. scanType filters by type when not empty.
+func (s *Store) ListRuns(scanType string, limit int) ([]ScanRun, error) {
+	query := `SELECT ` + scanRunColumns + ` FROM scan_runs`
+	var args []any
+	if scanType != "" {
+		query += ` WHERE scan_type = ?`
+		args = append(args, scanType)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var runs []ScanRun
+	for rows.Next() {
+		r, err := scanScanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// GetRun returns the run with the given id, or nil if there is none.
+func (s *Store) GetRun(id int64) (*ScanRun, error) {
+	r, err := scanScanRun(s.DB.QueryRow(`SELECT `+scanRunColumns+` FROM scan_runs WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// RunEvents returns the host events recorded by a run, in order.
+func (s *Store) RunEvents(id int64) ([]HostEvent, error) {
+	return s.queryEvents(`WHERE scan_run_id = ?`, id)
+}
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// DefaultPath is the database location inside the container; override it with --db or ATLAS_DB_PATH.
+const DefaultPath = "/config/db/atlas.db"
+
+// busyTimeout is how long a write waits for another process's write to finish (dockerwatch runs
+// next to the scheduled scans) before failing with "database is locked".
+const busyTimeout = 30 * time.Second
+
+// Store is the process-wide handle on the Atlas database. main opens it once and hands it to
+// every command, so scanners never open their own connections.
+type Store struct {
+	DB   *sql.DB
+	Path string
+}
+
+// Open opens (creating if needed) the SQLite database at path.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create DB dir: %v", err)
+	}
+	// Transactions take the write lock when they begin, so they wait for busyTimeout instead of
+	// failing when a read inside them is upgraded to a write.
+	db, err := sql.Open("sqlite3", fmt.Sprintf("%s?_busy_timeout=%d&_txlock=immediate", path, busyTimeout.Milliseconds()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open DB: %v", err)
+	}
+	// SQLite allows one writer at a time; a single connection serialises writers inside the
+	// process instead of failing with "database is locked".
+	db.SetMaxOpenConns(1)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open DB %s: %v", path, err)
+	}
+	return &Store{DB: db, Path: path}, nil
+}
+
+func (s *Store) Close() error {
+	return s.DB.Close()
+}
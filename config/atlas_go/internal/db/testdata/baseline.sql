@@ -0,0 +1,62 @@
+-- Schema and rows of a database written by the releases before numbered migrations (InitDB).
+CREATE TABLE IF NOT EXISTS hosts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    ip TEXT,
+    name TEXT,
+    os_details TEXT,
+    mac_address TEXT,
+    open_ports TEXT,
+    next_hop TEXT,
+    network_name TEXT,
+    interface_name TEXT,
+    last_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+    online_status TEXT DEFAULT 'online'
+);
+
+CREATE TABLE IF NOT EXISTS docker_hosts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    container_id TEXT NOT NULL,
+    ip TEXT,
+    name TEXT,
+    os_details TEXT,
+    mac_address TEXT,
+    open_ports TEXT,
+    next_hop TEXT,
+    network_name TEXT,
+    last_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+    online_status TEXT DEFAULT 'online',
+    UNIQUE(container_id, network_name)
+);
+
+CREATE TABLE IF NOT EXISTS external_networks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	public_ip TEXT UNIQUE,
+	provider TEXT,
+	location TEXT,
+	last_seen DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS logs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    log_type TEXT NOT NULL,
+    content TEXT,
+    timestamp DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_hosts_ip_interface ON hosts(ip, interface_name);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_external_networks_ip ON external_networks(public_ip);
+
+INSERT INTO hosts (ip, name, os_details, mac_address, open_ports, next_hop, network_name, interface_name, last_seen, online_status) VALUES
+    ('192.168.1.1', 'router', 'Linux 4.15 - 5.8', '00:11:32:AA:BB:CC', '22/tcp (ssh), 53/tcp (domain), 80/tcp (http)', NULL, '192.168.1.0/24', 'eth0', '2025-06-01 10:00:00', 'online'),
+    ('192.168.1.10', 'nas.lan', 'Linux 5.0 - 5.14', '52:54:00:12:34:56', '22/tcp (ssh), 443/tcp (https)', '192.168.1.1', '192.168.1.0/24', 'eth0', '2025-06-01 10:00:05', 'online'),
+    ('10.0.0.7', 'NoName', 'Unknown', 'Unknown', 'Unknown', NULL, '10.0.0.0/24', 'unknown', '2025-05-20 08:30:00', 'offline');
+
+INSERT INTO docker_hosts (container_id, ip, name, os_details, mac_address, open_ports, next_hop, network_name, last_seen, online_status) VALUES
+    ('8d2a7c0e5b1f', '172.17.0.2', 'web', 'nginx:1.25', '02:42:ac:11:00:02', '80/tcp', '172.17.0.1', 'bridge', '2025-06-01 10:01:00', 'running'),
+    ('1b3d5f7a9c2e', '', 'backup', 'restic/restic:0.16.4', '', 'Unknown', '', 'bridge', '2025-06-01 10:01:00', 'exited');
+
+INSERT INTO external_networks (public_ip, provider, location, last_seen) VALUES
+    ('203.0.113.45', 'Example ISP', 'Amsterdam, NL', '2025-06-01 10:00:10');
+
+INSERT INTO logs (log_type, content, timestamp) VALUES
+    ('fastscan', 'Found 3 hosts', '2025-06-01 10:00:15');
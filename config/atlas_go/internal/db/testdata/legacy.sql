@@ -0,0 +1,32 @@
+-- The oldest released schema: hosts has no interface_name (and so no idx_hosts_ip_interface).
+CREATE TABLE hosts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    ip TEXT,
+    name TEXT,
+    os_details TEXT,
+    mac_address TEXT,
+    open_ports TEXT,
+    next_hop TEXT,
+    network_name TEXT,
+    last_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+    online_status TEXT DEFAULT 'online'
+);
+
+CREATE TABLE docker_hosts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    container_id TEXT NOT NULL,
+    ip TEXT,
+    name TEXT,
+    os_details TEXT,
+    mac_address TEXT,
+    open_ports TEXT,
+    next_hop TEXT,
+    network_name TEXT,
+    last_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+    online_status TEXT DEFAULT 'online',
+    UNIQUE(container_id, network_name)
+);
+
+INSERT INTO hosts (ip, name, os_details, mac_address, open_ports, next_hop, network_name, last_seen, online_status) VALUES
+    ('192.168.1.1', 'router', 'Linux 4.15 - 5.8', '00:11:32:AA:BB:CC', '80/tcp (http)', NULL, '192.168.1.0/24', '2024-11-02 18:00:00', 'online'),
+    ('192.168.1.20', 'printer', 'Unknown', '00:1B:A9:01:02:03', '9100/tcp (jetdirect)', NULL, '192.168.1.0/24', '2024-11-02 18:00:02', 'online');
@@ -0,0 +1,280 @@
+// Package docker is a small client for the Docker Engine API. It covers the calls the Docker scan
+// needs and talks to the daemon over its unix socket or over TCP, optionally with TLS, the way the
+// docker CLI does.
+package docker
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"atlas/internal/utils"
+)
+
+// DefaultHost is the daemon address used when DOCKER_HOST is not set.
+const DefaultHost = "unix:///var/run/docker.sock"
+
+// Client talks to one Docker Engine.
+type Client struct {
+	Name string // engine name recorded with its containers
+	Host string // daemon address as given, e.g. unix:///var/run/docker.sock or tcp://10.0.0.5:2376
+
+	http    *http.Client
+	baseURL string
+}
+
+// TLSConfig holds the client certificate and CA of a TLS-protected daemon, the files the docker
+// CLI reads from DOCKER_CERT_PATH.
+type TLSConfig struct {
+	CAFile   string `yaml:"ca"`
+	CertFile string `yaml:"cert"`
+	KeyFile  string `yaml:"key"`
+	// Verify checks the daemon's certificate against CAFile; unset, it is checked when CAFile is given
+	Verify *bool `yaml:"verify"`
+}
+
+// verify reports whether the daemon's certificate is checked.
+func (t *TLSConfig) verify() bool {
+	if t.Verify != nil {
+		return *t.Verify
+	}
+	return t.CAFile != ""
+}
+
+// ClientOptions configure how NewClient reaches a daemon.
+type ClientOptions struct {
+	TLS *TLSConfig // enables TLS for TCP hosts; may be nil
+	// Runtime is the engine's runtime, docker (default) or podman; it picks the command an
+	// ssh:// host runs on the remote side
+	Runtime string
+	// SSHConnectTimeout bounds establishing the ssh connection of an ssh:// host; 0 is ssh's default
+	SSHConnectTimeout time.Duration
+	// Dial starts the ssh command of an ssh:// host; nil runs it with utils.ExecRunner
+	Dial DialCommand
+}
+
+// NewClientFromEnv returns a client for the LocalEngine of EnvEngine.
+func NewClientFromEnv() (*Client, error) {
+	return NewEngineClient(EnvEngine(), nil)
+}
+
+// NewClient returns a client for host: unix:///path/to.sock, tcp://addr:port, https://addr:port or
+// ssh://[user@]host[:port].
+func NewClient(host string, opts ClientOptions) (*Client, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid docker host %q: %v", host, err)
+	}
+	transport := &http.Transport{IdleConnTimeout: 30 * time.Second}
+	c := &Client{Host: host}
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+		// The host part is ignored when dialing the socket
+		c.baseURL = "http://docker"
+	case "tcp", "http", "https":
+		scheme := "http"
+		if opts.TLS != nil || u.Scheme == "https" {
+			scheme = "https"
+			cfg, err := opts.TLS.clientConfig()
+			if err != nil {
+				return nil, err
+			}
+			transport.TLSClientConfig = cfg
+			if cfg.InsecureSkipVerify {
+				fmt.Printf("⚠️ Not verifying the TLS certificate of Docker engine %s\n", host)
+			}
+		}
+		c.baseURL = scheme + "://" + u.Host
+	case "ssh":
+		if opts.Dial == nil {
+			opts.Dial = utils.ExecRunner{}.Conn
+		}
+		transport.DialContext = dialSSH(u, opts)
+		c.baseURL = "http://docker"
+	default:
+		return nil, fmt.Errorf("unsupported docker host %q (expected unix://, tcp://, https:// or ssh://)", host)
+	}
+	c.http = &http.Client{Transport: transport}
+	return c, nil
+}
+
+// clientConfig loads the certificates of t. A nil t gives a default TLS configuration.
+func (t *TLSConfig) clientConfig() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if t == nil {
+		return cfg, nil
+	}
+	if t.CertFile != "" && t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load docker client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil && t.verify() {
+			return nil, fmt.Errorf("failed to read docker CA: %v", err)
+		}
+		if err == nil {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates in %s", t.CAFile)
+			}
+			cfg.RootCAs = pool
+		}
+	}
+	cfg.InsecureSkipVerify = !t.verify()
+	return cfg, nil
+}
+
+// RemoteHost returns the machine a tcp://, https:// or ssh:// engine runs on, or "" for a local
+// socket.
+func (c *Client) RemoteHost() string {
+	u, err := url.Parse(c.Host)
+	if err != nil || u.Scheme == "unix" {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// get sends a GET for path and decodes the JSON response into v.
+func (c *Client) get(ctx context.Context, path string, query url.Values, v any) error {
+	resp, err := c.do(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s: %v", path, err)
+	}
+	return nil
+}
+
+// do sends a GET for path and returns the response if it succeeded. The caller closes the body.
+func (c *Client) do(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("docker API %s: %v", c.Host, err)
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, apiError(path, resp)
+	}
+	return resp, nil
+}
+
+// APIError is a failed Engine API call.
+type APIError struct {
+	Path       string
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("docker API %s: %d %s: %s", e.Path, e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// IsNotFound reports whether err is the daemon saying the object does not exist, e.g. a container
+// removed between listing and inspecting it.
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// apiError turns a failed response into an error carrying the daemon's message.
+func apiError(path string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var msg struct {
+		Message string `json:"message"`
+	}
+	text := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &msg) == nil && msg.Message != "" {
+		text = msg.Message
+	}
+	return &APIError{Path: path, StatusCode: resp.StatusCode, Message: text}
+}
+
+// Ping checks that the daemon answers.
+func (c *Client) Ping(ctx context.Context) error {
+	resp, err := c.do(ctx, "/_ping", nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// ContainerList returns the containers of the engine, stopped ones included when all is set.
+func (c *Client) ContainerList(ctx context.Context, all bool) ([]ContainerSummary, error) {
+	query := url.Values{}
+	if all {
+		query.Set("all", "1")
+	}
+	var list []ContainerSummary
+	err := c.get(ctx, "/containers/json", query, &list)
+	return list, err
+}
+
+// ContainerInspect returns the details of container id.
+func (c *Client) ContainerInspect(ctx context.Context, id string) (Container, error) {
+	var ctr Container
+	err := c.get(ctx, "/containers/"+url.PathEscape(id)+"/json", nil, &ctr)
+	return ctr, err
+}
+
+// NetworkList returns the networks of the engine.
+func (c *Client) NetworkList(ctx context.Context) ([]Network, error) {
+	var list []Network
+	err := c.get(ctx, "/networks", nil, &list)
+	return list, err
+}
+
+// Version is the response of GET /version.
+type Version struct {
+	Version    string `json:"Version"`
+	APIVersion string `json:"ApiVersion"`
+	Components []struct {
+		Name    string `json:"Name"`
+		Version string `json:"Version"`
+	} `json:"Components"`
+}
+
+// IsPodman reports whether the engine is Podman serving its Docker-compatible API.
+func (v Version) IsPodman() bool {
+	for _, c := range v.Components {
+		if strings.Contains(c.Name, "Podman") {
+			return true
+		}
+	}
+	return false
+}
+
+// Version returns the engine's version information.
+func (c *Client) Version(ctx context.Context) (Version, error) {
+	var v Version
+	err := c.get(ctx, "/version", nil, &v)
+	return v, err
+}
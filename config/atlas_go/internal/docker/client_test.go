@@ -0,0 +1,501 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	webID    = "8d2a7c0e5b1f4a3c9e6d2b8f7a1c3e5d9b2f4a6c8e0d1b3f5a7c9e2d4b6f8a0c"
+	backupID = "1b3d5f7a9c2e4b6d8f0a1c3e5b7d9f2a4c6e8b0d1f3a5c7e9b2d4f6a8c0e1b3d"
+)
+
+// fakeEngine serves the Engine API responses recorded under testdata/engine.
+type fakeEngine struct {
+	runtime string // docker or podman, picks the recorded /version
+
+	mu       sync.Mutex
+	requests []string // path and query of every request
+}
+
+func (f *fakeEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests = append(f.requests, r.URL.RequestURI())
+	f.mu.Unlock()
+
+	path := r.URL.Path
+	switch {
+	case path == "/_ping":
+		w.Write([]byte("OK"))
+	case path == "/containers/json":
+		var list []map[string]any
+		readRecorded(w, "containers.json", &list)
+		if r.URL.Query().Get("all") != "1" {
+			var running []map[string]any
+			for _, c := range list {
+				if c["State"] == "running" {
+					running = append(running, c)
+				}
+			}
+			list = running
+		}
+		json.NewEncoder(w).Encode(list)
+	case path == "/networks":
+		serveRecorded(w, "networks.json")
+	case path == "/version":
+		serveRecorded(w, "version_"+f.runtime+".json")
+	case path == "/containers/broken/json":
+		http.Error(w, "driver failed programming external connectivity", http.StatusInternalServerError)
+	case strings.HasPrefix(path, "/containers/") && strings.HasSuffix(path, "/json"):
+		id := strings.TrimSuffix(strings.TrimPrefix(path, "/containers/"), "/json")
+		if _, err := os.Stat(recordedPath("container_" + id + ".json")); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"No such container: ` + id + `"}` + "\n"))
+			return
+		}
+		serveRecorded(w, "container_"+id+".json")
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeEngine) seen() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.requests...)
+}
+
+func recordedPath(name string) string {
+	return filepath.Join("testdata", "engine", name)
+}
+
+func serveRecorded(w http.ResponseWriter, name string) {
+	data, err := os.ReadFile(recordedPath(name))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func readRecorded(w http.ResponseWriter, name string, v any) {
+	data, err := os.ReadFile(recordedPath(name))
+	if err == nil {
+		err = json.Unmarshal(data, v)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// startFakeEngine serves f on a unix socket and returns its path.
+func startFakeEngine(t *testing.T, f *fakeEngine) string {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(f)
+	srv.Listener.Close()
+	srv.Listener = ln
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return socket
+}
+
+func newFakeClient(t *testing.T, runtime string) (*Client, *fakeEngine) {
+	t.Helper()
+	f := &fakeEngine{runtime: runtime}
+	c, err := NewClient("unix://"+startFakeEngine(t, f), ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, f
+}
+
+func TestClientPing(t *testing.T) {
+	c, _ := newFakeClient(t, "docker")
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if got := c.RemoteHost(); got != "" {
+		t.Errorf("RemoteHost() = %q, want none for a unix socket", got)
+	}
+}
+
+func TestClientContainerList(t *testing.T) {
+	c, f := newFakeClient(t, "docker")
+	ctx := context.Background()
+
+	all, err := c.ContainerList(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ContainerSummary{
+		{ID: webID, Names: []string{"/web"}, Image: "nginx:1.25", State: "running", Status: "Up 3 hours"},
+		{ID: backupID, Names: []string{"/backup"}, Image: "restic/restic:0.16.4", State: "exited", Status: "Exited (0) 2 hours ago"},
+	}
+	if !reflect.DeepEqual(all, want) {
+		t.Errorf("ContainerList(all) = %+v, want %+v", all, want)
+	}
+
+	running, err := c.ContainerList(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(running) != 1 || running[0].ID != webID {
+		t.Errorf("ContainerList(running) = %+v, want only web", running)
+	}
+	if got, want := f.seen(), []string{"/containers/json?all=1", "/containers/json"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %v, want %v", got, want)
+	}
+}
+
+func TestClientContainerInspect(t *testing.T) {
+	c, _ := newFakeClient(t, "docker")
+	ctx := context.Background()
+
+	web, err := c.ContainerInspect(ctx, webID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if web.Name != "/web" || !web.State.Running || web.State.Status != "running" {
+		t.Errorf("web = %q %+v, want a running /web", web.Name, web.State)
+	}
+	if web.Config.Image != "nginx:1.25" || web.Config.Labels["com.docker.compose.service"] != "web" {
+		t.Errorf("web config = %+v", web.Config)
+	}
+	wantPorts := map[string][]PortBinding{
+		"443/tcp": nil,
+		"80/tcp":  {{HostIP: "0.0.0.0", HostPort: "8080"}, {HostIP: "::", HostPort: "8080"}},
+	}
+	if !reflect.DeepEqual(web.NetworkSettings.Ports, wantPorts) {
+		t.Errorf("web ports = %+v, want %+v", web.NetworkSettings.Ports, wantPorts)
+	}
+	site := web.NetworkSettings.Networks["site_default"]
+	wantSite := EndpointSettings{
+		NetworkID:         "f1e2d3c4b5a69788796a5b4c3d2e1f00112233445566778899aabbccddeeff00",
+		IPAddress:         "172.20.0.5",
+		IPPrefixLen:       16,
+		Gateway:           "172.20.0.1",
+		GlobalIPv6Address: "fd00:20::5",
+		MacAddress:        "02:42:ac:14:00:05",
+	}
+	if site != wantSite {
+		t.Errorf("site_default endpoint = %+v, want %+v", site, wantSite)
+	}
+
+	backup, err := c.ContainerInspect(ctx, backupID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backup.State.Running || backup.State.Status != "exited" || backup.Config.Labels != nil {
+		t.Errorf("backup = %+v, want an exited container without labels", backup)
+	}
+	if ep := backup.NetworkSettings.Networks["bridge"]; ep.IPAddress != "" {
+		t.Errorf("stopped container has address %q", ep.IPAddress)
+	}
+}
+
+func TestClientAPIErrors(t *testing.T) {
+	c, _ := newFakeClient(t, "docker")
+	ctx := context.Background()
+
+	_, err := c.ContainerInspect(ctx, "gone")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("ContainerInspect(gone) error = %v, want an *APIError", err)
+	}
+	if apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "No such container: gone" || apiErr.Path != "/containers/gone/json" {
+		t.Errorf("APIError = %+v", apiErr)
+	}
+	if !IsNotFound(err) {
+		t.Errorf("IsNotFound(%v) = false", err)
+	}
+	if want := "docker API /containers/gone/json: 404 Not Found: No such container: gone"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+
+	// A body that is not JSON is kept as the message
+	_, err = c.ContainerInspect(ctx, "broken")
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError || apiErr.Message != "driver failed programming external connectivity" {
+		t.Errorf("ContainerInspect(broken) error = %v", err)
+	}
+	if IsNotFound(err) {
+		t.Errorf("IsNotFound(%v) = true for a server error", err)
+	}
+	if IsNotFound(errors.New("404")) || IsNotFound(nil) {
+		t.Error("IsNotFound matched an error that is not an APIError")
+	}
+}
+
+func TestClientNetworkList(t *testing.T) {
+	c, _ := newFakeClient(t, "docker")
+	networks, err := c.NetworkList(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(networks) != 3 {
+		t.Fatalf("NetworkList() returned %d networks, want 3", len(networks))
+	}
+	tests := []struct {
+		name    string
+		bridge  string
+		subnets []string
+	}{
+		{"bridge", "docker0", []string{"172.17.0.0/16"}},
+		{"site_default", "br-f1e2d3c4b5a6", []string{"172.20.0.0/16", "fd00:20::/64"}},
+		{"host", "", nil},
+	}
+	for i, tt := range tests {
+		n := networks[i]
+		if n.Name != tt.name {
+			t.Errorf("network %d = %s, want %s", i, n.Name, tt.name)
+			continue
+		}
+		if got := n.BridgeName(); got != tt.bridge {
+			t.Errorf("%s: BridgeName() = %q, want %q", tt.name, got, tt.bridge)
+		}
+		var subnets []string
+		for _, cfg := range n.IPAM.Config {
+			subnets = append(subnets, cfg.Subnet)
+		}
+		if !reflect.DeepEqual(subnets, tt.subnets) {
+			t.Errorf("%s: subnets = %v, want %v", tt.name, subnets, tt.subnets)
+		}
+	}
+}
+
+func TestClientVersion(t *testing.T) {
+	tests := []struct {
+		runtime string
+		version string
+		podman  bool
+	}{
+		{"docker", "27.3.1", false},
+		{"podman", "5.2.3", true},
+	}
+	for _, tt := range tests {
+		c, _ := newFakeClient(t, tt.runtime)
+		v, err := c.Version(context.Background())
+		if err != nil {
+			t.Fatalf("%s: %v", tt.runtime, err)
+		}
+		if v.Version != tt.version || v.IsPodman() != tt.podman {
+			t.Errorf("%s: Version() = %s, IsPodman() = %v, want %s, %v", tt.runtime, v.Version, v.IsPodman(), tt.version, tt.podman)
+		}
+	}
+}
+
+func TestClientUnreachable(t *testing.T) {
+	c, err := NewClient("unix://"+filepath.Join(t.TempDir(), "missing.sock"), ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Ping(context.Background()); err == nil {
+		t.Error("Ping on a missing socket succeeded")
+	}
+}
+
+func TestNewClientHosts(t *testing.T) {
+	tests := []struct {
+		host    string
+		baseURL string
+		remote  string
+		tls     *TLSConfig
+		fail    bool
+	}{
+		{"unix:///var/run/docker.sock", "http://docker", "", nil, false},
+		{"tcp://10.0.0.5:2375", "http://10.0.0.5:2375", "10.0.0.5", nil, false},
+		{"tcp://10.0.0.5:2376", "https://10.0.0.5:2376", "10.0.0.5", &TLSConfig{}, false},
+		{"https://docker.lan:2376", "https://docker.lan:2376", "docker.lan", nil, false},
+		{"ssh://admin@nas.lan:2222", "http://docker", "nas.lan", nil, false},
+		{"npipe:////./pipe/docker_engine", "", "", nil, true},
+		{"tcp://10.0.0.5:2376", "", "", &TLSConfig{CertFile: "missing.pem", KeyFile: "missing-key.pem"}, true},
+	}
+	for _, tt := range tests {
+		c, err := NewClient(tt.host, ClientOptions{TLS: tt.tls})
+		if (err != nil) != tt.fail {
+			t.Errorf("NewClient(%s) error = %v, want failure %v", tt.host, err, tt.fail)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if c.baseURL != tt.baseURL {
+			t.Errorf("NewClient(%s) base URL = %q, want %q", tt.host, c.baseURL, tt.baseURL)
+		}
+		if c.RemoteHost() != tt.remote {
+			t.Errorf("NewClient(%s).RemoteHost() = %q, want %q", tt.host, c.RemoteHost(), tt.remote)
+		}
+	}
+}
+
+func TestClientSSH(t *testing.T) {
+	socket := startFakeEngine(t, &fakeEngine{runtime: "podman"})
+
+	// The dialer stands in for ssh and connects to the fake engine instead
+	var mu sync.Mutex
+	var dialed [][]string
+	dial := func(ctx context.Context, name string, args ...string) (net.Conn, error) {
+		mu.Lock()
+		dialed = append(dialed, append([]string{name}, args...))
+		mu.Unlock()
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", socket)
+	}
+	c, err := NewEngineClient(Engine{Name: "nas", Host: "ssh://admin@nas.lan:2222", Runtime: "podman", SSHConnectTimeout: 1500 * time.Millisecond}, dial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "nas" {
+		t.Errorf("Name = %q, want nas", c.Name)
+	}
+	v, err := c.Version(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.IsPodman() {
+		t.Errorf("Version() = %+v, want the podman engine", v)
+	}
+	want := []string{"ssh", "-o", "BatchMode=yes", "-o", "ConnectTimeout=2", "-p", "2222", "--", "admin@nas.lan", "podman", "system", "dial-stdio"}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(dialed) != 1 || !reflect.DeepEqual(dialed[0], want) {
+		t.Errorf("dialed %v, want %v", dialed, want)
+	}
+
+	// A failed ssh surfaces its error
+	failing := func(ctx context.Context, name string, args ...string) (net.Conn, error) {
+		return nil, errors.New("Permission denied (publickey)")
+	}
+	c, err = NewEngineClient(Engine{Name: "nas", Host: "ssh://nas.lan"}, failing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Ping(context.Background()); err == nil || !strings.Contains(err.Error(), "Permission denied") {
+		t.Errorf("Ping over a failing ssh = %v, want the ssh error", err)
+	}
+}
+
+func TestSSHArgs(t *testing.T) {
+	tests := []struct {
+		host    string
+		runtime string
+		timeout float64
+		want    string
+	}{
+		{"ssh://nas.lan", "", 0, "-o BatchMode=yes -- nas.lan docker system dial-stdio"},
+		{"ssh://root@10.0.0.9", "docker", 10, "-o BatchMode=yes -o ConnectTimeout=10 -- root@10.0.0.9 docker system dial-stdio"},
+		{"ssh://admin@nas.lan:2222", "podman", 0.2, "-o BatchMode=yes -o ConnectTimeout=1 -p 2222 -- admin@nas.lan podman system dial-stdio"},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(sshArgs(u, tt.runtime, tt.timeout), " "); got != tt.want {
+			t.Errorf("sshArgs(%s, %q, %v) = %q, want %q", tt.host, tt.runtime, tt.timeout, got, tt.want)
+		}
+	}
+}
+
+func TestTLSClientConfig(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	dir := t.TempDir()
+	ca := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	yes, no := true, false
+
+	tests := []struct {
+		name   string
+		tls    *TLSConfig
+		verify bool
+		fail   bool
+	}{
+		{"no tls config", nil, true, false},
+		{"ca", &TLSConfig{CAFile: ca}, true, false},
+		{"ca without verification", &TLSConfig{CAFile: ca, Verify: &no}, false, false},
+		{"no ca", &TLSConfig{}, false, false},
+		{"verify without ca", &TLSConfig{Verify: &yes}, true, false},
+		{"missing ca", &TLSConfig{CAFile: filepath.Join(dir, "missing.pem")}, false, true},
+		{"missing ca without verification", &TLSConfig{CAFile: filepath.Join(dir, "missing.pem"), Verify: &no}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := tt.tls.clientConfig()
+			if (err != nil) != tt.fail {
+				t.Fatalf("error = %v, want failure %v", err, tt.fail)
+			}
+			if err != nil {
+				return
+			}
+			if cfg.InsecureSkipVerify == tt.verify {
+				t.Errorf("InsecureSkipVerify = %v, want verification %v", cfg.InsecureSkipVerify, tt.verify)
+			}
+		})
+	}
+
+	// The CA is trusted: a verifying client reaches the server it signed
+	c, err := NewClient(strings.Replace(srv.URL, "https://", "tcp://", 1), ClientOptions{TLS: &TLSConfig{CAFile: ca}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Ping(context.Background()); err != nil {
+		t.Errorf("Ping with the server's CA: %v", err)
+	}
+}
+
+func TestEnvEngineTLS(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ca.pem"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	yes, no := true, false
+
+	tests := []struct {
+		name     string
+		certPath string
+		verify   string
+		ca       string
+		want     *bool
+	}{
+		{"cert path with ca", dir, "", filepath.Join(dir, "ca.pem"), nil},
+		{"cert path without ca", t.TempDir(), "", "", nil},
+		{"verify off", dir, "0", filepath.Join(dir, "ca.pem"), &no},
+		{"verify on", dir, "1", filepath.Join(dir, "ca.pem"), &yes},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DOCKER_HOST", "tcp://10.0.0.5:2376")
+			t.Setenv("DOCKER_CERT_PATH", tt.certPath)
+			t.Setenv("DOCKER_TLS_VERIFY", tt.verify)
+			e := EnvEngine()
+			if e.TLS == nil {
+				t.Fatal("no TLS config")
+			}
+			if e.TLS.CAFile != tt.ca || !reflect.DeepEqual(e.TLS.Verify, tt.want) {
+				t.Errorf("TLS = %+v, want CA %q and verify %v", e.TLS, tt.ca, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"atlas/internal/utils"
+)
+
+// LocalEngine is the name of the engine used when no engines file exists.
+const LocalEngine = "local"
+
+// Engine is a named container engine from the engines file.
+type Engine struct {
+	Name string     `yaml:"name"`
+	Host string     `yaml:"host"` // unix:///path.sock, tcp://addr:port, https://addr:port or ssh://[user@]host[:port]
+	TLS  *TLSConfig `yaml:"tls"`
+	// Runtime is docker, podman (its Docker-compatible API) or containerd; detected when empty
+	Runtime string `yaml:"runtime"`
+	// Namespace is the containerd namespace to list, default "default"
+	Namespace string `yaml:"namespace"`
+	// SSHConnectTimeout bounds connecting to an ssh:// host, e.g. 10s; default DefaultSSHConnectTimeout
+	SSHConnectTimeout time.Duration `yaml:"ssh_connect_timeout"`
+}
+
+// DefaultSSHConnectTimeout is the ssh connect timeout of an engine that does not set one.
+const DefaultSSHConnectTimeout = 10 * time.Second
+
+// EnvEngine returns the LocalEngine as configured by DOCKER_HOST (default DefaultHost),
+// DOCKER_CERT_PATH and DOCKER_TLS_VERIFY, like the docker CLI. Unlike the CLI, the daemon's
+// certificate is verified whenever the certificate directory has a ca.pem, unless
+// DOCKER_TLS_VERIFY is set to false.
+func EnvEngine() Engine {
+	e := Engine{Name: LocalEngine, Host: utils.EnvString("DOCKER_HOST", DefaultHost)}
+	if dir := utils.EnvString("DOCKER_CERT_PATH", ""); dir != "" || utils.EnvBool("DOCKER_TLS_VERIFY", false) {
+		if dir == "" {
+			home, _ := os.UserHomeDir()
+			dir = filepath.Join(home, ".docker")
+		}
+		e.TLS = &TLSConfig{
+			CertFile: filepath.Join(dir, "cert.pem"),
+			KeyFile:  filepath.Join(dir, "key.pem"),
+		}
+		if ca := filepath.Join(dir, "ca.pem"); fileExists(ca) {
+			e.TLS.CAFile = ca
+		}
+		if os.Getenv("DOCKER_TLS_VERIFY") != "" {
+			verify := utils.EnvBool("DOCKER_TLS_VERIFY", false)
+			e.TLS.Verify = &verify
+		}
+	}
+	return e
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+type engineFile struct {
+	Engines []Engine `yaml:"engines"`
+}
+
+// LoadEngines reads the engines to scan from path. A missing file gives no engines.
+func LoadEngines(path string) ([]Engine, error) {
+	data, err := os.ReadFile(path)
+	if path == "" || errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	var f engineFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	seen := make(map[string]bool)
+	for _, e := range f.Engines {
+		if e.Name == "" || e.Host == "" {
+			return nil, fmt.Errorf("%s: every engine needs a name and a host", path)
+		}
+		if seen[e.Name] {
+			return nil, fmt.Errorf("%s: duplicate engine %q", path, e.Name)
+		}
+		switch e.Runtime {
+		case "", "docker", "podman", "containerd":
+		default:
+			return nil, fmt.Errorf("%s: engine %s: unknown runtime %q (expected docker, podman or containerd)", path, e.Name, e.Runtime)
+		}
+		seen[e.Name] = true
+	}
+	return f.Engines, nil
+}
+
+// NewEngineClient returns an Engine API client for a docker or podman engine. dial starts the ssh
+// command of an ssh:// engine; nil runs it on the host.
+func NewEngineClient(e Engine, dial DialCommand) (*Client, error) {
+	timeout := e.SSHConnectTimeout
+	if timeout == 0 {
+		timeout = DefaultSSHConnectTimeout
+	}
+	c, err := NewClient(e.Host, ClientOptions{TLS: e.TLS, Runtime: e.Runtime, SSHConnectTimeout: timeout, Dial: dial})
+	if err != nil {
+		return nil, fmt.Errorf("engine %s: %v", e.Name, err)
+	}
+	c.Name = e.Name
+	return c, nil
+}
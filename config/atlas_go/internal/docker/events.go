@@ -0,0 +1,68 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// Event is a message of GET /events.
+type Event struct {
+	Type     string     `json:"Type"`   // container, network, image, volume, ...
+	Action   string     `json:"Action"` // start, die, destroy, rename, connect, disconnect, ...
+	Actor    EventActor `json:"Actor"`
+	Time     int64      `json:"time"`
+	TimeNano int64      `json:"timeNano"`
+}
+
+// EventActor is the object an event is about. For network connect/disconnect events ID is the
+// network and Attributes["container"] the container; rename events carry Attributes["oldName"].
+type EventActor struct {
+	ID         string            `json:"ID"`
+	Attributes map[string]string `json:"Attributes"`
+}
+
+// EventStream is an open GET /events response.
+type EventStream struct {
+	resp *http.Response
+	dec  *json.Decoder
+}
+
+// Events subscribes to the engine's event stream. filters restricts it the way `docker events
+// --filter` does, e.g. {"type": ["container"], "event": ["start", "die"]}. The stream ends when ctx
+// is cancelled, the daemon goes away or Close is called.
+func (c *Client) Events(ctx context.Context, filters map[string][]string) (*EventStream, error) {
+	query := url.Values{}
+	if len(filters) > 0 {
+		f, err := json.Marshal(filters)
+		if err != nil {
+			return nil, err
+		}
+		query.Set("filters", string(f))
+	}
+	resp, err := c.do(ctx, "/events", query)
+	if err != nil {
+		return nil, err
+	}
+	return &EventStream{resp: resp, dec: json.NewDecoder(resp.Body)}, nil
+}
+
+// Next blocks until the next event arrives. It returns io.EOF when the daemon closes the stream.
+func (s *EventStream) Next() (Event, error) {
+	var e Event
+	if err := s.dec.Decode(&e); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return e, io.EOF
+		}
+		return e, fmt.Errorf("event stream: %v", err)
+	}
+	return e, nil
+}
+
+// Close ends the subscription.
+func (s *EventStream) Close() error {
+	return s.resp.Body.Close()
+}
@@ -0,0 +1,45 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+)
+
+// DialCommand starts a command and returns a connection to its standard input and output, like
+// utils.Runner's Conn.
+type DialCommand func(ctx context.Context, name string, args ...string) (net.Conn, error)
+
+// sshArgs returns the ssh command line reaching the engine API on an ssh:// host the way the docker
+// CLI does: `<runtime> system dial-stdio` runs on the remote side and the connection is its
+// stdin/stdout. Podman has the same subcommand. Key-based authentication has to work
+// non-interactively (ssh-agent or ~/.ssh/config).
+func sshArgs(u *url.URL, runtime string, connectTimeout float64) []string {
+	args := []string{"-o", "BatchMode=yes"}
+	if connectTimeout > 0 {
+		args = append(args, "-o", fmt.Sprintf("ConnectTimeout=%d", int(math.Ceil(connectTimeout))))
+	}
+	if u.Port() != "" {
+		args = append(args, "-p", u.Port())
+	}
+	target := u.Hostname()
+	if u.User != nil {
+		target = u.User.Username() + "@" + target
+	}
+	remote := "docker"
+	if runtime == "podman" {
+		remote = "podman"
+	}
+	return append(args, "--", target, remote, "system", "dial-stdio")
+}
+
+// dialSSH returns the DialContext of an ssh:// host. Every new connection starts its own ssh.
+func dialSSH(u *url.URL, opts ClientOptions) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	args := sshArgs(u, opts.Runtime, opts.SSHConnectTimeout.Seconds())
+	dial := opts.Dial
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dial(ctx, "ssh", args...)
+	}
+}
@@ -0,0 +1,89 @@
+package docker
+
+// The types below hold the parts of the Engine API responses Atlas uses; other fields are ignored.
+
+// ContainerSummary is an entry of GET /containers/json.
+type ContainerSummary struct {
+	ID     string   `json:"Id"`
+	Names  []string `json:"Names"`
+	Image  string   `json:"Image"`
+	State  string   `json:"State"`
+	Status string   `json:"Status"`
+}
+
+// Container is the response of GET /containers/{id}/json.
+type Container struct {
+	ID              string          `json:"Id"`
+	Name            string          `json:"Name"` // with a leading slash, e.g. "/web"
+	State           ContainerState  `json:"State"`
+	Config          ContainerConfig `json:"Config"`
+	NetworkSettings NetworkSettings `json:"NetworkSettings"`
+}
+
+type ContainerState struct {
+	Status  string `json:"Status"` // created, running, paused, restarting, removing, exited or dead
+	Running bool   `json:"Running"`
+}
+
+type ContainerConfig struct {
+	Hostname string            `json:"Hostname"`
+	Image    string            `json:"Image"`
+	Labels   map[string]string `json:"Labels"`
+}
+
+type NetworkSettings struct {
+	// Ports maps "80/tcp" to its host bindings; an exposed but unpublished port maps to null
+	Ports    map[string][]PortBinding    `json:"Ports"`
+	Networks map[string]EndpointSettings `json:"Networks"`
+}
+
+type PortBinding struct {
+	HostIP   string `json:"HostIp"`
+	HostPort string `json:"HostPort"`
+}
+
+// EndpointSettings is a container's attachment to one network.
+type EndpointSettings struct {
+	NetworkID         string `json:"NetworkID"`
+	IPAddress         string `json:"IPAddress"`
+	IPPrefixLen       int    `json:"IPPrefixLen"`
+	Gateway           string `json:"Gateway"`
+	GlobalIPv6Address string `json:"GlobalIPv6Address"`
+	MacAddress        string `json:"MacAddress"`
+}
+
+// Network is an entry of GET /networks.
+type Network struct {
+	ID         string            `json:"Id"`
+	Name       string            `json:"Name"`
+	Driver     string            `json:"Driver"` // bridge, overlay, macvlan, host, null, ...
+	Scope      string            `json:"Scope"`  // local or swarm
+	Internal   bool              `json:"Internal"`
+	Attachable bool              `json:"Attachable"`
+	IPAM       IPAM              `json:"IPAM"`
+	Options    map[string]string `json:"Options"`
+}
+
+type IPAM struct {
+	Driver string       `json:"Driver"`
+	Config []IPAMConfig `json:"Config"`
+}
+
+// IPAMConfig is one address pool of a network; IPv4 and IPv6 pools are separate entries.
+type IPAMConfig struct {
+	Subnet  string `json:"Subnet"`
+	IPRange string `json:"IPRange"`
+	Gateway string `json:"Gateway"`
+}
+
+// BridgeName returns the host interface of a bridge network: the one set in its options, or the
+// br-<id> interface Docker creates for a user-defined bridge. Other drivers have none.
+func (n Network) BridgeName() string {
+	if name := n.Options["com.docker.network.bridge.name"]; name != "" {
+		return name
+	}
+	if n.Driver != "bridge" || len(n.ID) < 12 {
+		return ""
+	}
+	return "br-" + n.ID[:12]
+}
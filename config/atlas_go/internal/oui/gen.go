@@ -0,0 +1,80 @@
+//go:build ignore
+
+// gen.go writes ieee_ma_l.txt.gz, the vendor registry built into atlas: every MA-L (24 bit)
+// assignment of the IEEE registry, one "PREFIX vendor" line each (the nmap-mac-prefixes format
+// Parse reads), gzipped. Run it with `go generate ./internal/oui`; -in reads a downloaded copy of
+// oui.csv or oui.txt instead of fetching it.
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"atlas/internal/oui"
+)
+
+const registryURL = "https://standards-oui.ieee.org/oui/oui.csv"
+
+func main() {
+	in := flag.String("in", registryURL, "IEEE MA-L registry URL or file (oui.csv or oui.txt)")
+	out := flag.String("out", "ieee_ma_l.txt.gz", "output file")
+	flag.Parse()
+
+	r, err := open(*in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	d, err := oui.Parse(r)
+	r.Close()
+	if err != nil {
+		log.Fatalf("%s: %v", *in, err)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	zw, _ := gzip.NewWriterLevel(f, gzip.BestCompression)
+	w := bufio.NewWriter(zw)
+	fmt.Fprintf(w, "# Code generated by gen.go from %s; DO NOT EDIT.\n", *in)
+	n := 0
+	for _, prefix := range d.Prefixes() {
+		if len(prefix) == 6 {
+			fmt.Fprintf(w, "%s %s\n", prefix, d.Vendor(prefix))
+			n++
+		}
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote %d prefixes to %s", n, *out)
+}
+
+// open returns the registry at src, downloading it when src is a URL.
+func open(src string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(src, "https://") {
+		return os.Open(src)
+	}
+	resp, err := http.Get(src)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", src, resp.Status)
+	}
+	return resp.Body, nil
+}
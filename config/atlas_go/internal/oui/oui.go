@@ -0,0 +1,186 @@
+// Package oui resolves MAC addresses to the vendor their prefix is registered to.
+package oui
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:generate go run gen.go
+
+// registry is the IEEE MA-L registry written by gen.go.
+//
+//go:embed ieee_ma_l.txt.gz
+var registry []byte
+
+// Prefix lengths in hex digits: MA-L (24 bit), MA-M (28 bit) and MA-S (36 bit) assignments.
+var prefixLengths = []int{9, 7, 6}
+
+// DB maps MAC prefixes (uppercase hex without separators) to vendor names.
+type DB struct {
+	vendors map[string]string
+}
+
+// Embedded returns the built-in IEEE MA-L registry.
+func Embedded() *DB {
+	zr, err := gzip.NewReader(bytes.NewReader(registry))
+	if err != nil {
+		panic(fmt.Sprintf("embedded OUI data: %v", err))
+	}
+	db, err := Parse(zr)
+	if err != nil {
+		panic(fmt.Sprintf("embedded OUI data: %v", err))
+	}
+	return db
+}
+
+// New builds a DB from prefix -> vendor pairs.
+func New(vendors map[string]string) *DB {
+	db := &DB{vendors: make(map[string]string, len(vendors))}
+	for prefix, vendor := range vendors {
+		db.vendors[strings.ToUpper(prefix)] = vendor
+	}
+	return db
+}
+
+// Merge returns a DB with the entries of d overridden by those of other.
+func (d *DB) Merge(other *DB) *DB {
+	merged := New(d.vendors)
+	for prefix, vendor := range other.vendors {
+		merged.vendors[prefix] = vendor
+	}
+	return merged
+}
+
+// Len returns the number of prefixes.
+func (d *DB) Len() int {
+	return len(d.vendors)
+}
+
+// Prefixes returns every prefix in sorted order.
+func (d *DB) Prefixes() []string {
+	prefixes := make([]string, 0, len(d.vendors))
+	for p := range d.vendors {
+		prefixes = append(prefixes, p)
+	}
+	sort.Strings(prefixes)
+	return prefixes
+}
+
+// Vendor returns the vendor registered for prefix (as returned by Prefixes).
+func (d *DB) Vendor(prefix string) string {
+	return d.vendors[prefix]
+}
+
+// Lookup returns the vendor of mac, or "" if its prefix is unknown. The longest registered
+// prefix wins, so MA-S/MA-M blocks override the MA-L block they were carved out of.
+func (d *DB) Lookup(mac string) string {
+	digits := hexDigits(mac)
+	if len(digits) != 12 {
+		return ""
+	}
+	for _, n := range prefixLengths {
+		if vendor, ok := d.vendors[digits[:n]]; ok {
+			return vendor
+		}
+	}
+	return ""
+}
+
+// IsLocallyAdministered reports whether mac has the locally administered bit set. Such addresses
+// are not registered to a vendor: they are assigned by software, e.g. per-network randomized MACs
+// on phones and laptops, or the NICs of containers and VMs.
+func IsLocallyAdministered(mac string) bool {
+	digits := hexDigits(mac)
+	if len(digits) != 12 {
+		return false
+	}
+	first, _ := strconv.ParseUint(digits[:2], 16, 8)
+	return first&0x02 != 0
+}
+
+// hexDigits strips separators from a MAC address and upper-cases it.
+func hexDigits(mac string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(mac) {
+		if (r >= '0' && r <= '9') || (r >= 'A' && r <= 'F') {
+			b.WriteRune(r)
+		} else if r != ':' && r != '-' && r != '.' {
+			return ""
+		}
+	}
+	return b.String()
+}
+
+var (
+	// IEEE oui.txt: "00-50-56   (hex)		VMware, Inc."
+	ieeeTxtLine = regexp.MustCompile(`^([0-9A-Fa-f]{2})-([0-9A-Fa-f]{2})-([0-9A-Fa-f]{2})\s+\(hex\)\s+(.+)$`)
+	// nmap-mac-prefixes: "005056 VMware"
+	nmapLine = regexp.MustCompile(`^([0-9A-Fa-f]{6}|[0-9A-Fa-f]{7}|[0-9A-Fa-f]{9})\s+(.+)$`)
+)
+
+// Parse reads a vendor list in any of the formats the IEEE and nmap publish: the IEEE registry
+// CSV (oui.csv, mam.csv, oui36.csv), the IEEE oui.txt listing, or nmap-mac-prefixes.
+func Parse(r io.Reader) (*DB, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(64)
+	if bytes.HasPrefix(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")), []byte("Registry,")) {
+		return parseCSV(br)
+	}
+
+	db := &DB{vendors: make(map[string]string)}
+	scanner := bufio.NewScanner(br)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// oui.txt repeats every entry as "005056     (base 16)		VMware, Inc."
+		if line == "" || strings.HasPrefix(line, "#") || strings.Contains(line, "(base 16)") {
+			continue
+		}
+		if m := ieeeTxtLine.FindStringSubmatch(line); m != nil {
+			db.vendors[strings.ToUpper(m[1]+m[2]+m[3])] = strings.TrimSpace(m[4])
+		} else if m := nmapLine.FindStringSubmatch(line); m != nil {
+			db.vendors[strings.ToUpper(m[1])] = strings.TrimSpace(m[2])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(db.vendors) == 0 {
+		return nil, fmt.Errorf("no vendor prefixes found")
+	}
+	return db, nil
+}
+
+// parseCSV reads the IEEE registry CSV: Registry,Assignment,Organization Name,Organization Address.
+func parseCSV(r io.Reader) (*DB, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid OUI CSV: %v", err)
+	}
+	db := &DB{vendors: make(map[string]string)}
+	for i, rec := range records {
+		if i == 0 || len(rec) < 3 {
+			continue
+		}
+		prefix := strings.ToUpper(strings.TrimSpace(rec[1]))
+		if n := len(prefix); (n == 6 || n == 7 || n == 9) && hexDigits(prefix) == prefix {
+			db.vendors[prefix] = strings.TrimSpace(rec[2])
+		}
+	}
+	if len(db.vendors) == 0 {
+		return nil, fmt.Errorf("no vendor prefixes found")
+	}
+	return db, nil
+}
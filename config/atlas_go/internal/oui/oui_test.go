@@ -0,0 +1,142 @@
+package oui
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  map[string]string
+	}{
+		{
+			name: "ieee csv",
+			input: "\xef\xbb\xbfRegistry,Assignment,Organization Name,Organization Address\n" +
+				"MA-L,000C29,\"VMware, Inc.\",3401 Hillview Avenue Palo Alto CA US 94304\n" +
+				"MA-L,b827eb,Raspberry Pi Foundation,Mitchell Wood House Caldecote GB CB23 7NU\n",
+			want: map[string]string{"000C29": "VMware, Inc.", "B827EB": "Raspberry Pi Foundation"},
+		},
+		{
+			name: "ieee csv ma-m and ma-s",
+			input: "Registry,Assignment,Organization Name,Organization Address\n" +
+				"MA-M,70B3D5F,Example Labs,Somewhere\n" +
+				"MA-S,70B3D5F2A,Tiny Devices,Elsewhere\n" +
+				"MA-L,XYZ,Broken,\n",
+			want: map[string]string{"70B3D5F": "Example Labs", "70B3D5F2A": "Tiny Devices"},
+		},
+		{
+			name: "ieee txt",
+			input: "OUI/MA-L                                                    Organization\n" +
+				"company_id                                                  Organization\n\n" +
+				"00-50-56   (hex)\t\tVMware, Inc.\n" +
+				"005056     (base 16)\t\tVMware, Inc.\n" +
+				"\t\t\t\t3401 Hillview Avenue\n",
+			want: map[string]string{"005056": "VMware, Inc."},
+		},
+		{
+			name:  "nmap-mac-prefixes",
+			input: "# comment\n000C29 VMware\n70B3D5F2A Tiny Devices\n\nb827eb Raspberry Pi Foundation\n",
+			want:  map[string]string{"000C29": "VMware", "70B3D5F2A": "Tiny Devices", "B827EB": "Raspberry Pi Foundation"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := Parse(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.Len() != len(tt.want) {
+				t.Errorf("parsed %d prefixes %v, want %d", d.Len(), d.Prefixes(), len(tt.want))
+			}
+			for prefix, vendor := range tt.want {
+				if got := d.Vendor(prefix); got != vendor {
+					t.Errorf("Vendor(%s) = %q, want %q", prefix, got, vendor)
+				}
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, input := range []string{"", "# only a comment\n", "Registry,Assignment,Organization Name\n", "not a vendor list\n"} {
+		if _, err := Parse(strings.NewReader(input)); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", input)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	d := New(map[string]string{
+		"70B3D5":    "IEEE Registration Authority",
+		"70b3d5f":   "Example Labs",
+		"70B3D5F2A": "Tiny Devices",
+		"000C29":    "VMware",
+	})
+	tests := []struct {
+		mac  string
+		want string
+	}{
+		{"00:0c:29:ab:cd:ef", "VMware"},
+		{"00-0C-29-AB-CD-EF", "VMware"},
+		{"000c.29ab.cdef", "VMware"},
+		{"70:b3:d5:00:00:01", "IEEE Registration Authority"},
+		{"70:b3:d5:f0:00:01", "Example Labs"}, // MA-M inside the MA-L block
+		{"70:b3:d5:f2:a0:01", "Tiny Devices"}, // MA-S inside the MA-M block
+		{"00:11:22:33:44:55", ""},             // unregistered
+		{"00:0c:29:ab:cd", ""},                // too short
+		{"00:0c:29:ab:cd:eg", ""},             // not hex
+		{"Unknown", ""},
+	}
+	for _, tt := range tests {
+		if got := d.Lookup(tt.mac); got != tt.want {
+			t.Errorf("Lookup(%q) = %q, want %q", tt.mac, got, tt.want)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	base := New(map[string]string{"000C29": "VMware", "B827EB": "Raspberry Pi"})
+	merged := base.Merge(New(map[string]string{"b827eb": "Raspberry Pi Foundation", "DCA632": "Raspberry Pi Trading"}))
+	if merged.Len() != 3 || merged.Vendor("B827EB") != "Raspberry Pi Foundation" || merged.Vendor("000C29") != "VMware" {
+		t.Errorf("merged = %v", merged.vendors)
+	}
+	if base.Vendor("B827EB") != "Raspberry Pi" {
+		t.Errorf("Merge changed its receiver: %v", base.vendors)
+	}
+}
+
+func TestIsLocallyAdministered(t *testing.T) {
+	tests := []struct {
+		mac  string
+		want bool
+	}{
+		{"00:0c:29:ab:cd:ef", false},
+		{"02:42:ac:11:00:02", true}, // Docker
+		{"52:54:00:12:34:56", true}, // QEMU
+		{"da:a1:19:00:00:01", true}, // randomized phone MAC
+		{"DA-A1-19-00-00-01", true},
+		{"01:00:5e:00:00:fb", false}, // multicast, universally administered
+		{"03:00:00:00:00:01", true},
+		{"Unknown", false},
+		{"02:42:ac", false},
+	}
+	for _, tt := range tests {
+		if got := IsLocallyAdministered(tt.mac); got != tt.want {
+			t.Errorf("IsLocallyAdministered(%q) = %v, want %v", tt.mac, got, tt.want)
+		}
+	}
+}
+
+func TestEmbedded(t *testing.T) {
+	d := Embedded()
+	for _, prefix := range d.Prefixes() {
+		if len(prefix) != 6 {
+			t.Errorf("embedded registry has non MA-L prefix %s", prefix)
+		}
+	}
+	if got := d.Lookup("00:0c:29:ab:cd:ef"); got == "" {
+		t.Error("embedded registry does not know VMware's 00:0C:29")
+	}
+}
@@ -0,0 +1,252 @@
+package scan
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"atlas/internal/utils"
+)
+
+// Announcement is what a host advertises about itself on the local link.
+type Announcement struct {
+	MDNS []string // mDNS/DNS-SD service types, e.g. "_ipp._tcp"
+	SSDP []string // SSDP SERVER and ST headers, e.g. "Linux/3.14 UPnP/1.0 Sonos/63.2"
+}
+
+const (
+	mdnsGroup = "224.0.0.251:5353"
+	ssdpGroup = "239.255.255.250:1900"
+
+	dnsTypePTR = 12
+)
+
+// probeAnnouncements asks the link target is attached to for mDNS services and SSDP devices and
+// returns the answers keyed by responder IP. Multicast does not cross routers and IPv6 responders
+// also answer on IPv4, so only directly attached IPv4 targets are probed; others return nil.
+// Both probes use an ephemeral source port, so responders answer by unicast and nothing has to
+// join the multicast groups.
+func probeAnnouncements(target utils.ScanTarget, timeout time.Duration) (map[string]*Announcement, error) {
+	src := net.ParseIP(target.IP)
+	if timeout <= 0 || target.Gateway != "" || src == nil || src.To4() == nil {
+		return nil, nil
+	}
+	_, prefix, err := net.ParseCIDR(target.Subnet)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subnet %q: %v", target.Subnet, err)
+	}
+
+	found := make(map[string]*Announcement)
+	var mu sync.Mutex
+	add := func(ip string, mdns, ssdp []string) {
+		if !prefix.Contains(net.ParseIP(ip)) || target.Excluded(ip) {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		a := found[ip]
+		if a == nil {
+			a = &Announcement{}
+			found[ip] = a
+		}
+		a.MDNS = appendUnique(a.MDNS, mdns...)
+		a.SSDP = appendUnique(a.SSDP, ssdp...)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		errs[0] = queryMulticast(src, mdnsGroup, mdnsQuery("_services._dns-sd._udp.local"), timeout, func(ip string, msg []byte) {
+			add(ip, parseMDNSServices(msg), nil)
+		})
+	}()
+	go func() {
+		defer wg.Done()
+		errs[1] = queryMulticast(src, ssdpGroup, ssdpSearch(), timeout, func(ip string, msg []byte) {
+			add(ip, nil, parseSSDPHeaders(msg))
+		})
+	}()
+	wg.Wait()
+
+	for ip, a := range found {
+		sort.Strings(a.MDNS)
+		sort.Strings(a.SSDP)
+		if len(a.MDNS) == 0 && len(a.SSDP) == 0 {
+			delete(found, ip)
+		}
+	}
+	if errs[0] != nil && errs[1] != nil {
+		return nil, fmt.Errorf("mDNS: %v, SSDP: %v", errs[0], errs[1])
+	}
+	return found, nil
+}
+
+// queryMulticast sends query to group from an ephemeral port on src and hands every reply received
+// within timeout to handle. Binding the source address makes the kernel send the multicast out of
+// the interface that owns it.
+func queryMulticast(src net.IP, group string, query []byte, timeout time.Duration, handle func(ip string, msg []byte)) error {
+	dst, err := net.ResolveUDPAddr("udp4", group)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: src})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.WriteToUDP(query, dst); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 9000)
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			// The deadline ends the listening window
+			return nil
+		}
+		handle(addr.IP.String(), buf[:n])
+	}
+}
+
+// ssdpSearch builds an SSDP M-SEARCH for every device and service type.
+func ssdpSearch() []byte {
+	return []byte("M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + ssdpGroup + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 1\r\n" +
+		"ST: ssdp:all\r\n\r\n")
+}
+
+// parseSSDPHeaders returns the SERVER and ST headers of an M-SEARCH response.
+func parseSSDPHeaders(msg []byte) []string {
+	var values []string
+	for _, line := range strings.Split(string(msg), "\r\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch strings.ToUpper(strings.TrimSpace(key)) {
+		case "SERVER", "ST":
+			if v := strings.TrimSpace(value); v != "" && v != "ssdp:all" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+// mdnsQuery builds a DNS query for the PTR records of name.
+func mdnsQuery(name string) []byte {
+	msg := make([]byte, 12)
+	binary.BigEndian.PutUint16(msg[4:6], 1) // one question
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0, 0, dnsTypePTR, 0, 1)
+	return msg
+}
+
+// parseMDNSServices returns the service types named in the PTR records of an mDNS response: the
+// targets of DNS-SD service enumeration records and the owners of service instance records, both
+// without the ".local" suffix.
+func parseMDNSServices(msg []byte) []string {
+	if len(msg) < 12 {
+		return nil
+	}
+	questions := int(binary.BigEndian.Uint16(msg[4:6]))
+	records := int(binary.BigEndian.Uint16(msg[6:8])) + int(binary.BigEndian.Uint16(msg[8:10])) + int(binary.BigEndian.Uint16(msg[10:12]))
+	off := 12
+	for i := 0; i < questions; i++ {
+		_, next, ok := readDNSName(msg, off)
+		if !ok || next+4 > len(msg) {
+			return nil
+		}
+		off = next + 4
+	}
+
+	var services []string
+	for i := 0; i < records; i++ {
+		owner, next, ok := readDNSName(msg, off)
+		if !ok || next+10 > len(msg) {
+			break
+		}
+		typ := binary.BigEndian.Uint16(msg[next : next+2])
+		rdlen := int(binary.BigEndian.Uint16(msg[next+8 : next+10]))
+		rdata := next + 10
+		if rdata+rdlen > len(msg) {
+			break
+		}
+		if typ == dnsTypePTR {
+			service := owner
+			if strings.EqualFold(owner, "_services._dns-sd._udp.local") {
+				service, _, _ = readDNSName(msg, rdata)
+			}
+			if strings.HasPrefix(service, "_") {
+				services = appendUnique(services, strings.TrimSuffix(service, ".local"))
+			}
+		}
+		off = rdata + rdlen
+	}
+	return services
+}
+
+// readDNSName decodes the (possibly compressed) name at off and returns it with the offset just
+// past it.
+func readDNSName(msg []byte, off int) (string, int, bool) {
+	var labels []string
+	end := -1
+	for jumps := 0; jumps < 16; {
+		if off >= len(msg) {
+			return "", 0, false
+		}
+		l := int(msg[off])
+		switch {
+		case l == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return strings.Join(labels, "."), end, true
+		case l&0xc0 == 0xc0:
+			if off+1 >= len(msg) {
+				return "", 0, false
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:off+2]) & 0x3fff)
+			jumps++
+		default:
+			if off+1+l > len(msg) {
+				return "", 0, false
+			}
+			labels = append(labels, string(msg[off+1:off+1+l]))
+			off += 1 + l
+		}
+	}
+	return "", 0, false
+}
+
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		dup := false
+		for _, existing := range list {
+			if existing == v {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			list = append(list, v)
+		}
+	}
+	return list
+}
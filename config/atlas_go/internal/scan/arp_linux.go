@@ -0,0 +1,153 @@
+//go:build linux
+
+package scan
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"atlas/internal/utils"
+)
+
+const (
+	ethPArp     = 0x0806
+	ethPIPv4    = 0x0800
+	arpRequest  = 1
+	arpReply    = 2
+	arpFrameLen = 14 + 28
+)
+
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
+
+// arpSweep broadcasts an ARP who-has for every target on the interface and returns the addresses
+// that answered, mapped to the MAC address they answered with. It needs CAP_NET_RAW; callers fall
+// back to ICMP when it fails.
+func arpSweep(iface utils.InterfaceInfo, targets []net.IP, cfg DiscoveryConfig) (map[string]string, error) {
+	nif, err := net.InterfaceByName(iface.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(nif.HardwareAddr) != 6 {
+		return nil, fmt.Errorf("interface %s has no Ethernet address", iface.Name)
+	}
+	srcIP := net.ParseIP(iface.IP).To4()
+	if srcIP == nil {
+		return nil, fmt.Errorf("interface %s has no IPv4 address", iface.Name)
+	}
+
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(htons(ethPArp)))
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+	if err := syscall.Bind(fd, &syscall.SockaddrLinklayer{Protocol: htons(ethPArp), Ifindex: nif.Index}); err != nil {
+		return nil, err
+	}
+	// A short receive timeout lets the reader notice when the sweep is over.
+	tv := syscall.NsecToTimeval((100 * time.Millisecond).Nanoseconds())
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(targets))
+	for _, ip := range targets {
+		wanted[ip.String()] = true
+	}
+	replies := make(map[string]string)
+	var mu sync.Mutex
+	done := make(chan struct{})
+	var readerWg sync.WaitGroup
+	readerWg.Add(1)
+	go func() {
+		defer readerWg.Done()
+		buf := make([]byte, 1500)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			n, _, err := syscall.Recvfrom(fd, buf, 0)
+			if err != nil || n < arpFrameLen {
+				continue
+			}
+			ip, mac, ok := parseARPReply(buf[:n])
+			if !ok || !wanted[ip] {
+				continue
+			}
+			mu.Lock()
+			replies[ip] = mac
+			mu.Unlock()
+		}
+	}()
+
+	dst := &syscall.SockaddrLinklayer{Protocol: htons(ethPArp), Ifindex: nif.Index, Halen: 6}
+	copy(dst.Addr[:], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	batch := cfg.Concurrency
+	if batch <= 0 {
+		batch = 1
+	}
+	for attempt := 0; attempt <= cfg.Retries; attempt++ {
+		sent := 0
+		for _, ip := range targets {
+			mu.Lock()
+			_, seen := replies[ip.String()]
+			mu.Unlock()
+			if seen {
+				continue
+			}
+			if err := syscall.Sendto(fd, arpRequestFrame(nif.HardwareAddr, srcIP, ip.To4()), 0, dst); err != nil {
+				close(done)
+				readerWg.Wait()
+				return nil, err
+			}
+			// Pace the broadcast so switches and slow stacks are not flooded.
+			if sent++; sent%batch == 0 {
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+		time.Sleep(cfg.Timeout)
+	}
+	close(done)
+	readerWg.Wait()
+	return replies, nil
+}
+
+func arpRequestFrame(srcMAC net.HardwareAddr, srcIP, dstIP net.IP) []byte {
+	frame := make([]byte, arpFrameLen)
+	copy(frame[0:6], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	copy(frame[6:12], srcMAC)
+	binary.BigEndian.PutUint16(frame[12:14], ethPArp)
+
+	arp := frame[14:]
+	binary.BigEndian.PutUint16(arp[0:2], 1) // Ethernet
+	binary.BigEndian.PutUint16(arp[2:4], ethPIPv4)
+	arp[4] = 6
+	arp[5] = 4
+	binary.BigEndian.PutUint16(arp[6:8], arpRequest)
+	copy(arp[8:14], srcMAC)
+	copy(arp[14:18], srcIP)
+	copy(arp[24:28], dstIP)
+	return frame
+}
+
+// parseARPReply extracts the sender address from an Ethernet ARP reply frame.
+func parseARPReply(frame []byte) (string, string, bool) {
+	if binary.BigEndian.Uint16(frame[12:14]) != ethPArp {
+		return "", "", false
+	}
+	arp := frame[14:]
+	if binary.BigEndian.Uint16(arp[6:8]) != arpReply || arp[4] != 6 || arp[5] != 4 {
+		return "", "", false
+	}
+	mac := net.HardwareAddr(bytes.Clone(arp[8:14]))
+	ip := net.IP(bytes.Clone(arp[14:18]))
+	return ip.String(), mac.String(), true
+}
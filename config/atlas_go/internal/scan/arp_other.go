@@ -0,0 +1,15 @@
+//go:build !linux
+
+package scan
+
+import (
+	"fmt"
+	"net"
+
+	"atlas/internal/utils"
+)
+
+// arpSweep needs AF_PACKET sockets, which are Linux-only; other platforms use ICMP.
+func arpSweep(iface utils.InterfaceInfo, targets []net.IP, cfg DiscoveryConfig) (map[string]string, error) {
+	return nil, fmt.Errorf("ARP sweep is not supported on this platform")
+}
@@ -0,0 +1,100 @@
+package scan
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"atlas/internal/classify"
+	"atlas/internal/db"
+	"atlas/internal/utils"
+)
+
+// classifier returns the device classification rules: the built-in ones merged with
+// DEVICE_RULES_FILE (default /config/device_rules.yaml). A broken rules file is reported and the
+// built-in rules are used instead.
+func (s *Scanner) classifier() *classify.Classifier {
+	s.rulesOnce.Do(func() {
+		path := utils.EnvString("DEVICE_RULES_FILE", "/config/device_rules.yaml")
+		c, err := classify.Load(path)
+		if err != nil {
+			fmt.Printf("⚠️ Could not load device rules, using built-in rules: %v\n", err)
+			c, _ = classify.Load("")
+		}
+		s.rules = c
+	})
+	return s.rules
+}
+
+// openPortPattern matches one entry of the open_ports column, e.g. "22/tcp (ssh OpenSSH 8.9p1)".
+var openPortPattern = regexp.MustCompile(`(\d+/(?:tcp|udp|sctp))(?: \(([^ )]+)[^)]*\))?`)
+
+// hostEvidence builds classification evidence from a stored host: its name, OS and open ports, the
+// vendor of its MAC, whether it is its network's gateway, and what it announced over mDNS/SSDP.
+func hostEvidence(q db.DBTX, host db.HostState, announced Announcement) (classify.Evidence, error) {
+	var vendor, nextHop string
+	err := q.QueryRow(`SELECT COALESCE(vendor, ''), COALESCE(next_hop, '') FROM hosts WHERE id = ?`, host.ID).Scan(&vendor, &nextHop)
+	if err != nil {
+		return classify.Evidence{}, err
+	}
+	e := classify.Evidence{Vendor: vendor, Gateway: nextHop == host.IP, MDNS: announced.MDNS, SSDP: announced.SSDP}
+	if host.Name != "NoName" {
+		e.Hostname = host.Name
+	}
+	if host.OS != "Unknown" && host.OS != "" {
+		e.OS = append(e.OS, host.OS)
+	}
+	for _, m := range openPortPattern.FindAllStringSubmatch(host.OpenPorts, -1) {
+		e.Ports = append(e.Ports, m[1])
+		if m[2] != "" {
+			e.Services = append(e.Services, m[2])
+		}
+	}
+	return e, nil
+}
+
+// addNmapEvidence adds what a deep scan saw that the hosts row does not keep: every OS guess
+// with its classes and the service of each open port.
+func addNmapEvidence(e *classify.Evidence, h *NmapHost) {
+	if h == nil {
+		return
+	}
+	for _, m := range h.OSMatches {
+		e.OS = appendUnique(e.OS, m.Name)
+		for _, c := range m.Classes {
+			e.OS = appendUnique(e.OS, strings.TrimSpace(c.Vendor+" "+c.OSFamily))
+			if c.Type != "" {
+				e.OSTypes = appendUnique(e.OSTypes, c.Type)
+			}
+		}
+	}
+	for _, p := range h.OpenPorts() {
+		e.Ports = appendUnique(e.Ports, fmt.Sprintf("%d/%s", p.PortID, p.Protocol))
+		if p.Service.Name != "" {
+			e.Services = appendUnique(e.Services, p.Service.Name)
+		}
+	}
+}
+
+// storeDeviceType writes the classification of host id. With keepStronger a stored classification
+// of higher confidence is left alone, so a fast scan that only knows the vendor and name does not
+// overrule a deep scan's verdict.
+func storeDeviceType(q db.DBTX, id int64, r classify.Result, keepStronger bool) error {
+	query := `UPDATE hosts SET device_type = ?, device_confidence = ? WHERE id = ?`
+	args := []any{r.Type, r.Confidence, id}
+	if keepStronger {
+		query += ` AND (device_type IS NULL OR device_type = 'unknown' OR COALESCE(device_confidence, 0) <= ?)`
+		args = append(args, r.Confidence)
+	}
+	_, err := q.Exec(query, args...)
+	return err
+}
+
+// dockerEvidence builds classification evidence for a container from its image, name and ports.
+func dockerEvidence(c DockerContainer) classify.Evidence {
+	e := classify.Evidence{Container: true, Image: c.OS, Hostname: c.Name}
+	for _, m := range openPortPattern.FindAllStringSubmatch(c.Ports, -1) {
+		e.Ports = append(e.Ports, m[1])
+	}
+	return e
+}
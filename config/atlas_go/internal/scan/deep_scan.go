@@ -1,34 +1,34 @@
 package scan
 
 import (
-	"bufio"
+	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
 	"net"
 	"os"
-	"os/exec"
-	"regexp"
 	"strings"
 	"sync"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"atlas/internal/classify"
+	"atlas/internal/db"
 	"atlas/internal/utils"
 )
 
-// Use - for all ports (TCP/UDP)
+// Use - for all TCP ports; the optional UDP stage scans a short list instead (see udp.go)
 const tcpPortArg = "-"
-// const udpPortArg = "-" // UDP scan commented 
 
 type HostInfo struct {
 	IP            string
 	Name          string
 	InterfaceName string
+	Announced     Announcement
 }
 
 // Try NetBIOS (nbtscan) for hostname resolution
-func getNetBIOSName(ip string) string {
-	out, err := exec.Command("nbtscan", ip).Output()
+func (s *Scanner) getNetBIOSName(ip string) string {
+	out, err := s.Runner.Output(context.Background(), "nbtscan", ip)
 	if err != nil {
 		return ""
 	}
@@ -43,262 +43,576 @@ func getNetBIOSName(ip string) string {
 	return ""
 }
 
+// addressFamily returns "ipv6" for IPv6 addresses and "ipv4" otherwise.
+func addressFamily(ip string) string {
+	if strings.Contains(ip, ":") {
+		return "ipv6"
+	}
+	return "ipv4"
+}
+
 // Returns best available host name using nmap, reverse DNS, NetBIOS
-func bestHostName(ip string, nmapName string) string {
+func (s *Scanner) bestHostName(ip string, nmapName string) string {
 	if nmapName != "" && nmapName != "NoName" {
 		return nmapName
 	}
-	name := getHostName(ip)
+	name := getHostName(s.Runner, ip)
 	if name != "" && name != "NoName" {
 		return name
 	}
-	name = getNetBIOSName(ip)
+	name = s.getNetBIOSName(ip)
 	if name != "" {
 		return name
 	}
 	return "NoName"
 }
 
-func discoverLiveHosts(subnet string) ([]HostInfo, error) {
-	out, err := exec.Command("nmap", "-sn", subnet).Output()
+func discoverLiveHosts(discoverer Discoverer, target utils.ScanTarget, cfg DiscoveryConfig) ([]HostInfo, error) {
+	found, err := discoverer.Discover(target)
 	if err != nil {
 		return nil, err
 	}
+	addAnnouncements(found, target, cfg)
 	var hosts []HostInfo
-	for _, line := range strings.Split(string(out), "\n") {
-		if strings.HasPrefix(line, "Nmap scan report for") {
-			fields := strings.Fields(line)
-			if len(fields) == 6 && strings.HasPrefix(fields[5], "(") {
-				name := fields[4]
-				ip := strings.Trim(fields[5], "()")
-				hosts = append(hosts, HostInfo{IP: ip, Name: name})
-			} else if len(fields) == 5 {
-				ip := fields[4]
-				hosts = append(hosts, HostInfo{IP: ip, Name: "NoName"})
-			}
+	for ip, h := range found {
+		if target.Excluded(ip) {
+			continue
 		}
+		hosts = append(hosts, HostInfo{IP: ip, Name: h.Name, InterfaceName: target.Name, Announced: h.Announced})
 	}
 	return hosts, nil
 }
 
-// Parse nmap port string to human-readable form (show only open/filtered)
-func parseNmapPorts(s string) string {
-	parts := strings.Split(s, ",")
-	var readable []string
-	for _, p := range parts {
-		fields := strings.Split(p, "/")
-		if len(fields) < 5 {
-			continue
+// scanAllTcp runs the TCP port scan selected by cfg (all ports with OS detection by default)
+// against ip and returns the decoded nmap host entry (nil if nmap reported nothing for it).
+// nmap gives up on the host after cfg.HostTimeout; cancelling ctx kills the nmap process. The
+// XML is read from stdout and kept in the log directory for troubleshooting.
+func (s *Scanner) scanAllTcp(ctx context.Context, ip string, cfg DeepScanConfig) (*NmapHost, error) {
+	logFile := s.hostLogPath("tcp", ip)
+	var nmapArgs []string
+	if cfg.OSDetection {
+		nmapArgs = append(nmapArgs, "-O")
+	}
+	nmapArgs = append(nmapArgs, cfg.tcpPortArgs()...)
+	// ssh-hostkey/ssl-cert fingerprints identify the device across address changes
+	nmapArgs = append(nmapArgs, "--script", "ssh-hostkey,ssl-cert", ip, "-oX", "-")
+	nmapArgs = append(nmapArgs, cfg.nmapOptions(cfg.HostTimeout)...)
+	if strings.Contains(ip, ":") {
+		nmapArgs = append([]string{"-6"}, nmapArgs...)
+	}
+	out, _ := s.Runner.Output(ctx, "nmap", nmapArgs...)
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("TCP scan aborted: %v", ctx.Err())
+	}
+	_ = os.WriteFile(logFile, out, 0644)
+
+	run, err := parseNmapXML(bytes.NewReader(out))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse nmap output: %v", err)
+	}
+	return run.Host(strings.SplitN(ip, "%", 2)[0]), nil
+}
+
+// hostLogPath returns the file one host's nmap XML of the given kind is kept in, e.g.
+// nmap_tcp_192_168_1_5.xml.
+func (s *Scanner) hostLogPath(kind, ip string) string {
+	return s.logPath(fmt.Sprintf("nmap_%s_%s.xml", kind, strings.NewReplacer(".", "_", ":", "_", "%", "_").Replace(ip)))
+}
+
+func getHostName(r utils.Runner, ip string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	names, err := r.LookupAddr(ctx, ip)
+	if err != nil || len(names) == 0 {
+		return "NoName"
+	}
+	return strings.TrimSuffix(names[0], ".")
+}
+
+func (s *Scanner) getMacAddress(ip string) string {
+	if mac := utils.LookupMAC(s.Runner, ip); mac != "" {
+		return mac
+	}
+	return "Unknown"
+}
+
+// scanTarget returns the address to hand to nmap/ping for a host: IPv6 link-local
+// addresses are only reachable with their interface zone attached (fe80::1%eth0).
+func scanTarget(host HostInfo) string {
+	ip := net.ParseIP(host.IP)
+	if ip != nil && ip.To4() == nil && ip.IsLinkLocalUnicast() && host.InterfaceName != "" {
+		return host.IP + "%" + host.InterfaceName
+	}
+	return host.IP
+}
+
+// DeepScanConfig bounds the deep scan's resource usage and selects what it probes. A scan profile
+// (see profiles.go) overrides parts of it.
+type DeepScanConfig struct {
+	Profile     string        // name of the profile applied, recorded with the results
+	Concurrency int           // hosts scanned at once (one nmap process each)
+	HostTimeout time.Duration // give up on a single host after this long
+	TCPPorts    string        // "all", "top:N" (nmap --top-ports) or an nmap port list
+	OSDetection bool          // nmap -O
+	Timing      string        // nmap -T timing template for every nmap stage, nmap's default when empty
+	// ServiceDetection identifies the services on open ports: "nmap" (nmap -sV), "native"
+	// (built-in banner grabber) or "off" (nmap's guess from the port number)
+	ServiceDetection string
+	UDP              UDPScanConfig
+}
+
+// DeepScanConfigFromEnv reads DEEPSCAN_CONCURRENCY (default 4), DEEPSCAN_HOST_TIMEOUT (default 30m),
+// DEEPSCAN_SERVICE_DETECTION (default off) and the DEEPSCAN_UDP* settings. Every TCP port is
+// scanned with OS detection.
+func DeepScanConfigFromEnv() DeepScanConfig {
+	return DeepScanConfig{
+		Profile:          DefaultProfile,
+		Concurrency:      utils.EnvInt("DEEPSCAN_CONCURRENCY", 4),
+		HostTimeout:      utils.EnvDuration("DEEPSCAN_HOST_TIMEOUT", 30*time.Minute),
+		TCPPorts:         "all",
+		OSDetection:      true,
+		ServiceDetection: utils.EnvString("DEEPSCAN_SERVICE_DETECTION", "off"),
+		UDP:              UDPScanConfigFromEnv(),
+	}
+}
+
+// detectServices runs the configured service detection against the open ports of host.
+func (s *Scanner) detectServices(ctx context.Context, ip string, host *NmapHost, cfg DeepScanConfig) error {
+	switch cfg.ServiceDetection {
+	case "nmap":
+		return s.versionScan(ctx, ip, host, cfg)
+	case "native":
+		grabBanners(ctx, ip, host)
+	}
+	return nil
+}
+
+// deepScanResult is what a scan worker hands to the writer for one host.
+type deepScanResult struct {
+	Host     HostInfo
+	Name     string
+	MAC      string
+	Vendor   string
+	LocalMAC bool // locally administered (randomized, VM or container) MAC
+	Status   string
+	Nmap     *NmapHost // nil when nmap reported nothing for the host
+	Complete bool      // the TCP port scan finished
+	AllTCP   bool      // every TCP port was scanned, so with Complete the ones not reported are closed
+	// OSDetection is set when nmap -O ran, so an empty Nmap.OSMatches means no match rather than no probe
+	OSDetection bool
+	UDPPorts    []NmapPort // open ports found by the UDP stage
+	// UDPComplete is Complete for the UDP stage, so UDPPorts are all the open UDP ports
+	UDPComplete bool
+	Err         error // non-fatal scan error, logged by the writer
+	Duration    time.Duration
+}
+
+// hostScanFunc scans a single host. Workers run it concurrently, so it must not touch shared state.
+type hostScanFunc func(ctx context.Context, host HostInfo, cfg DeepScanConfig) deepScanResult
+
+// resultWriter persists a result. Only the pipeline's writer goroutine calls it.
+type resultWriter func(res deepScanResult) error
+
+// scanHost is the production hostScanFunc: nmap TCP/OS scan, MAC lookup and ping.
+func (s *Scanner) scanHost(ctx context.Context, host HostInfo, cfg DeepScanConfig) deepScanResult {
+	start := time.Now()
+	res := deepScanResult{Host: host}
+	// Use bestHostName for all fallback methods
+	res.Name = s.bestHostName(host.IP, host.Name)
+
+	// The context deadline is a hard stop slightly after nmap's own --host-timeout
+	hostCtx, cancel := context.WithTimeout(ctx, cfg.HostTimeout+time.Minute)
+	defer cancel()
+	target := scanTarget(host)
+	res.Nmap, res.Err = s.scanAllTcp(hostCtx, target, cfg)
+	res.Complete = res.Err == nil && res.Nmap != nil
+	res.AllTCP = cfg.allTCPPorts()
+	res.OSDetection = cfg.OSDetection
+	if res.Complete {
+		if err := s.detectServices(hostCtx, target, res.Nmap, cfg); err != nil {
+			res.Err = fmt.Errorf("service detection failed: %v", err)
 		}
-		state := fields[1]
-		proto := fields[2]
-		service := fields[4]
-		port := fields[0]
-		if state == "open" || state == "filtered" {
-			if service != "" {
-				readable = append(readable, fmt.Sprintf("%s/%s (%s)", port, proto, service))
-			} else {
-				readable = append(readable, fmt.Sprintf("%s/%s", port, proto))
+	}
+	res.MAC = s.getMacAddress(host.IP)
+	nmapVendor := ""
+	if res.Nmap != nil {
+		if mac, vendor := res.Nmap.MAC(); mac != "" {
+			nmapVendor = vendor
+			if res.MAC == "Unknown" {
+				res.MAC = strings.ToLower(mac)
 			}
 		}
 	}
-	if len(readable) == 0 {
-		return "Unknown"
+	res.Vendor, res.LocalMAC = s.macVendor(res.MAC)
+	if res.Vendor == "" {
+		res.Vendor = nmapVendor
 	}
-	return strings.Join(readable, ", ")
+	res.Status = utils.PingHost(s.Runner, target)
+	res.Duration = time.Since(start)
+	return res
 }
 
-func scanAllTcp(ip string, logProgress *os.File) (string, string) {
-	logFile := fmt.Sprintf("/config/logs/nmap_tcp_%s.log", strings.ReplaceAll(ip, ".", "_"))
-	nmapArgs := []string{"-O", "-p-", ip, "-oG", logFile}
-	start := time.Now()
-	cmd := exec.Command("nmap", nmapArgs...)
-	cmd.Run()
-	elapsed := time.Since(start)
-	fmt.Fprintf(logProgress, "TCP scan for %s finished in %s\n", ip, elapsed)
+// progressLog writes scan progress to a log file. A nil *progressLog (or nil file) discards output,
+// so a missing log directory never crashes a scan.
+type progressLog struct {
+	f *os.File
+}
 
-	file, err := os.Open(logFile)
+func openProgressLog(path string) *progressLog {
+	f, err := os.Create(path)
 	if err != nil {
-		return "Unknown", "Unknown"
+		fmt.Printf("⚠️ Could not create progress log %s: %v\n", path, err)
+		return &progressLog{}
 	}
-	defer file.Close()
+	return &progressLog{f: f}
+}
 
-	var ports string
-	var osInfo string
-	// Match all text between Ports: and Ignored State: 
-	rePorts := regexp.MustCompile(`Ports: ([^\n]*?)Ignored State:`)
-	reOS := regexp.MustCompile(`OS: (.*)`)
+func (p *progressLog) Printf(format string, args ...any) {
+	if p == nil || p.f == nil {
+		return
+	}
+	fmt.Fprintf(p.f, format, args...)
+}
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if m := rePorts.FindStringSubmatch(line); m != nil {
-			ports = parseNmapPorts(m[1])
-		}
-		if m := reOS.FindStringSubmatch(line); m != nil {
-			rawOs := m[1]
-			osInfo = strings.SplitN(rawOs, "\t", 2)[0]
-			if idx := strings.Index(osInfo, "Seq Index:"); idx != -1 {
-				osInfo = strings.TrimSpace(osInfo[:idx])
+func (p *progressLog) Close() error {
+	if p == nil || p.f == nil {
+		return nil
+	}
+	return p.f.Close()
+}
+
+// runDeepScanPipeline scans hosts with cfg.Concurrency workers. Workers only scan and send typed
+// results over a channel; the calling goroutine is the single consumer that writes results and the
+// progress log, so neither needs locking. It returns the ip|interface keys of the hosts written.
+func runDeepScanPipeline(ctx context.Context, hosts []HostInfo, cfg DeepScanConfig, scan hostScanFunc, write resultWriter, lf *progressLog) map[string]bool {
+	concurrency := cfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	// Producer
+	jobs := make(chan HostInfo)
+	go func() {
+		defer close(jobs)
+		for _, host := range hosts {
+			select {
+			case jobs <- host:
+			case <-ctx.Done():
+				return
 			}
-			osInfo = strings.TrimSpace(osInfo)
 		}
+	}()
+
+	// Scanners
+	results := make(chan deepScanResult)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for host := range jobs {
+				res := scan(ctx, host, cfg)
+				// A host interrupted by cancellation has no trustworthy result; drop it
+				if ctx.Err() != nil {
+					continue
+				}
+				results <- res
+			}
+		}()
 	}
-	if ports == "" {
-		ports = "Unknown"
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Writer
+	total := len(hosts)
+	written := make(map[string]bool)
+	done := 0
+	start := time.Now()
+	for res := range results {
+		ip := res.Host.IP
+		done++
+		if res.Err != nil {
+			lf.Printf("⚠️ Scan of %s incomplete: %v\n", ip, res.Err)
+		}
+		ports, osInfo := "Unknown", ""
+		if res.Nmap != nil {
+			ports = formatOpenPorts(res.Nmap.OpenPorts())
+			if best := res.Nmap.BestOS(); best != nil {
+				osInfo = best.Name
+			}
+		}
+		lf.Printf("Host %s: TCP ports: %s, OS: %s\n", ip, ports, osInfo)
+
+		if err := write(res); err != nil {
+			lf.Printf("❌ Update failed for %s on interface %s: %v\n", ip, res.Host.InterfaceName, err)
+		} else {
+			written[ip+"|"+res.Host.InterfaceName] = true
+		}
+
+		// ETA from throughput so far: with N workers, hosts complete out of order.
+		// Failed writes still count, or they would inflate the estimate
+		elapsed := time.Since(start)
+		estLeft := time.Duration(0)
+		if done > 0 {
+			estLeft = elapsed / time.Duration(done) * time.Duration(total-done)
+		}
+		lf.Printf("Host %s scanned in %s\n", ip, res.Duration.Round(time.Second))
+		lf.Printf("Progress: %d/%d hosts, elapsed: %s, estimated left: %s\n", done, total, elapsed.Round(time.Second), estLeft.Round(time.Second))
 	}
-	return ports, osInfo
+	return written
 }
 
-// func scanAllUdp(ip string, logProgress *os.File) string {
-// 	nmapArgs := []string{"-sU", "-p-", ip, "-oG", "/config/logs/nmap_udp.log"}
-// 	start := time.Now()
-// 	cmd := exec.Command("nmap", nmapArgs...)
-// 	cmd.Run()
-// 	elapsed := time.Since(start)
-// 	fmt.Fprintf(logProgress, "UDP scan for %s finished in %s\n", ip, elapsed)
-
-// 	file, err := os.Open("/config/logs/nmap_udp.log")
-// 	if err != nil {
-// 		return "Unknown"
-// 	}
-// 	defer file.Close()
-
-// 	var ports string
-// 	rePorts := regexp.MustCompile(`Ports: ([^ ]+)`)
-
-// 	scanner := bufio.NewScanner(file)
-// 	for scanner.Scan() {
-// 		line := scanner.Text()
-// 		if m := rePorts.FindStringSubmatch(line); m != nil {
-// 			ports = parseNmapPorts(m[1])
-// 		}
-// 	}
-// 	return ports
-// }
-
-func getHostName(ip string) string {
-	names, err := net.LookupAddr(ip)
-	if err != nil || len(names) == 0 {
-		return "NoName"
+// writeDeepScanResult upserts one host's deep scan result and its history in its own short
+// transaction, so a cancelled scan keeps everything written before it stopped.
+func writeDeepScanResult(conn *sql.DB, res deepScanResult, scan db.ScanRef, classifier *classify.Classifier) error {
+	// Only a finished scan of every TCP port knows the host's open ports: a profile that scans some
+	// of them (or a scan cut short) leaves open_ports and the port history as the last full scan left
+	// them. Likewise the OS columns only change when OS detection ran and matched something.
+	portsScanned := res.Complete && res.AllTCP
+	osDetected := res.OSDetection && res.Nmap != nil && len(res.Nmap.OSMatches) > 0
+	openPorts := "Unknown"
+	osInfo := ""
+	osAccuracy := 0
+	osGuesses := ""
+	var uptimeSeconds int64
+	lastBoot := ""
+	distance := 0
+	if portsScanned {
+		ports := res.Nmap.OpenPorts()
+		if res.UDPComplete {
+			ports = append(ports, res.UDPPorts...)
+		}
+		openPorts = formatOpenPorts(ports)
+	}
+	if osDetected {
+		if best := res.Nmap.BestOS(); best != nil {
+			osInfo = best.Name
+			osAccuracy = best.Accuracy
+		}
+		osGuesses = formatOSGuesses(res.Nmap.OSMatches)
+		if res.Nmap.Uptime != nil {
+			uptimeSeconds = res.Nmap.Uptime.Seconds
+			lastBoot = res.Nmap.Uptime.LastBoot
+		}
+		if res.Nmap.Distance != nil {
+			distance = res.Nmap.Distance.Value
+		}
 	}
-	return strings.TrimSuffix(names[0], ".")
-}
 
-func getMacAddress(ip string) string {
-	file, err := os.Open("/proc/net/arp")
+	tx, err := conn.Begin()
 	if err != nil {
-		return "Unknown"
+		return err
 	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	scanner.Scan() // Skip header
-	for scanner.Scan() {
-		fields := strings.Fields(scanner.Text())
-		if len(fields) >= 4 && fields[0] == ip {
-			return fields[3]
+	defer tx.Rollback()
+	prev, err := db.LoadHostState(tx, res.Host.IP, res.Host.InterfaceName)
+	if err != nil {
+		return err
+	}
+	enrichment := ""
+	if portsScanned {
+		enrichment += `
+			open_ports=excluded.open_ports,`
+	}
+	if osDetected {
+		enrichment += `
+			os_details=excluded.os_details,
+			os_accuracy=excluded.os_accuracy,
+			os_guesses=excluded.os_guesses,
+			uptime_seconds=excluded.uptime_seconds,
+			last_boot=excluded.last_boot,
+			distance=excluded.distance,`
+	}
+	if portsScanned || osDetected {
+		enrichment += `
+			scan_profile=excluded.scan_profile,`
+	}
+	_, err = tx.Exec(`
+		INSERT INTO hosts (ip, name, os_details, mac_address, open_ports, next_hop, network_name, interface_name, last_seen, online_status,
+			os_accuracy, os_guesses, uptime_seconds, last_boot, distance, address_family, last_scan_run_id, vendor, mac_local_admin, scan_profile)
+		VALUES (?, ?, ?, ?, ?, '', 'LAN', ?, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(ip, interface_name) DO UPDATE SET`+enrichment+`
+			name=excluded.name,
+			mac_address=CASE WHEN excluded.mac_address != 'Unknown' THEN excluded.mac_address ELSE hosts.mac_address END,
+			last_seen=CURRENT_TIMESTAMP,
+			online_status=excluded.online_status,
+			address_family=excluded.address_family,
+			last_scan_run_id=excluded.last_scan_run_id,
+			vendor=CASE WHEN excluded.mac_address != 'Unknown' THEN excluded.vendor ELSE hosts.vendor END,
+			mac_local_admin=CASE WHEN excluded.mac_address != 'Unknown' THEN excluded.mac_local_admin ELSE hosts.mac_local_admin END
+	`, res.Host.IP, res.Name, osInfo, res.MAC, openPorts, res.Host.InterfaceName, res.Status, osAccuracy, osGuesses, uptimeSeconds, lastBoot, distance, addressFamily(res.Host.IP), scan.RunIDValue(),
+		res.Vendor, res.LocalMAC, scan.Profile)
+	if err != nil {
+		return err
+	}
+	cur, err := db.LoadHostState(tx, res.Host.IP, res.Host.InterfaceName)
+	if err != nil || cur == nil {
+		return fmt.Errorf("failed to reload host: %v", err)
+	}
+	if err := db.RecordHostObservation(tx, prev, *cur, scan, true); err != nil {
+		return err
+	}
+	var fingerprints []string
+	if res.Nmap != nil {
+		fingerprints = res.Nmap.KeyFingerprints()
+	}
+	if _, err := db.LinkDevice(tx, *cur, fingerprints); err != nil {
+		return err
+	}
+	if portsScanned {
+		if err := db.SyncHostPorts(tx, db.PortsOfHost, cur.ID, []string{"tcp"}, hostPorts(res.Nmap, "tcp")); err != nil {
+			return err
 		}
 	}
-	return "Unknown"
+	if res.UDPComplete {
+		if err := db.SyncHostPorts(tx, db.PortsOfHost, cur.ID, []string{"udp"}, hostPorts(&NmapHost{Ports: res.UDPPorts}, "udp")); err != nil {
+			return err
+		}
+	}
+	evidence, err := hostEvidence(tx, *cur, res.Host.Announced)
+	if err != nil {
+		return err
+	}
+	addNmapEvidence(&evidence, res.Nmap)
+	addNmapEvidence(&evidence, &NmapHost{Ports: res.UDPPorts})
+	if err := storeDeviceType(tx, cur.ID, classifier.Classify(evidence), false); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func DeepScan() error {
-	// Get all network interfaces
-	interfaces, err := utils.GetAllInterfaces()
+// DeepScan port/OS-scans every live host with a bounded pool of workers, using the named scan
+// profile ("" for DEEPSCAN_PROFILE or the default). Cancelling ctx (SIGINT/SIGTERM in main) kills
+// the running nmap processes; hosts that finished before that keep their results, and the offline
+// sweep is skipped so unscanned hosts keep their status.
+func (s *Scanner) DeepScan(ctx context.Context, profile string) (err error) {
+	run := s.startRun("deepscan")
+	defer func() { run.Finish(err) }()
+	cfg, err := ResolveDeepScanConfig(profile)
 	if err != nil {
-		fmt.Printf("⚠️ Could not auto-detect interfaces: %v, using fallback\n", err)
+		return err
+	}
+	run.Profile = cfg.Profile
+	switch cfg.ServiceDetection {
+	case "nmap", "native", "off":
+	default:
+		return fmt.Errorf("unknown service detection %q (expected nmap, native or off)", cfg.ServiceDetection)
+	}
+
+	// Resolve scan targets (SCAN_SUBNETS / auto-detected interfaces, minus SCAN_EXCLUDE)
+	targets, err := utils.ResolveTargets(s.Runner)
+	if err != nil {
+		fmt.Printf("⚠️ Could not resolve scan targets: %v, using fallback\n", err)
 		// Fallback to default subnet if auto-detection fails
-		interfaces = []utils.InterfaceInfo{{Name: "unknown", Subnet: "192.168.2.0/24", IP: ""}}
+		targets = []utils.ScanTarget{{InterfaceInfo: utils.InterfaceInfo{Name: "unknown", Subnet: "192.168.2.0/24", IP: ""}}}
+	}
+
+	discoveryCfg := DiscoveryConfigFromEnv()
+	discoverer, err := s.NewDiscoverer(discoveryCfg)
+	if err != nil {
+		return err
 	}
-	
+
 	startTime := time.Now()
-	logFile := "/config/logs/deep_scan_progress.log"
-	lf, _ := os.Create(logFile)
+	lf := openProgressLog(s.logPath("deep_scan_progress.log"))
 	defer lf.Close()
 
 	var hostInfos []HostInfo
-	
-	// Discover live hosts on all interfaces
-	for _, iface := range interfaces {
-		fmt.Fprintf(lf, "Discovering live hosts on %s (interface: %s)...\n", iface.Subnet, iface.Name)
-		hosts, err := discoverLiveHosts(iface.Subnet)
+
+	// Discover live hosts on all targets
+	for _, target := range targets {
+		if ctx.Err() != nil {
+			break
+		}
+		run.Targets = append(run.Targets, target.Subnet)
+		lf.Printf("Discovering live hosts on %s (interface: %s)...\n", target.Subnet, target.Name)
+		hosts, err := discoverLiveHosts(discoverer, target, discoveryCfg)
 		if err != nil {
-			fmt.Fprintf(lf, "Failed to discover hosts on %s: %v\n", iface.Subnet, err)
+			lf.Printf("Failed to discover hosts on %s: %v\n", target.Subnet, err)
+			run.Warnf("discovery on %s failed: %v", target.Subnet, err)
 			continue
 		}
-		fmt.Fprintf(lf, "Discovered %d hosts on %s\n", len(hosts), iface.Subnet)
-		// Add interface name to each host
-		for _, host := range hosts {
-			host.InterfaceName = iface.Name
-			hostInfos = append(hostInfos, host)
-		}
+		lf.Printf("Discovered %d hosts on %s\n", len(hosts), target.Subnet)
+		hostInfos = append(hostInfos, hosts...)
 	}
-	
+
 	total := len(hostInfos)
-	fmt.Fprintf(lf, "Total discovered: %d hosts in %s\n", total, time.Since(startTime))
+	run.Found = total
+	lf.Printf("Total discovered: %d hosts in %s\n", total, time.Since(startTime))
+	lf.Printf("Scanning with profile %s: %d workers, per-host timeout %s\n", cfg.Profile, cfg.Concurrency, cfg.HostTimeout)
 
-	dbPath := "/config/db/atlas.db"
-	db, err := sql.Open("sqlite3", dbPath)
-	if err != nil {
-		fmt.Fprintf(lf, "Failed to open DB: %v\n", err)
-		return err
+	conn := s.Store.DB
+	scanRef := run.Ref()
+	s.vendors() // load once up front instead of from the first worker
+	classifier := s.classifier()
+	scanHost := s.scanHost
+	if cfg.UDP.Enabled {
+		lf.Printf("UDP stage enabled: ports %s, %d at once, per-host timeout %s\n", cfg.UDP.Ports, cfg.UDP.Concurrency, cfg.UDP.HostTimeout)
+		scanHost = s.withUDPStage(scanHost, cfg.UDP)
 	}
-	defer db.Close()
+	scanned := runDeepScanPipeline(ctx, hostInfos, cfg, scanHost, func(res deepScanResult) error {
+		return writeDeepScanResult(conn, res, scanRef, classifier)
+	}, lf)
+	run.Updated = len(scanned)
 
-	// Mark all hosts as offline before scanning
-	_, err = db.Exec("UPDATE hosts SET online_status = 'offline'")
-	if err != nil {
-		fmt.Fprintf(lf, "Failed to mark hosts as offline: %v\n", err)
+	if ctx.Err() != nil {
+		lf.Printf("Deep scan cancelled after %s: %d/%d hosts committed\n", time.Since(startTime), len(scanned), total)
+		return ctx.Err()
 	}
 
-	var wg sync.WaitGroup
-	for idx, host := range hostInfos {
-		wg.Add(1)
-		go func(idx int, host HostInfo) {
-			defer wg.Done()
-			hostStart := time.Now()
-			ip := host.IP
-			// Use bestHostName for all fallback methods
-			name := bestHostName(ip, host.Name)
-			fmt.Fprintf(lf, "Scanning host %d/%d: %s\n", idx+1, total, ip)
-
-			tcpPorts, osInfo := scanAllTcp(ip, lf)
-			mac := getMacAddress(ip)
-			status := utils.PingHost(ip)
-			elapsed := time.Since(startTime)
-			hostsLeft := total - (idx + 1)
-			estLeft := time.Duration(0)
-			if idx+1 > 0 {
-				estLeft = (elapsed / time.Duration(idx+1)) * time.Duration(hostsLeft)
-			}
-			fmt.Fprintf(lf, "Host %s: TCP ports: %s, OS: %s\n", ip, tcpPorts, osInfo)
-			fmt.Fprintf(lf, "Progress: %d/%d hosts, elapsed: %s, estimated left: %s\n", idx+1, total, elapsed, estLeft)
+	// Hosts the scan did not find are offline
+	if err := markUnscannedOffline(conn, scanned, scanRef); err != nil {
+		lf.Printf("Failed to mark hosts as offline: %v\n", err)
+		run.Warnf("offline sweep failed: %v", err)
+	}
 
-			openPorts := tcpPorts
-			if openPorts == "" {
-				openPorts = "Unknown"
-			}
+	lf.Printf("Deep scan complete in %s\n", time.Since(startTime))
+	return nil
+}
 
-			_, err = db.Exec(`
-				INSERT INTO hosts (ip, name, os_details, mac_address, open_ports, next_hop, network_name, interface_name, last_seen, online_status)
-				VALUES (?, ?, ?, ?, ?, '', 'LAN', ?, CURRENT_TIMESTAMP, ?)
-				ON CONFLICT(ip, interface_name) DO UPDATE SET
-					name=excluded.name,
-					os_details=excluded.os_details,
-					mac_address=excluded.mac_address,
-					open_ports=excluded.open_ports,
-					last_seen=CURRENT_TIMESTAMP,
-					online_status=excluded.online_status
-			`, ip, name, osInfo, mac, openPorts, host.InterfaceName, status)
-			if err != nil {
-				fmt.Fprintf(lf, "❌ Update failed for %s on interface %s: %v\n", ip, host.InterfaceName, err)
-			}
-			fmt.Fprintf(lf, "Host %s scanned in %s\n", ip, time.Since(hostStart))
-		}(idx, host)
+// markUnscannedOffline sets every host whose ip|interface key is not in scanned to offline and
+// records an offline event for those that were online.
+func markUnscannedOffline(conn *sql.DB, scanned map[string]bool, scan db.ScanRef) error {
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
 	}
-	wg.Wait()
+	defer tx.Rollback()
 
-	fmt.Fprintf(lf, "Deep scan complete in %s\n", time.Since(startTime))
-	return nil
-}
\ No newline at end of file
+	rows, err := tx.Query("SELECT id, ip, interface_name FROM hosts")
+	if err != nil {
+		return err
+	}
+	var stale []HostInfo
+	for rows.Next() {
+		var id int64
+		var ip, iface sql.NullString
+		if err := rows.Scan(&id, &ip, &iface); err != nil {
+			rows.Close()
+			return err
+		}
+		if !scanned[ip.String+"|"+iface.String] {
+			stale = append(stale, HostInfo{IP: ip.String, InterfaceName: iface.String})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, h := range stale {
+		prev, err := db.LoadHostState(tx, h.IP, h.InterfaceName)
+		if err != nil || prev == nil {
+			continue
+		}
+		if _, err := tx.Exec("UPDATE hosts SET online_status = 'offline' WHERE id = ?", prev.ID); err != nil {
+			return err
+		}
+		cur := *prev
+		cur.Status = "offline"
+		if err := db.RecordHostObservation(tx, prev, cur, scan, false); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,360 @@
+package scan
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"atlas/internal/db"
+	"atlas/internal/utils"
+)
+
+// newTestScanner returns a host-backed scanner on a fresh database and log directory in a temp directory.
+func newTestScanner(t *testing.T) *Scanner {
+	t.Helper()
+	dir := t.TempDir()
+	store, err := db.Open(filepath.Join(dir, "atlas.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if err := store.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	s := NewScanner(store, dir)
+	s.Version = "test"
+	return s
+}
+
+// fakeScanner stands in for a full scanHost: every host has ssh open and runs Linux. It counts the scans
+// per host and the most that ran at once.
+type fakeScanner struct {
+	delay time.Duration // how long each scan takes
+
+	mu        sync.Mutex
+	runs      map[string]int
+	active    int
+	maxActive int
+}
+
+func newFakeScanner(delay time.Duration) *fakeScanner {
+	return &fakeScanner{delay: delay, runs: make(map[string]int)}
+}
+
+func (f *fakeScanner) scan(ctx context.Context, host HostInfo, cfg DeepScanConfig) deepScanResult {
+	f.mu.Lock()
+	f.runs[host.IP]++
+	f.active++
+	if f.active > f.maxActive {
+		f.maxActive = f.active
+	}
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.active--
+		f.mu.Unlock()
+	}()
+
+	res := deepScanResult{Host: host, Name: "host-" + strings.ReplaceAll(host.IP, ".", "-") + ".lan", MAC: "52:54:00:00:00:01"}
+	select {
+	case <-time.After(f.delay):
+	case <-ctx.Done():
+		res.Err = ctx.Err()
+		return res
+	}
+	res.Status = "online"
+	res.Complete, res.AllTCP, res.OSDetection = true, true, true
+	res.Nmap = &NmapHost{
+		Addresses: []NmapAddress{{Addr: host.IP, AddrType: "ipv4"}},
+		Ports:     []NmapPort{{Protocol: "tcp", PortID: 22, State: NmapState{State: "open"}, Service: NmapService{Name: "ssh"}}},
+		OSMatches: []NmapOSMatch{{Name: "Linux 5.0 - 5.14", Accuracy: 95}},
+	}
+	return res
+}
+
+func testHosts(n int) []HostInfo {
+	hosts := make([]HostInfo, n)
+	for i := range hosts {
+		hosts[i] = HostInfo{IP: fmt.Sprintf("192.168.50.%d", i+1), InterfaceName: "eth0"}
+	}
+	return hosts
+}
+
+// TestDeepScanPipeline scans many hosts at once into a real database; run it with -race to check
+// that workers share nothing but the result channel.
+func TestDeepScanPipeline(t *testing.T) {
+	s := newTestScanner(t)
+	conn := s.Store.DB
+	classifier := s.classifier()
+	scanner := newFakeScanner(time.Millisecond)
+	cfg := DeepScanConfig{Concurrency: 16, HostTimeout: time.Minute}
+	hosts := testHosts(120)
+
+	lf := openProgressLog(filepath.Join(t.TempDir(), "progress.log"))
+	defer lf.Close()
+	written := runDeepScanPipeline(context.Background(), hosts, cfg, scanner.scan, func(res deepScanResult) error {
+		return writeDeepScanResult(conn, res, db.ScanRef{Type: "deepscan"}, classifier)
+	}, lf)
+
+	if len(written) != len(hosts) {
+		t.Fatalf("pipeline wrote %d hosts, want %d", len(written), len(hosts))
+	}
+	for _, h := range hosts {
+		if !written[h.IP+"|"+h.InterfaceName] {
+			t.Errorf("%s was not written", h.IP)
+		}
+	}
+
+	scanner.mu.Lock()
+	for ip, n := range scanner.runs {
+		if n != 1 {
+			t.Errorf("%s was scanned %d times", ip, n)
+		}
+	}
+	if len(scanner.runs) != len(hosts) {
+		t.Errorf("%d hosts scanned, want %d", len(scanner.runs), len(hosts))
+	}
+	if scanner.maxActive > cfg.Concurrency {
+		t.Errorf("%d scans ran at once, want at most %d", scanner.maxActive, cfg.Concurrency)
+	}
+	scanner.mu.Unlock()
+
+	var rows, named, scanned int
+	err := conn.QueryRow(`SELECT COUNT(*), COUNT(CASE WHEN name LIKE 'host-%.lan' THEN 1 END),
+		COUNT(CASE WHEN open_ports = '22/tcp (ssh)' AND os_details = 'Linux 5.0 - 5.14' AND online_status = 'online' THEN 1 END)
+		FROM hosts`).Scan(&rows, &named, &scanned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows != len(hosts) || named != len(hosts) || scanned != len(hosts) {
+		t.Errorf("hosts table: %d rows, %d named, %d with the scan's ports and OS; want %d of each", rows, named, scanned, len(hosts))
+	}
+}
+
+// TestDeepScanPipelineCancel cancels the scan part way through: the pipeline must return, drop the
+// results of scans interrupted by the cancellation and keep those written before it.
+func TestDeepScanPipelineCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const concurrency = 8
+	hosts := testHosts(200)
+	scan := func(ctx context.Context, host HostInfo, cfg DeepScanConfig) deepScanResult {
+		select {
+		case <-time.After(time.Millisecond):
+		case <-ctx.Done():
+		}
+		return deepScanResult{Host: host}
+	}
+	var writes int
+	write := func(res deepScanResult) error {
+		writes++
+		if writes == 10 {
+			cancel()
+		}
+		return nil
+	}
+
+	done := make(chan map[string]bool)
+	go func() {
+		done <- runDeepScanPipeline(ctx, hosts, DeepScanConfig{Concurrency: concurrency}, scan, write, nil)
+	}()
+	select {
+	case written := <-done:
+		// Scans that finished before the cancellation may still be waiting for the writer
+		if len(written) < 10 || len(written) > 10+concurrency {
+			t.Errorf("pipeline wrote %d hosts after cancelling at 10, want at most %d more", len(written), concurrency)
+		}
+		if len(written) != writes {
+			t.Errorf("pipeline reported %d hosts written, the writer saw %d", len(written), writes)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("pipeline did not return after cancellation")
+	}
+}
+
+func TestDeepScanPipelineWriteErrors(t *testing.T) {
+	hosts := testHosts(20)
+	scan := func(ctx context.Context, host HostInfo, cfg DeepScanConfig) deepScanResult {
+		return deepScanResult{Host: host}
+	}
+	write := func(res deepScanResult) error {
+		if strings.HasSuffix(res.Host.IP, "5") {
+			return errors.New("database is locked")
+		}
+		return nil
+	}
+	logPath := filepath.Join(t.TempDir(), "progress.log")
+	lf := openProgressLog(logPath)
+	written := runDeepScanPipeline(context.Background(), hosts, DeepScanConfig{Concurrency: 4}, scan, write, lf)
+	lf.Close()
+
+	if len(written) != 18 || written["192.168.50.5|eth0"] || written["192.168.50.15|eth0"] {
+		t.Errorf("written = %v, want every host but .5 and .15", written)
+	}
+	logged, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(logged), "❌ Update failed for 192.168.50.5 on interface eth0: database is locked") {
+		t.Errorf("progress log does not report the failed write:\n%s", logged)
+	}
+}
+
+// hostScanState returns what a deep scan records about ip: its hosts row, open port rows and events.
+func hostScanState(t *testing.T, conn *sql.DB, ip string) []string {
+	t.Helper()
+	var state []string
+	queries := []string{
+		`SELECT open_ports || ' | ' || os_details || ' | ' || os_accuracy || ' | ' || os_guesses || ' | ' || scan_profile FROM hosts WHERE ip = ?`,
+		`SELECT p.port || '/' || p.protocol || ' ' || p.state FROM host_ports p JOIN hosts h ON h.id = p.host_id
+			WHERE p.host_kind = 'host' AND h.ip = ? ORDER BY p.port`,
+		`SELECT event_type || ' ' || COALESCE(old_value, '') || ' -> ' || COALESCE(new_value, '') FROM host_events WHERE ip = ? ORDER BY id`,
+	}
+	for _, q := range queries {
+		rows, err := conn.Query(q, ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+			var s string
+			if err := rows.Scan(&s); err != nil {
+				t.Fatal(err)
+			}
+			state = append(state, s)
+		}
+		rows.Close()
+	}
+	return state
+}
+
+// TestDeepScanPartialProfiles follows a full scan with a scan under each profile that covers fewer
+// ports: it finds only one of the open ports and, without nmap -O or a match, no OS. The host must
+// keep the full scan's ports, port rows and OS, and no port may be reported closed.
+func TestDeepScanPartialProfiles(t *testing.T) {
+	profiles, err := LoadProfiles("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := HostInfo{IP: "192.168.50.1", InterfaceName: "eth0"}
+	ssh := NmapPort{Protocol: "tcp", PortID: 22, State: NmapState{State: "open"}, Service: NmapService{Name: "ssh"}}
+	smb := NmapPort{Protocol: "tcp", PortID: 445, State: NmapState{State: "open"}, Service: NmapService{Name: "microsoft-ds"}}
+
+	for _, name := range []string{"quick", "standard", "stealth"} {
+		t.Run(name, func(t *testing.T) {
+			s := newTestScanner(t)
+			conn := s.Store.DB
+			classifier := s.classifier()
+
+			full := deepScanResult{Host: host, Name: "nas.lan", MAC: "52:54:00:00:00:01", Status: "online",
+				Complete: true, AllTCP: true, OSDetection: true, Nmap: &NmapHost{
+					Ports:     []NmapPort{ssh, smb},
+					OSMatches: []NmapOSMatch{{Name: "Linux 5.0 - 5.14", Accuracy: 95}},
+				}}
+			if err := writeDeepScanResult(conn, full, db.ScanRef{Type: "deepscan", Profile: "full"}, classifier); err != nil {
+				t.Fatal(err)
+			}
+			want := hostScanState(t, conn, host.IP)
+
+			var cfg DeepScanConfig
+			profiles[name].Apply(&cfg)
+			partial := deepScanResult{Host: host, Name: "nas.lan", MAC: "52:54:00:00:00:01", Status: "online",
+				Complete: true, AllTCP: cfg.allTCPPorts(), OSDetection: cfg.OSDetection, Nmap: &NmapHost{Ports: []NmapPort{ssh}}}
+			if err := writeDeepScanResult(conn, partial, db.ScanRef{Type: "deepscan", Profile: name}, classifier); err != nil {
+				t.Fatal(err)
+			}
+			if got := hostScanState(t, conn, host.IP); !reflect.DeepEqual(got, want) {
+				t.Errorf("after the %s scan:\n%s\nwant\n%s", name, strings.Join(got, "\n"), strings.Join(want, "\n"))
+			}
+		})
+	}
+}
+
+// TestDeepScanUDPStage writes the UDP stage's result after a TCP scan that finished and after one
+// that failed, on a host a full scan found with 22/tcp, 445/tcp and 123/udp open. The UDP ports are
+// synced either way; open_ports and the TCP ports only change when the TCP scan finished.
+func TestDeepScanUDPStage(t *testing.T) {
+	const ip = "192.168.50.1"
+	ssh := NmapPort{Protocol: "tcp", PortID: 22, State: NmapState{State: "open"}, Service: NmapService{Name: "ssh"}}
+	smb := NmapPort{Protocol: "tcp", PortID: 445, State: NmapState{State: "open"}, Service: NmapService{Name: "microsoft-ds"}}
+	ntp := NmapPort{Protocol: "udp", PortID: 123, State: NmapState{State: "open"}, Service: NmapService{Name: "ntp"}}
+	udpXML := `<nmaprun><host><address addr="` + ip + `" addrtype="ipv4"/><ports>
+		<port protocol="udp" portid="53"><state state="open"/><service name="domain"/></port>
+		<port protocol="udp" portid="161"><state state="open|filtered"/><service name="snmp"/></port>
+	</ports></host></nmaprun>`
+
+	tests := []struct {
+		name string
+		tcp  deepScanResult
+		want []string
+	}{
+		{
+			name: "tcp finished",
+			tcp:  deepScanResult{Complete: true, AllTCP: true, Nmap: &NmapHost{Ports: []NmapPort{ssh}}},
+			want: []string{
+				"22/tcp (ssh), 53/udp (domain) |  | 0 |  | ",
+				"22/tcp open", "53/udp open", "123/udp closed", "445/tcp closed",
+			},
+		},
+		{
+			name: "tcp failed",
+			tcp:  deepScanResult{Err: errors.New("aborted: context deadline exceeded")},
+			want: []string{
+				"22/tcp (ssh), 445/tcp (microsoft-ds), 123/udp (ntp) |  | 0 |  | ",
+				"22/tcp open", "53/udp open", "123/udp closed", "445/tcp open",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestScanner(t)
+			dir := t.TempDir()
+			s.Runner = utils.ReplayRunner{Dir: dir}
+			cfg := DeepScanConfig{UDP: UDPScanConfig{Enabled: true, Ports: "53,161", Concurrency: 1, HostTimeout: time.Minute}}
+			key := utils.CommandKey("nmap", "-sU", "-Pn", "-p", "U:53,161", ip, "-oX", "-", "--host-timeout", "60s")
+			if err := os.WriteFile(filepath.Join(dir, key+".out"), []byte(udpXML), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			conn := s.Store.DB
+			classifier := s.classifier()
+			host := HostInfo{IP: ip, InterfaceName: "eth0"}
+
+			full := deepScanResult{Host: host, Name: "nas.lan", Status: "online", Complete: true, AllTCP: true,
+				Nmap: &NmapHost{Ports: []NmapPort{ssh, smb}}, UDPPorts: []NmapPort{ntp}, UDPComplete: true}
+			if err := writeDeepScanResult(conn, full, db.ScanRef{Type: "deepscan"}, classifier); err != nil {
+				t.Fatal(err)
+			}
+
+			scan := s.withUDPStage(func(ctx context.Context, host HostInfo, cfg DeepScanConfig) deepScanResult {
+				res := tt.tcp
+				res.Host, res.Name, res.Status = host, "nas.lan", "online"
+				return res
+			}, cfg.UDP)
+			res := scan(context.Background(), host, cfg)
+			if !res.UDPComplete || !reflect.DeepEqual(res.Nmap, tt.tcp.Nmap) {
+				t.Fatalf("UDP stage result: complete %v, nmap %+v; want the TCP scan's nmap result untouched", res.UDPComplete, res.Nmap)
+			}
+			if err := writeDeepScanResult(conn, res, db.ScanRef{Type: "deepscan"}, classifier); err != nil {
+				t.Fatal(err)
+			}
+			got := hostScanState(t, conn, ip)
+			var rows []string
+			for _, row := range got {
+				if !strings.HasPrefix(row, "first_seen") && !strings.HasPrefix(row, "port_") {
+					rows = append(rows, row)
+				}
+			}
+			if !reflect.DeepEqual(rows, tt.want) {
+				t.Errorf("host state:\n%s\nwant\n%s", strings.Join(rows, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package scan
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"atlas/internal/utils"
+)
+
+// Discoverer finds live hosts on a target subnet and returns them keyed by IP.
+// Excluded addresses are never probed. IPv6 prefixes are always discovered through
+// neighbor discovery, whichever backend is selected.
+type Discoverer interface {
+	Discover(target utils.ScanTarget) (map[string]DiscoveredHost, error)
+}
+
+// DiscoveredHost is a live host as seen by discovery.
+type DiscoveredHost struct {
+	Name   string // reverse DNS name, "NoName" when there is none
+	MAC    string // link-layer address, "" when discovery could not see it (routed subnets, ICMP)
+	Vendor string // MAC vendor reported by the discovery tool, if any
+	// Announced holds the host's mDNS/SSDP answers, filled in by addAnnouncements
+	Announced Announcement
+}
+
+// DiscoveryConfig selects and tunes the host discovery backend.
+type DiscoveryConfig struct {
+	Backend     string        // "nmap", "native" or "auto" (nmap when installed, native otherwise)
+	Concurrency int           // probes in flight at once
+	Timeout     time.Duration // how long to wait for a reply per probe
+	Retries     int           // extra probes sent to hosts that did not answer
+	// AnnounceTimeout is how long to collect mDNS/SSDP answers after discovery (0 disables the probe)
+	AnnounceTimeout time.Duration
+}
+
+// DiscoveryConfigFromEnv reads DISCOVERY_BACKEND, DISCOVERY_CONCURRENCY, DISCOVERY_TIMEOUT, DISCOVERY_RETRIES
+// and DISCOVERY_ANNOUNCE_TIMEOUT; DISCOVERY_ANNOUNCE=false turns the mDNS/SSDP probe off.
+func DiscoveryConfigFromEnv() DiscoveryConfig {
+	cfg := DiscoveryConfig{
+		Backend:         utils.EnvString("DISCOVERY_BACKEND", "auto"),
+		Concurrency:     utils.EnvInt("DISCOVERY_CONCURRENCY", 128),
+		Timeout:         utils.EnvDuration("DISCOVERY_TIMEOUT", time.Second),
+		Retries:         utils.EnvInt("DISCOVERY_RETRIES", 1),
+		AnnounceTimeout: utils.EnvDuration("DISCOVERY_ANNOUNCE_TIMEOUT", 2*time.Second),
+	}
+	if !utils.EnvBool("DISCOVERY_ANNOUNCE", true) {
+		cfg.AnnounceTimeout = 0
+	}
+	return cfg
+}
+
+// addAnnouncements probes target for mDNS/SSDP announcements and attaches them to the discovered
+// hosts. Responders discovery missed are not added. The probe is best effort; a failure is only logged.
+func addAnnouncements(hosts map[string]DiscoveredHost, target utils.ScanTarget, cfg DiscoveryConfig) {
+	found, err := probeAnnouncements(target, cfg.AnnounceTimeout)
+	if err != nil {
+		fmt.Printf("⚠️ mDNS/SSDP probe on %s failed: %v\n", target.Subnet, err)
+		return
+	}
+	for ip, a := range found {
+		if h, ok := hosts[ip]; ok {
+			h.Announced = *a
+			hosts[ip] = h
+		}
+	}
+}
+
+// NewDiscoverer returns the discovery backend selected by cfg, running commands through the scanner's Runner.
+func (s *Scanner) NewDiscoverer(cfg DiscoveryConfig) (Discoverer, error) {
+	switch cfg.Backend {
+	case "nmap":
+		return NmapDiscoverer{Config: cfg, Scanner: s}, nil
+	case "native":
+		return &NativeDiscoverer{Config: cfg, Runner: s.Runner}, nil
+	case "auto", "":
+		if _, err := s.Runner.LookPath("nmap"); err == nil {
+			return NmapDiscoverer{Config: cfg, Scanner: s}, nil
+		}
+		return &NativeDiscoverer{Config: cfg, Runner: s.Runner}, nil
+	default:
+		return nil, fmt.Errorf("unknown discovery backend %q (expected nmap, native or auto)", cfg.Backend)
+	}
+}
+
+// NmapDiscoverer discovers hosts with an `nmap -sn` ping sweep.
+type NmapDiscoverer struct {
+	Config  DiscoveryConfig
+	Scanner *Scanner
+}
+
+func (d NmapDiscoverer) Discover(target utils.ScanTarget) (map[string]DiscoveredHost, error) {
+	if target.IsIPv6() {
+		return ndpDiscover(d.Scanner.Runner, target, d.Config)
+	}
+	return d.Scanner.runNmap(target.Subnet, target.ExcludeList())
+}
+
+// NativeDiscoverer discovers hosts without external tools: an ARP sweep when the subnet is
+// directly attached to the interface, ICMP echo otherwise (or when ARP is not permitted).
+type NativeDiscoverer struct {
+	Config DiscoveryConfig
+	Runner utils.Runner // used to read the neighbor table for IPv6
+
+	// The sweeps need raw sockets; nil means arpSweep and icmpSweep. Tests replace them.
+	arp  func(iface utils.InterfaceInfo, targets []net.IP, cfg DiscoveryConfig) (map[string]string, error)
+	icmp func(targets []net.IP, cfg DiscoveryConfig) ([]string, error)
+}
+
+func (d *NativeDiscoverer) Discover(target utils.ScanTarget) (map[string]DiscoveredHost, error) {
+	if target.IsIPv6() {
+		return ndpDiscover(d.Runner, target, d.Config)
+	}
+	iface := target.InterfaceInfo
+	hosts, err := subnetHosts(iface.Subnet, isAttached(iface))
+	if err != nil {
+		return nil, err
+	}
+	var targets []net.IP
+	for _, ip := range hosts {
+		if !target.Excluded(ip.String()) {
+			targets = append(targets, ip)
+		}
+	}
+
+	arp, icmp := d.arp, d.icmp
+	if arp == nil {
+		arp = arpSweep
+	}
+	if icmp == nil {
+		icmp = icmpSweep
+	}
+
+	var alive []string
+	var macs map[string]string
+	if isAttached(iface) {
+		replies, err := arp(iface, targets, d.Config)
+		if err != nil {
+			fmt.Printf("⚠️ ARP sweep on %s failed, falling back to ICMP: %v\n", iface.Name, err)
+		} else {
+			alive = make([]string, 0, len(replies))
+			for ip := range replies {
+				alive = append(alive, ip)
+			}
+			macs = replies
+		}
+	}
+	if alive == nil {
+		alive, err = icmp(targets, d.Config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// nmap reports the scanning host itself; keep that behaviour so the local node stays on the map.
+	if isAttached(iface) && !contains(alive, iface.IP) && !target.Excluded(iface.IP) {
+		alive = append(alive, iface.IP)
+	}
+
+	return withMACs(resolveNames(d.Runner, alive, d.Config.Concurrency), macs), nil
+}
+
+// withMACs turns ip -> name into discovered hosts carrying the MACs known for them.
+func withMACs(names map[string]string, macs map[string]string) map[string]DiscoveredHost {
+	hosts := make(map[string]DiscoveredHost, len(names))
+	for ip, name := range names {
+		hosts[ip] = DiscoveredHost{Name: name, MAC: macs[ip]}
+	}
+	return hosts
+}
+
+// subnetHosts lists the addresses of an IPv4 CIDR. For an attached network the network and
+// broadcast addresses are skipped (below /31); blocks carved out of address ranges keep them.
+func subnetHosts(subnet string, attached bool) ([]net.IP, error) {
+	_, ipNet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subnet %q: %v", subnet, err)
+	}
+	base := ipNet.IP.To4()
+	if base == nil {
+		return nil, fmt.Errorf("native discovery only supports IPv4 subnets, got %s", subnet)
+	}
+	ones, bits := ipNet.Mask.Size()
+	if bits-ones > 16 {
+		return nil, fmt.Errorf("subnet %s is too large for native discovery (max /16)", subnet)
+	}
+	size := uint32(1) << uint(bits-ones)
+	start := binary.BigEndian.Uint32(base)
+
+	first, last := uint32(0), size-1
+	if attached && size > 2 {
+		first, last = 1, size-2
+	}
+	hosts := make([]net.IP, 0, last-first+1)
+	for off := first; off <= last; off++ {
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, start+off)
+		hosts = append(hosts, ip)
+	}
+	return hosts, nil
+}
+
+// isAttached reports whether the interface has an address inside the subnet it is scanning.
+func isAttached(iface utils.InterfaceInfo) bool {
+	ip := net.ParseIP(iface.IP)
+	_, ipNet, err := net.ParseCIDR(iface.Subnet)
+	return ip != nil && err == nil && ipNet.Contains(ip)
+}
+
+// resolveNames reverse-resolves hosts with at most concurrency lookups in flight.
+func resolveNames(r utils.Runner, ips []string, concurrency int) map[string]string {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	hosts := make(map[string]string, len(ips))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for _, ip := range ips {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(ip string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			name := getHostName(r, ip)
+			mu.Lock()
+			hosts[ip] = name
+			mu.Unlock()
+		}(ip)
+	}
+	wg.Wait()
+	return hosts
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
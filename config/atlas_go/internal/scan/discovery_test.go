@@ -0,0 +1,246 @@
+package scan
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"atlas/internal/utils"
+)
+
+// discoveryRunner replays the recorded nmap sweeps, neighbor table and reverse DNS names under
+// testdata/discovery.
+var discoveryRunner = utils.ReplayRunner{Dir: filepath.Join("testdata", "discovery")}
+
+func testTarget(name, subnet, ip string, exclude ...string) utils.ScanTarget {
+	target := utils.ScanTarget{InterfaceInfo: utils.InterfaceInfo{Name: name, Subnet: subnet, IP: ip}}
+	for _, e := range exclude {
+		target.Exclude = append(target.Exclude, netip.MustParsePrefix(e))
+	}
+	return target
+}
+
+// ndpTarget is an IPv6 prefix on an interface that does not exist, so the multicast echo fails
+// and discovery falls back to the recorded neighbor table.
+var ndpTarget = testTarget("eth-test", "2001:db8:1::/64", "2001:db8:1::5", "2001:db8:1::99/128")
+
+var ndpHosts = map[string]DiscoveredHost{
+	"2001:db8:1::1":  {Name: "NoName", MAC: "00:11:32:aa:bb:cc"},
+	"2001:db8:1::20": {Name: "printer.lan", MAC: "00:1b:a9:01:02:03"},
+	"2001:db8:1::5":  {Name: "NoName"},
+}
+
+func TestNmapDiscoverer(t *testing.T) {
+	d := NmapDiscoverer{Scanner: &Scanner{Runner: discoveryRunner}}
+
+	hosts, err := d.Discover(testTarget("eth0", "192.168.1.0/24", "192.168.1.5", "192.168.1.50/32"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]DiscoveredHost{
+		"192.168.1.1":  {Name: "router.lan", MAC: "00:11:32:aa:bb:cc", Vendor: "Synology Incorporated"},
+		"192.168.1.10": {Name: "NoName", MAC: "52:54:00:12:34:56", Vendor: "QEMU virtual NIC"},
+		"192.168.1.5":  {Name: "atlas.lan"},
+	}
+	if !reflect.DeepEqual(hosts, want) {
+		t.Errorf("Discover(192.168.1.0/24) = %+v, want %+v", hosts, want)
+	}
+
+	if _, err := d.Discover(testTarget("eth1", "10.20.0.0/24", "10.20.0.2")); err == nil {
+		t.Error("Discover(10.20.0.0/24) succeeded although nmap failed")
+	}
+
+	hosts, err = d.Discover(ndpTarget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(hosts, ndpHosts) {
+		t.Errorf("Discover(%s) = %+v, want %+v", ndpTarget.Subnet, hosts, ndpHosts)
+	}
+}
+
+// fakeSweeps stands in for the ARP and ICMP sweeps of NativeDiscoverer.
+type fakeSweeps struct {
+	arpReplies map[string]string
+	arpErr     error
+	icmpAlive  []string
+	icmpErr    error
+
+	mu          sync.Mutex
+	arpTargets  []string
+	icmpTargets []string
+}
+
+func (f *fakeSweeps) arp(iface utils.InterfaceInfo, targets []net.IP, cfg DiscoveryConfig) (map[string]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.arpTargets = ipStrings(targets)
+	return f.arpReplies, f.arpErr
+}
+
+func (f *fakeSweeps) icmp(targets []net.IP, cfg DiscoveryConfig) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.icmpTargets = ipStrings(targets)
+	return f.icmpAlive, f.icmpErr
+}
+
+func (f *fakeSweeps) discoverer() *NativeDiscoverer {
+	return &NativeDiscoverer{Config: DiscoveryConfig{Concurrency: 4}, Runner: discoveryRunner, arp: f.arp, icmp: f.icmp}
+}
+
+func ipStrings(ips []net.IP) []string {
+	var s []string
+	for _, ip := range ips {
+		s = append(s, ip.String())
+	}
+	return s
+}
+
+// The native tests use the RFC 5737 documentation ranges, which have no recorded reverse DNS names.
+func TestNativeDiscoverer(t *testing.T) {
+	attached := testTarget("eth0", "198.51.100.0/29", "198.51.100.5", "198.51.100.3/32")
+	routed := testTarget("eth0", "203.0.113.0/30", "198.51.100.5")
+	sweepErr := errors.New("operation not permitted")
+	attachedHosts := []string{"198.51.100.1", "198.51.100.2", "198.51.100.4", "198.51.100.5", "198.51.100.6"}
+	routedHosts := []string{"203.0.113.0", "203.0.113.1", "203.0.113.2", "203.0.113.3"}
+
+	tests := []struct {
+		name        string
+		target      utils.ScanTarget
+		sweeps      *fakeSweeps
+		want        map[string]DiscoveredHost
+		wantErr     bool
+		arpTargets  []string
+		icmpTargets []string
+	}{
+		{
+			name:   "arp on an attached subnet",
+			target: attached,
+			sweeps: &fakeSweeps{arpReplies: map[string]string{"198.51.100.1": "00:11:32:aa:bb:cc", "198.51.100.6": "52:54:00:12:34:56"}},
+			want: map[string]DiscoveredHost{
+				"198.51.100.1": {Name: "NoName", MAC: "00:11:32:aa:bb:cc"},
+				"198.51.100.6": {Name: "NoName", MAC: "52:54:00:12:34:56"},
+				"198.51.100.5": {Name: "NoName"},
+			},
+			arpTargets: attachedHosts,
+		},
+		{
+			name:   "icmp when arp fails",
+			target: attached,
+			sweeps: &fakeSweeps{arpErr: sweepErr, icmpAlive: []string{"198.51.100.1", "198.51.100.5"}},
+			want: map[string]DiscoveredHost{
+				"198.51.100.1": {Name: "NoName"},
+				"198.51.100.5": {Name: "NoName"},
+			},
+			arpTargets:  attachedHosts,
+			icmpTargets: attachedHosts,
+		},
+		{
+			name:        "icmp on a routed subnet",
+			target:      routed,
+			sweeps:      &fakeSweeps{icmpAlive: []string{"203.0.113.1"}},
+			want:        map[string]DiscoveredHost{"203.0.113.1": {Name: "NoName"}},
+			icmpTargets: routedHosts,
+		},
+		{
+			name:        "icmp failure",
+			target:      routed,
+			sweeps:      &fakeSweeps{icmpErr: sweepErr},
+			wantErr:     true,
+			icmpTargets: routedHosts,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hosts, err := tt.sweeps.discoverer().Discover(tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Discover() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(hosts, tt.want) {
+				t.Errorf("Discover() = %+v, want %+v", hosts, tt.want)
+			}
+			if !reflect.DeepEqual(tt.sweeps.arpTargets, tt.arpTargets) {
+				t.Errorf("ARP probed %v, want %v", tt.sweeps.arpTargets, tt.arpTargets)
+			}
+			if !reflect.DeepEqual(tt.sweeps.icmpTargets, tt.icmpTargets) {
+				t.Errorf("ICMP probed %v, want %v", tt.sweeps.icmpTargets, tt.icmpTargets)
+			}
+		})
+	}
+}
+
+func TestNativeDiscovererIPv6(t *testing.T) {
+	sweeps := &fakeSweeps{}
+	hosts, err := sweeps.discoverer().Discover(ndpTarget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(hosts, ndpHosts) {
+		t.Errorf("Discover(%s) = %+v, want %+v", ndpTarget.Subnet, hosts, ndpHosts)
+	}
+	if sweeps.arpTargets != nil || sweeps.icmpTargets != nil {
+		t.Errorf("IPv6 discovery swept %v %v", sweeps.arpTargets, sweeps.icmpTargets)
+	}
+}
+
+func TestNewDiscoverer(t *testing.T) {
+	withNmap := &Scanner{Runner: discoveryRunner}
+	withoutNmap := &Scanner{Runner: utils.ReplayRunner{Dir: t.TempDir()}}
+	tests := []struct {
+		backend string
+		scanner *Scanner
+		want    string
+	}{
+		{"nmap", withoutNmap, "nmap"},
+		{"native", withNmap, "native"},
+		{"auto", withNmap, "nmap"},
+		{"", withoutNmap, "native"},
+	}
+	for _, tt := range tests {
+		d, err := tt.scanner.NewDiscoverer(DiscoveryConfig{Backend: tt.backend})
+		if err != nil {
+			t.Fatalf("NewDiscoverer(%q): %v", tt.backend, err)
+		}
+		got := "native"
+		if _, ok := d.(NmapDiscoverer); ok {
+			got = "nmap"
+		}
+		if got != tt.want {
+			t.Errorf("NewDiscoverer(%q) = %s, want %s", tt.backend, got, tt.want)
+		}
+	}
+	if _, err := withNmap.NewDiscoverer(DiscoveryConfig{Backend: "masscan"}); err == nil {
+		t.Error("NewDiscoverer accepted an unknown backend")
+	}
+}
+
+func TestSubnetHosts(t *testing.T) {
+	tests := []struct {
+		subnet   string
+		attached bool
+		want     []string
+		wantErr  bool
+	}{
+		{"192.168.1.0/30", true, []string{"192.168.1.1", "192.168.1.2"}, false},
+		{"192.168.1.0/30", false, []string{"192.168.1.0", "192.168.1.1", "192.168.1.2", "192.168.1.3"}, false},
+		{"192.168.1.4/31", true, []string{"192.168.1.4", "192.168.1.5"}, false},
+		{"10.0.0.0/15", true, nil, true},
+		{"2001:db8::/120", true, nil, true},
+		{"not-a-subnet", true, nil, true},
+	}
+	for _, tt := range tests {
+		hosts, err := subnetHosts(tt.subnet, tt.attached)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("subnetHosts(%s) error = %v, want error %v", tt.subnet, err, tt.wantErr)
+			continue
+		}
+		if got := ipStrings(hosts); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("subnetHosts(%s, %v) = %v, want %v", tt.subnet, tt.attached, got, tt.want)
+		}
+	}
+}
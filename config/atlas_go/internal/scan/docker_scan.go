@@ -1,18 +1,25 @@
 package scan
 
 import (
+    "context"
     "database/sql"
     "encoding/json"
     "fmt"
-    "os/exec"
+    "net"
     "sort"
     "strings"
+    "sync"
     "time"
     "strconv"
 
-    _ "github.com/mattn/go-sqlite3"
+    "atlas/internal/classify"
+    "atlas/internal/db"
+    "atlas/internal/docker"
 )
 
+// dockerAPITimeout bounds one Docker scan's Engine API calls.
+const dockerAPITimeout = 2 * time.Minute
+
 type DockerContainer struct {
     ID      string
     IP      string
@@ -20,157 +27,96 @@ type DockerContainer struct {
     OS      string
     MAC     string
     Ports   string
+    PortList []db.HostPort // Ports as host_ports rows
     NextHop string
     NetName string
     LastSeen   string
     State   string
+    Engine  string // name of the Docker engine the container runs on
+    Runtime string // RuntimeDocker, RuntimePodman or RuntimeContainerd
 }
 
-func runCmd(cmd string, args ...string) ([]byte, error) {
-    return exec.Command(cmd, args...).CombinedOutput()
-}
-
-func getDockerContainers() ([]string, error) {
-    out, err := runCmd("docker", "ps", "-a", "-q")
-    if err != nil {
-        return nil, err
-    }
-    ids := strings.Fields(string(out))
-    return ids, nil
+func (s *Scanner) runCmd(cmd string, args ...string) ([]byte, error) {
+    return s.Runner.CombinedOutput(context.Background(), cmd, args...)
 }
 
-func inspectContainer(id string) ([]DockerContainer, error) {
-    out, err := runCmd("docker", "inspect", id)
-    if err != nil {
-        return nil, err
+// engineAddress returns the address of the machine an engine runs on: the LAN IP of this host for
+// the local socket, the (resolved) host of a remote engine.
+func (s *Scanner) engineAddress(r ContainerRuntime) string {
+    host := r.RemoteHost()
+    if host == "" {
+        return s.lanAddress()
     }
-
-    var data []map[string]interface{}
-    if err := json.Unmarshal(out, &data); err != nil {
-        return nil, err
-    }
-    if len(data) == 0 {
-        return nil, fmt.Errorf("no inspect data for container %s", id)
-    }
-
-    var results []DockerContainer
-    info := data[0]
-
-    // Name
-    name := ""
-    if n, ok := info["Name"].(string); ok {
-        name = strings.TrimPrefix(n, "/")
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+    if addrs, err := s.Runner.LookupHost(ctx, host); err == nil && len(addrs) > 0 {
+        return addrs[0]
     }
+    return host
+}
 
-    // Container ID
-    cid := ""
-    if rawId, ok := info["Id"].(string); ok {
-        cid = rawId
-    } else {
-        cid = id
+// dockerContainers turns an inspected container of runtime r into one DockerContainer per network
+// it is attached to, or a single network-less entry. hostAddr is the engine's engineAddress and
+// gateways the engine's networkGateways.
+func (s *Scanner) dockerContainers(info docker.Container, r ContainerRuntime, hostAddr string, gateways map[string]string) []DockerContainer {
+    name := strings.TrimPrefix(info.Name, "/")
+    state := info.State.Status
+    if state == "" {
+        state = "unknown"
     }
 
-    // State
-    state := "unknown"
-    if stateObj, ok := info["State"].(map[string]interface{}); ok {
-        if s, ok := stateObj["Status"].(string); ok {
-            state = s
-        }
+    // OS (show the image name/tag without digest instead of the OS)
+    osName := "unknown"
+    if image := info.Config.Image; image != "" {
+        osName = strings.SplitN(image, "@", 2)[0]
     }
 
-    // Networks
-    networks := map[string]interface{}{}
-    if ns, ok := info["NetworkSettings"].(map[string]interface{}); ok {
-        if nets, ok := ns["Networks"].(map[string]interface{}); ok {
-            networks = nets
-        }
-    }
-    for netName, netData := range networks {
-        ip := ""
-        mac := ""
-        netMap, _ := netData.(map[string]interface{})
-        if v, ok := netMap["IPAddress"].(string); ok {
-            ip = v
-        }
-        if v, ok := netMap["MacAddress"].(string); ok {
-            mac = v
-        }
-
-        // OS (show the image name/tag without digest instead of the OS)
-        image := ""
-        osName := "unknown"
-        if cfg, ok := info["Config"].(map[string]interface{}); ok {
-            if img, ok := cfg["Image"].(string); ok {
-                image = img
-        // Only keep name:tag, drop digest if present
-        if strings.Contains(image, "@") {
-            osName = strings.Split(image, "@")[0]
+    // Ports
+    ports := []string{}
+    var portList []db.HostPort
+    for port, bindings := range info.NetworkSettings.Ports {
+        portList = append(portList, dockerPort(port, bindings))
+        if len(bindings) > 0 && bindings[0].HostPort != "" {
+            ports = append(ports, fmt.Sprintf("%s -> %s:%s", port, bindings[0].HostIP, bindings[0].HostPort))
         } else {
-            osName = image
+            ports = append(ports, fmt.Sprintf("%s (internal)", port))
         }
     }
-}
-
-        // Ports
-        portOut, _ := runCmd("docker", "inspect", id)
-        var portData []map[string]interface{}
-        json.Unmarshal(portOut, &portData)
-        ports := []string{}
-        if len(portData) > 0 {
-            if ns, ok := portData[0]["NetworkSettings"].(map[string]interface{}); ok {
-                if pmap, ok := ns["Ports"].(map[string]interface{}); ok {
-                    for port, val := range pmap {
-                        if val == nil {
-                            ports = append(ports, fmt.Sprintf("%s (internal)", port))
-                        } else {
-                            arr, arrOK := val.([]interface{})
-                            if arrOK && len(arr) > 0 {
-                                entry, entryOK := arr[0].(map[string]interface{})
-                                if entryOK {
-                                    hIp, hIpOK := entry["HostIp"].(string)
-                                    hPort, hPortOK := entry["HostPort"].(string)
-                                    if hIpOK && hPortOK {
-                                        ports = append(ports, fmt.Sprintf("%s -> %s:%s", port, hIp, hPort))
-                                    } else {
-                                        ports = append(ports, fmt.Sprintf("%s (internal)", port))
-                                    }
-                                } else {
-                                    ports = append(ports, fmt.Sprintf("%s (internal)", port))
-                                }
-                            } else {
-                                ports = append(ports, fmt.Sprintf("%s (internal)", port))
-                            }
-                        }
-                    }
-                }
-            }
+    sort.Strings(ports)
+    sort.Slice(portList, func(i, j int) bool {
+        if portList[i].Protocol != portList[j].Protocol {
+            return portList[i].Protocol < portList[j].Protocol
         }
-        sort.Strings(ports)
-        portStr := "no_ports"
-        if len(ports) > 0 {
-            portStr = strings.Join(ports, ",")
-        }
-
-        nextHop := getGateway(netName, ip)
+        return portList[i].Port < portList[j].Port
+    })
+    portStr := "no_ports"
+    if len(ports) > 0 {
+        portStr = strings.Join(ports, ",")
+    }
 
+    var results []DockerContainer
+    for netName, endpoint := range info.NetworkSettings.Networks {
         results = append(results, DockerContainer{
-            ID:      cid,
-            IP:      ip,
+            ID:      info.ID,
+            IP:      endpoint.IPAddress,
             Name:    name,
             OS:      osName,
-            MAC:     mac,
+            MAC:     endpoint.MacAddress,
             Ports:   portStr,
-            NextHop: nextHop,
+            PortList: portList,
+            NextHop: dockerNextHop(netName, endpoint, hostAddr, gateways),
             NetName: netName,
             LastSeen: "", // will be set in DB update step
             State:   state,
+            Engine:  r.Name(),
+            Runtime: r.Kind(),
         })
     }
 
     // If no network found, fallback with blank network
-    if len(networks) == 0 {
+    if len(results) == 0 {
         results = append(results, DockerContainer{
-            ID:      cid,
+            ID:      info.ID,
             IP:      "",
             Name:    name,
             OS:      "unknown",
@@ -180,17 +126,83 @@ func inspectContainer(id string) ([]DockerContainer, error) {
             NetName: "",
             LastSeen: "",
             State:   state,
+            Engine:  r.Name(),
+            Runtime: r.Kind(),
         })
     }
+    sort.Slice(results, func(i, j int) bool { return results[i].NetName < results[j].NetName })
+    return results
+}
+
+// dockerPort converts an entry of NetworkSettings.Ports ("80/tcp" -> bindings) to a host_ports row.
+// Published ports are open; ports without a host binding are only reachable on the container
+// network and recorded as exposed.
+func dockerPort(key string, bindings []docker.PortBinding) db.HostPort {
+    p := db.HostPort{Protocol: "tcp", State: "exposed", Method: "docker"}
+    num, proto, found := strings.Cut(key, "/")
+    if found {
+        p.Protocol = proto
+    }
+    p.Port, _ = strconv.Atoi(num)
 
-    return results, nil
+    var published []string
+    for _, b := range bindings {
+        if b.HostPort != "" {
+            published = append(published, b.HostIP+":"+b.HostPort)
+        }
+    }
+    if len(published) > 0 {
+        p.State = "open"
+        p.ExtraInfo = "published on " + strings.Join(published, ", ")
+    }
+    return p
 }
 
-var gatewayCache = make(map[string]string)
+// dockerNextHop returns where traffic of a container on network netName leaves it: the network's
+// gateway (the bridge on the engine's host, or the overlay's gateway), or the engine's host for the
+// host network, whose containers share the host's addresses.
+func dockerNextHop(netName string, endpoint docker.EndpointSettings, hostAddr string, gateways map[string]string) string {
+    if endpoint.Gateway != "" {
+        return endpoint.Gateway
+    }
+    // Endpoints of internal networks carry no gateway, the network's IPAM config still has it
+    if gw := gateways[endpoint.NetworkID]; gw != "" {
+        return gw
+    }
+    if gw := gateways[netName]; gw != "" {
+        return gw
+    }
+    if netName == "host" {
+        return hostAddr
+    }
+    return "unavailable"
+}
 
-func getGateway(network, ip string) string {
-    // Return the host LAN IP (first IP from `hostname -I`)
-    out, err := runCmd("hostname", "-I")
+// networkGateways maps the ID and the name of each network to its IPv4 gateway.
+func networkGateways(nets []docker.Network) map[string]string {
+    gateways := make(map[string]string)
+    for _, n := range nets {
+        if _, gw := networkIPv4(n); gw != "" {
+            gateways[n.ID] = gw
+            gateways[n.Name] = gw
+        }
+    }
+    return gateways
+}
+
+// networkIPv4 returns the subnet and gateway of the first IPv4 pool of n.
+func networkIPv4(n docker.Network) (subnet, gateway string) {
+    for _, c := range n.IPAM.Config {
+        if ip, _, err := net.ParseCIDR(c.Subnet); err == nil && ip.To4() != nil {
+            return c.Subnet, c.Gateway
+        }
+    }
+    return "", ""
+}
+
+// lanAddress returns the LAN IP of this host (first IP from `hostname -I`).
+func (s *Scanner) lanAddress() string {
+    out, err := s.runCmd("hostname", "-I")
     if err != nil {
         return "unavailable"
     }
@@ -201,80 +213,287 @@ func getGateway(network, ip string) string {
     return "unavailable"
 }
 
-func isDockerInternalGateway(gateway string) bool {
-    // Matches 172.16.0.1 - 172.31.0.1
-    if strings.HasPrefix(gateway, "172.") && strings.HasSuffix(gateway, ".0.1") {
-        octets := strings.Split(gateway, ".")
-        if len(octets) == 4 {
-            second, _ := strconv.Atoi(octets[1])
-            if second >= 16 && second <= 31 {
-                return true
-            }
-        }
+// upsertDockerContainer writes one container network row and its ports.
+func upsertDockerContainer(conn db.DBTX, c DockerContainer, scan db.ScanRef, classifier *classify.Classifier) error {
+    onlineStatus := "offline"
+    if c.State == "running" {
+        onlineStatus = "online"
     }
-    return false
-}
+    class := classifier.Classify(dockerEvidence(c))
 
-func updateDockerDB(containers []DockerContainer) error {
-    db, err := sql.Open("sqlite3", "/config/db/atlas.db")
+    _, err := conn.Exec(`
+        INSERT INTO docker_hosts (container_id, ip, name, os_details, mac_address, open_ports, next_hop, network_name, last_seen, online_status, last_scan_run_id, device_type, device_confidence, engine, runtime)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+        ON CONFLICT(engine, container_id, network_name) DO UPDATE SET
+            ip=excluded.ip,
+            name=excluded.name,
+            os_details=excluded.os_details,
+            mac_address=excluded.mac_address,
+            open_ports=excluded.open_ports,
+            next_hop=excluded.next_hop,
+            last_seen=excluded.last_seen,
+            online_status=excluded.online_status,
+            last_scan_run_id=excluded.last_scan_run_id,
+            device_type=excluded.device_type,
+            device_confidence=excluded.device_confidence,
+            runtime=excluded.runtime
+    `, c.ID, c.IP, c.Name, c.OS, c.MAC, c.Ports, c.NextHop, c.NetName, time.Now().Format("2006-01-02 15:04:05"), onlineStatus, scan.RunIDValue(),
+        class.Type, class.Confidence, c.Engine, c.Runtime)
     if err != nil {
         return err
     }
-    defer db.Close()
 
-    knownIDs := []string{}
+    var rowID int64
+    if err := conn.QueryRow("SELECT id FROM docker_hosts WHERE engine = ? AND container_id = ? AND network_name = ?", c.Engine, c.ID, c.NetName).Scan(&rowID); err != nil {
+        return fmt.Errorf("port update failed: %v", err)
+    }
+    if err := db.SyncHostPorts(conn, db.PortsOfContainer, rowID, []string{"tcp", "udp", "sctp"}, c.PortList); err != nil {
+        return fmt.Errorf("port update failed: %v", err)
+    }
+    return nil
+}
+
+// syncDockerContainer replaces the rows of container id on engine with containers (one per network
+// it is attached to now) in one transaction, so a failure leaves the container's earlier rows.
+func syncDockerContainer(conn *sql.DB, engine, id string, containers []DockerContainer, scan db.ScanRef, classifier *classify.Classifier) error {
+    tx, err := conn.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+    nets := []any{engine, id}
     for _, c := range containers {
-        knownIDs = append(knownIDs, c.ID)
+        if err := upsertDockerContainer(tx, c, scan, classifier); err != nil {
+            return err
+        }
+        nets = append(nets, c.NetName)
+    }
+    query := "DELETE FROM docker_hosts WHERE engine = ? AND container_id = ?"
+    if len(nets) > 2 {
+        query += " AND network_name NOT IN (" + strings.TrimSuffix(strings.Repeat("?,", len(nets)-2), ",") + ")"
+    }
+    if _, err := tx.Exec(query, nets...); err != nil {
+        return err
+    }
+    if err := db.PruneContainerPorts(tx); err != nil {
+        return err
+    }
+    return tx.Commit()
+}
 
-        onlineStatus := "offline"
-        if c.State == "running" {
-            onlineStatus = "online"
+// updateDockerDB syncs the containers of engine one by one and drops that engine's rows of
+// containers that no longer exist; other engines' rows are left alone. ids are all containers the
+// engine listed, so one whose inspect failed keeps its rows. It returns the number of rows written.
+func updateDockerDB(conn *sql.DB, engine string, ids []string, containers []DockerContainer, scan db.ScanRef, classifier *classify.Classifier) (int, error) {
+    updated := 0
+    for start := 0; start < len(containers); {
+        // dockerContainers returns a container's networks next to each other
+        end := start + 1
+        for end < len(containers) && containers[end].ID == containers[start].ID {
+            end++
         }
+        id := containers[start].ID
+        if err := syncDockerContainer(conn, engine, id, containers[start:end], scan, classifier); err != nil {
+            fmt.Printf("Insert/update failed for %s: %v\n", id, err)
+        } else {
+            updated += end - start
+        }
+        start = end
+    }
 
-        _, err = db.Exec(`
-            INSERT INTO docker_hosts (container_id, ip, name, os_details, mac_address, open_ports, next_hop, network_name, last_seen, online_status)
-            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-            ON CONFLICT(container_id, network_name) DO UPDATE SET
-                ip=excluded.ip,
+    // Clean up old records of this engine by container id
+    knownIDs := []any{engine}
+    for _, id := range ids {
+        knownIDs = append(knownIDs, id)
+    }
+    query := "DELETE FROM docker_hosts WHERE engine = ?"
+    if len(knownIDs) > 1 {
+        query += " AND container_id NOT IN (" + strings.TrimSuffix(strings.Repeat("?,", len(knownIDs)-1), ",") + ")"
+    }
+    tx, err := conn.Begin()
+    if err != nil {
+        return updated, err
+    }
+    defer tx.Rollback()
+    if _, err := tx.Exec(query, knownIDs...); err != nil {
+        return updated, fmt.Errorf("cleanup failed: %v", err)
+    }
+    if err := db.PruneContainerPorts(tx); err != nil {
+        return updated, fmt.Errorf("port cleanup failed: %v", err)
+    }
+    return updated, tx.Commit()
+}
+
+// updateDockerNetworks stores the networks of engine in docker_networks and drops that engine's
+// networks that no longer exist. It returns the number of networks written.
+func updateDockerNetworks(conn *sql.DB, engine, hostAddr string, nets []docker.Network, scan db.ScanRef) (int, error) {
+    updated := 0
+    knownIDs := []any{engine}
+    now := time.Now().Format("2006-01-02 15:04:05")
+    for _, n := range nets {
+        knownIDs = append(knownIDs, n.ID)
+        subnet, gateway := networkIPv4(n)
+        ipam, _ := json.Marshal(n.IPAM.Config)
+        _, err := conn.Exec(`
+            INSERT INTO docker_networks (engine, network_id, name, driver, scope, subnet, gateway, ipam_config, internal, attachable, bridge_name, host_address, last_seen, last_scan_run_id)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+            ON CONFLICT(engine, network_id) DO UPDATE SET
                 name=excluded.name,
-                os_details=excluded.os_details,
-                mac_address=excluded.mac_address,
-                open_ports=excluded.open_ports,
-                next_hop=excluded.next_hop,
+                driver=excluded.driver,
+                scope=excluded.scope,
+                subnet=excluded.subnet,
+                gateway=excluded.gateway,
+                ipam_config=excluded.ipam_config,
+                internal=excluded.internal,
+                attachable=excluded.attachable,
+                bridge_name=excluded.bridge_name,
+                host_address=excluded.host_address,
                 last_seen=excluded.last_seen,
-                online_status=excluded.online_status
-        `, c.ID, c.IP, c.Name, c.OS, c.MAC, c.Ports, c.NextHop, c.NetName, time.Now().Format("2006-01-02 15:04:05"), onlineStatus)
+                last_scan_run_id=excluded.last_scan_run_id
+        `, engine, n.ID, n.Name, n.Driver, n.Scope, subnet, gateway, string(ipam), n.Internal, n.Attachable, n.BridgeName(), hostAddr, now, scan.RunIDValue())
         if err != nil {
-            fmt.Printf("Insert/update failed for %s: %v\n", c.ID, err)
+            fmt.Printf("Insert/update failed for network %s: %v\n", n.Name, err)
+            continue
         }
+        updated++
     }
 
-    // Clean up old records by container id
-    if len(knownIDs) > 0 {
-        idList := "'" + strings.Join(knownIDs, "','") + "'"
-        _, err = db.Exec(fmt.Sprintf("DELETE FROM docker_hosts WHERE container_id NOT IN (%s);", idList))
-        if err != nil {
-            fmt.Printf("Cleanup failed: %v\n", err)
+    query := "DELETE FROM docker_networks WHERE engine = ?"
+    if len(knownIDs) > 1 {
+        query += " AND network_id NOT IN (" + strings.TrimSuffix(strings.Repeat("?,", len(knownIDs)-1), ",") + ")"
+    }
+    if _, err := conn.Exec(query, knownIDs...); err != nil {
+        return updated, fmt.Errorf("network cleanup failed: %v", err)
+    }
+    return updated, nil
+}
+
+// storedNetworkGateways returns the networkGateways of engine as last stored in docker_networks.
+func storedNetworkGateways(conn *sql.DB, engine string) (map[string]string, error) {
+    rows, err := conn.Query(`SELECT network_id, name, COALESCE(gateway, '') FROM docker_networks WHERE engine = ?`, engine)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    gateways := make(map[string]string)
+    for rows.Next() {
+        var id, name, gw string
+        if err := rows.Scan(&id, &name, &gw); err != nil {
+            return nil, err
+        }
+        if gw != "" {
+            gateways[id] = gw
+            gateways[name] = gw
         }
     }
-    return nil
+    return gateways, rows.Err()
 }
 
-func DockerScan() error {
-    ids, err := getDockerContainers()
+// DockerScan scans every configured container engine concurrently: each lists its networks and
+// containers once and inspects each container once. Networks are stored in docker_networks and one
+// docker_hosts row per container network, tagged with the engine and its runtime, with the
+// network's gateway as next hop. An engine that cannot be reached keeps its rows from earlier scans.
+func (s *Scanner) DockerScan() error {
+    ctx := context.Background()
+    runtimes, err := s.containerRuntimes(ctx)
     if err != nil {
         return err
     }
+    _, err = s.dockerScan(ctx, runtimes, "dockerscan")
+    return err
+}
+
+// engineScan is what one engine's list+inspect pass found.
+type engineScan struct {
+    engine     string
+    hostAddr   string
+    networks   []docker.Network // nil if they could not be listed
+    ids        []string         // every container listed, inspected or not
+    containers []DockerContainer
+    found      int
+    warnings   []string
+    err        error
+}
 
-    var allContainers []DockerContainer
+// dockerScan is a full scan of runtimes recorded as a run of scanType. It returns the run, which
+// later incremental updates can be attributed to, and fails only when no engine could be scanned.
+func (s *Scanner) dockerScan(ctx context.Context, runtimes []ContainerRuntime, scanType string) (ref db.ScanRef, err error) {
+    run := s.startRun(scanType)
+    defer func() { run.Finish(err) }()
+
+    ctx, cancel := context.WithTimeout(ctx, dockerAPITimeout)
+    defer cancel()
+    results := make([]engineScan, len(runtimes))
+    var wg sync.WaitGroup
+    for i, r := range runtimes {
+        run.Targets = append(run.Targets, r.Name())
+        wg.Add(1)
+        go func(i int, r ContainerRuntime) {
+            defer wg.Done()
+            results[i] = s.scanEngine(ctx, r)
+        }(i, r)
+    }
+    wg.Wait()
+
+    // Results are written here, one engine after the other, over the single store connection
+    var failed []string
+    for _, res := range results {
+        for _, w := range res.warnings {
+            run.Warnf("%s", w)
+        }
+        if res.err != nil {
+            fmt.Printf("⚠️ Container engine %s: %v\n", res.engine, res.err)
+            run.Warnf("engine %s: %v", res.engine, res.err)
+            failed = append(failed, res.engine)
+            continue
+        }
+        run.Found += res.found
+        if res.networks != nil {
+            if _, err := updateDockerNetworks(s.Store.DB, res.engine, res.hostAddr, res.networks, run.Ref()); err != nil {
+                run.Warnf("engine %s: %v", res.engine, err)
+            }
+        }
+        updated, err := updateDockerDB(s.Store.DB, res.engine, res.ids, res.containers, run.Ref(), s.classifier())
+        if err != nil {
+            fmt.Printf("⚠️ Container engine %s: %v\n", res.engine, err)
+            run.Warnf("engine %s: %v", res.engine, err)
+        }
+        run.Updated += updated
+    }
+    if len(failed) == len(runtimes) {
+        return run.Ref(), fmt.Errorf("no container engine could be scanned (%s)", strings.Join(failed, ", "))
+    }
+    return run.Ref(), nil
+}
+
+// scanEngine lists and inspects the containers of one engine.
+func (s *Scanner) scanEngine(ctx context.Context, r ContainerRuntime) engineScan {
+    res := engineScan{engine: r.Name()}
+    ids, err := r.ContainerIDs(ctx)
+    if err != nil {
+        res.err = err
+        return res
+    }
+    res.ids = ids
+    res.found = len(ids)
+    res.hostAddr = s.engineAddress(r)
+    nets, err := r.Networks(ctx)
+    if err != nil {
+        fmt.Printf("⚠️ Networks of %s: %v\n", r.Name(), err)
+        res.warnings = append(res.warnings, fmt.Sprintf("network list on %s failed: %v", r.Name(), err))
+    } else {
+        // Non-nil even when empty, so the engine's removed networks are dropped
+        res.networks = append([]docker.Network{}, nets...)
+    }
+    gateways := networkGateways(nets)
     for _, id := range ids {
-        containers, err := inspectContainer(id)
+        info, err := r.Inspect(ctx, id)
         if err != nil {
-            fmt.Printf("Skipping container %s: %v\n", id, err)
+            fmt.Printf("Skipping container %s on %s: %v\n", id, r.Name(), err)
+            res.warnings = append(res.warnings, fmt.Sprintf("inspect %s on %s failed: %v", id, r.Name(), err))
             continue
         }
-        allContainers = append(allContainers, containers...)
+        res.containers = append(res.containers, s.dockerContainers(info, r, res.hostAddr, gateways)...)
     }
-
-    return updateDockerDB(allContainers)
-}
\ No newline at end of file
+    return res
+}
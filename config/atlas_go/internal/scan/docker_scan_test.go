@@ -0,0 +1,50 @@
+package scan
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"atlas/internal/docker"
+	"atlas/internal/utils"
+)
+
+func TestEngineAddress(t *testing.T) {
+	dir := t.TempDir()
+	recordings := map[string]string{
+		utils.CommandKey("hostname", "-I"):            "192.168.1.5 172.17.0.1\n",
+		utils.CommandKey("lookuphost", "nas.lan"):     "192.168.1.7\nfd00::7\n",
+		utils.CommandKey("lookuphost", "10.0.0.9"):    "10.0.0.9\n",
+		utils.CommandKey("lookuphost", "offline.lan"): "",
+	}
+	for key, out := range recordings {
+		if err := os.WriteFile(filepath.Join(dir, key+".out"), []byte(out), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &Scanner{Runner: utils.ReplayRunner{Dir: dir}}
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"unix:///var/run/docker.sock", "192.168.1.5"}, // the local engine runs on this host
+		{"tcp://nas.lan:2376", "192.168.1.7"},
+		{"tcp://10.0.0.9:2375", "10.0.0.9"},
+		{"ssh://admin@offline.lan", "offline.lan"}, // resolves to nothing
+		{"tcp://gone.lan:2375", "gone.lan"},        // lookup fails
+	}
+	for _, tt := range tests {
+		c, err := docker.NewClient(tt.host, docker.ClientOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.engineAddress(apiRuntime{Client: c, kind: RuntimeDocker}); got != tt.want {
+			t.Errorf("engineAddress(%s) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+	local := containerdRuntime{name: "edge", address: "/run/containerd/containerd.sock", namespace: "default"}
+	if got := s.engineAddress(local); got != "192.168.1.5" {
+		t.Errorf("engineAddress(containerd) = %q, want this host's address", got)
+	}
+}
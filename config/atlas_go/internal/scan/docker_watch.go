@@ -0,0 +1,157 @@
+package scan
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"atlas/internal/db"
+	"atlas/internal/docker"
+)
+
+// dockerWatchFilters selects the Engine events that change a container's docker_hosts rows.
+var dockerWatchFilters = map[string][]string{
+	"type":  {"container", "network"},
+	"event": {"start", "die", "destroy", "rename", "connect", "disconnect"},
+}
+
+const (
+	dockerWatchMinBackoff = time.Second
+	dockerWatchMaxBackoff = time.Minute
+)
+
+// DockerWatch keeps docker_hosts current until ctx is cancelled, following every configured engine
+// at once. For each it subscribes to the event stream, resyncs the engine's containers (recorded as
+// a dockerwatch run) and then applies each container event as it arrives. A lost stream is reopened
+// with exponential backoff, followed by another resync since events may have been missed in between.
+// containerd engines have no event stream and are left to dockerscan.
+func (s *Scanner) DockerWatch(ctx context.Context) error {
+	runtimes, err := s.containerRuntimes(ctx)
+	if err != nil {
+		return err
+	}
+	// Writes from the engines' watchers go through one store connection; serialize them
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, r := range runtimes {
+		er, ok := r.(eventRuntime)
+		if !ok {
+			fmt.Printf("ℹ️ Engine %s (%s) has no event stream, not watching it\n", r.Name(), r.Kind())
+			continue
+		}
+		wg.Add(1)
+		go func(r eventRuntime) {
+			defer wg.Done()
+			s.watchEngine(ctx, r, &mu)
+		}(er)
+	}
+	wg.Wait()
+	return nil
+}
+
+// watchEngine follows one engine until ctx is cancelled, reconnecting with backoff.
+func (s *Scanner) watchEngine(ctx context.Context, r eventRuntime, mu *sync.Mutex) {
+	backoff := dockerWatchMinBackoff
+	for {
+		watched, err := s.watchDocker(ctx, r, mu)
+		if ctx.Err() != nil {
+			return
+		}
+		if watched {
+			backoff = dockerWatchMinBackoff
+		}
+		fmt.Printf("⚠️ Docker event stream of %s lost: %v, reconnecting in %s\n", r.Name(), err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff *= 2
+		if backoff > dockerWatchMaxBackoff {
+			backoff = dockerWatchMaxBackoff
+		}
+	}
+}
+
+// watchDocker runs one subscription: it reports whether the stream was established and resynced,
+// and the error that ended it.
+func (s *Scanner) watchDocker(ctx context.Context, r eventRuntime, mu *sync.Mutex) (bool, error) {
+	// Subscribe before the resync, so changes made while it runs are not missed
+	stream, err := r.Events(ctx, dockerWatchFilters)
+	if err != nil {
+		return false, err
+	}
+	defer stream.Close()
+	mu.Lock()
+	scan, err := s.dockerScan(ctx, []ContainerRuntime{r}, "dockerwatch")
+	mu.Unlock()
+	if err != nil {
+		return false, fmt.Errorf("resync failed: %v", err)
+	}
+	hostAddr := s.engineAddress(r)
+	fmt.Printf("👀 Watching %s events of %s\n", r.Kind(), r.Name())
+
+	for {
+		e, err := stream.Next()
+		if err != nil {
+			return true, err
+		}
+		if err := s.applyDockerEvent(ctx, r, hostAddr, e, scan, mu); err != nil {
+			fmt.Printf("⚠️ Docker %s %s on %s: %v\n", e.Type, e.Action, r.Name(), err)
+		}
+	}
+}
+
+// applyDockerEvent updates the rows of the container an event is about.
+func (s *Scanner) applyDockerEvent(ctx context.Context, r eventRuntime, hostAddr string, e docker.Event, scan db.ScanRef, mu *sync.Mutex) error {
+	id := e.Actor.ID
+	if e.Type == "network" {
+		// Network events name the container in their attributes; create/destroy of the network
+		// itself carries none
+		id = e.Actor.Attributes["container"]
+	}
+	if id == "" {
+		return nil
+	}
+	var info docker.Container
+	var err error
+	if e.Type != "container" || e.Action != "destroy" {
+		ctx, cancel := context.WithTimeout(ctx, dockerAPITimeout)
+		info, err = r.Inspect(ctx, id)
+		cancel()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	conn := s.Store.DB
+	switch {
+	case e.Type == "container" && e.Action == "destroy", docker.IsNotFound(err):
+		// A not-found container is already gone again, e.g. a --rm container that exited
+		return removeDockerContainer(conn, r.Name(), id)
+	case err != nil:
+		return err
+	}
+	gateways, err := storedNetworkGateways(conn, r.Name())
+	if err != nil {
+		return err
+	}
+	return syncDockerContainer(conn, r.Name(), id, s.dockerContainers(info, r, hostAddr, gateways), scan, s.classifier())
+}
+
+// removeDockerContainer drops every row of container id on engine, and their ports.
+func removeDockerContainer(conn *sql.DB, engine, id string) error {
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM docker_hosts WHERE engine = ? AND container_id = ?`, engine, id); err != nil {
+		return err
+	}
+	if err := db.PruneContainerPorts(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
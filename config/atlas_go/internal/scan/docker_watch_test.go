@@ -0,0 +1,210 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"atlas/internal/db"
+	"atlas/internal/docker"
+)
+
+// fakeEventRuntime is an engine whose containers the test edits between events.
+type fakeEventRuntime struct {
+	name       string
+	containers map[string]docker.Container
+	inspectErr error    // returned by every Inspect when set
+	inspected  []string // container ids Inspect was called with
+}
+
+func (r *fakeEventRuntime) Name() string       { return r.name }
+func (r *fakeEventRuntime) Kind() string       { return RuntimeDocker }
+func (r *fakeEventRuntime) RemoteHost() string { return "" }
+
+func (r *fakeEventRuntime) ContainerIDs(ctx context.Context) ([]string, error) {
+	var ids []string
+	for id := range r.containers {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (r *fakeEventRuntime) Inspect(ctx context.Context, id string) (docker.Container, error) {
+	r.inspected = append(r.inspected, id)
+	if r.inspectErr != nil {
+		return docker.Container{}, r.inspectErr
+	}
+	c, ok := r.containers[id]
+	if !ok {
+		return docker.Container{}, &docker.APIError{Path: "/containers/" + id + "/json", StatusCode: 404, Message: "No such container: " + id}
+	}
+	return c, nil
+}
+
+func (r *fakeEventRuntime) Networks(ctx context.Context) ([]docker.Network, error) {
+	return nil, nil
+}
+
+func (r *fakeEventRuntime) Events(ctx context.Context, filters map[string][]string) (*docker.EventStream, error) {
+	return nil, errors.New("no event stream")
+}
+
+// dockerState lists the docker_hosts rows and container ports of every engine.
+func dockerState(t *testing.T, s *Scanner) []string {
+	t.Helper()
+	var state []string
+	for _, q := range []string{
+		`SELECT engine || ' | ' || container_id || ' | ' || network_name || ' | ' || COALESCE(ip, '') || ' | ' || online_status
+			FROM docker_hosts ORDER BY engine, network_name`,
+		`SELECT 'port ' || d.engine || ' ' || d.network_name || ' ' || p.port || '/' || p.protocol || ' ' || p.state
+			FROM host_ports p JOIN docker_hosts d ON p.host_kind = 'docker' AND d.id = p.host_id ORDER BY d.engine, d.network_name, p.port`,
+	} {
+		rows, err := s.Store.DB.Query(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+			var row string
+			if err := rows.Scan(&row); err != nil {
+				t.Fatal(err)
+			}
+			state = append(state, row)
+		}
+		rows.Close()
+	}
+	return state
+}
+
+func TestApplyDockerEvent(t *testing.T) {
+	const id = "4f1c2d3e5a6b"
+	web := docker.Container{
+		ID:     id,
+		Name:   "/web",
+		State:  docker.ContainerState{Status: "running", Running: true},
+		Config: docker.ContainerConfig{Image: "nginx:1.27"},
+		NetworkSettings: docker.NetworkSettings{
+			Ports:    map[string][]docker.PortBinding{"80/tcp": {{HostIP: "0.0.0.0", HostPort: "8080"}}},
+			Networks: map[string]docker.EndpointSettings{"bridge": {IPAddress: "172.17.0.2", Gateway: "172.17.0.1"}},
+		},
+	}
+	backend := docker.EndpointSettings{IPAddress: "172.20.0.2", Gateway: "172.20.0.1"}
+	containerEvent := func(action string) docker.Event {
+		return docker.Event{Type: "container", Action: action, Actor: docker.EventActor{ID: id}}
+	}
+	networkEvent := func(action string, attributes map[string]string) docker.Event {
+		return docker.Event{Type: "network", Action: action, Actor: docker.EventActor{ID: "9a8b7c6d", Attributes: attributes}}
+	}
+	// The same container id on another engine must never be touched
+	other := "nas | " + id + " | bridge |  | online"
+
+	tests := []struct {
+		name    string
+		change  func(r *fakeEventRuntime)
+		event   docker.Event
+		inspect bool // the event needs an Inspect
+		fails   bool
+		want    []string
+	}{
+		{
+			name:    "start",
+			event:   containerEvent("start"),
+			inspect: true,
+			want:    []string{"local | " + id + " | bridge | 172.17.0.2 | online", other, "port local bridge 80/tcp open"},
+		},
+		{
+			name: "die",
+			change: func(r *fakeEventRuntime) {
+				c := r.containers[id]
+				c.State = docker.ContainerState{Status: "exited"}
+				r.containers[id] = c
+			},
+			event:   containerEvent("die"),
+			inspect: true,
+			want:    []string{"local | " + id + " | bridge | 172.17.0.2 | offline", other, "port local bridge 80/tcp open"},
+		},
+		{
+			name: "network connect",
+			change: func(r *fakeEventRuntime) {
+				r.containers[id].NetworkSettings.Networks["backend"] = backend
+			},
+			event:   networkEvent("connect", map[string]string{"container": id, "name": "backend"}),
+			inspect: true,
+			want: []string{
+				"local | " + id + " | backend | 172.20.0.2 | online", "local | " + id + " | bridge | 172.17.0.2 | online", other,
+				"port local backend 80/tcp open", "port local bridge 80/tcp open",
+			},
+		},
+		{
+			name: "network disconnect",
+			change: func(r *fakeEventRuntime) {
+				c := r.containers[id]
+				c.NetworkSettings.Networks = map[string]docker.EndpointSettings{"backend": backend}
+				r.containers[id] = c
+			},
+			event:   networkEvent("disconnect", map[string]string{"container": id, "name": "bridge"}),
+			inspect: true,
+			want:    []string{"local | " + id + " | backend | 172.20.0.2 | online", other, "port local backend 80/tcp open"},
+		},
+		{
+			name:   "destroy",
+			change: func(r *fakeEventRuntime) { delete(r.containers, id) },
+			event:  containerEvent("destroy"),
+			want:   []string{other},
+		},
+		{
+			name:    "not found",
+			change:  func(r *fakeEventRuntime) { delete(r.containers, id) },
+			event:   containerEvent("die"),
+			inspect: true,
+			want:    []string{other},
+		},
+		{
+			name:    "inspect fails",
+			change:  func(r *fakeEventRuntime) { r.inspectErr = errors.New("connection reset by peer") },
+			event:   containerEvent("rename"),
+			inspect: true,
+			fails:   true,
+			want:    []string{"local | " + id + " | bridge | 172.17.0.2 | online", other, "port local bridge 80/tcp open"},
+		},
+		{
+			name:  "network event without a container",
+			event: networkEvent("connect", nil),
+			want:  []string{"local | " + id + " | bridge | 172.17.0.2 | online", other, "port local bridge 80/tcp open"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestScanner(t)
+			var mu sync.Mutex
+			ctx := context.Background()
+			scan := db.ScanRef{Type: "dockerwatch"}
+			start := web
+			start.NetworkSettings.Networks = map[string]docker.EndpointSettings{"bridge": web.NetworkSettings.Networks["bridge"]}
+			r := &fakeEventRuntime{name: "local", containers: map[string]docker.Container{id: start}}
+			if _, err := s.Store.DB.Exec(`INSERT INTO docker_hosts (engine, container_id, name, network_name) VALUES ('nas', ?, 'web', 'bridge')`, id); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.applyDockerEvent(ctx, r, "192.168.1.5", containerEvent("start"), scan, &mu); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.change != nil {
+				tt.change(r)
+			}
+			r.inspected = nil
+			err := s.applyDockerEvent(ctx, r, "192.168.1.5", tt.event, scan, &mu)
+			if (err != nil) != tt.fails {
+				t.Errorf("applyDockerEvent error = %v, want failure %v", err, tt.fails)
+			}
+			if inspected := len(r.inspected) > 0; inspected != tt.inspect {
+				t.Errorf("inspected %v, want an inspect %v", r.inspected, tt.inspect)
+			}
+			if got := dockerState(t, s); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("docker state:\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package scan
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"atlas/internal/utils"
+)
+
+// lanRunner replays a small network recorded under testdata/lan: this host is 192.168.1.5 and
+// 2001:db8:1::5 on lan0, with a router, a NAS and a printer next to it, and a containerd engine
+// running one container. Only the deep scans of the router, the NAS and the printer's IPv6
+// address were recorded; the others fail like scans of hosts that went away. The Docker API
+// engine is served by startEngine.
+var lanRunner = utils.ReplayRunner{Dir: filepath.Join("testdata", "lan")}
+
+// newLANScanner returns a scanner on a fresh database that runs every command against lanRunner.
+func newLANScanner(t *testing.T) *Scanner {
+	t.Helper()
+	t.Setenv("SCAN_SUBNETS", "")
+	t.Setenv("SCAN_EXCLUDE", "192.168.1.50")
+	t.Setenv("DISCOVERY_BACKEND", "nmap")
+	dir := t.TempDir()
+	t.Setenv("DEVICE_RULES_FILE", filepath.Join(dir, "device_rules.yaml"))
+	t.Setenv("DEEPSCAN_PROFILE", "")
+	t.Setenv("DEEPSCAN_PROFILES_FILE", filepath.Join(dir, "scan_profiles.yaml"))
+	t.Setenv("DOCKER_ENGINES_FILE", filepath.Join(dir, "docker_engines.yaml"))
+	s := newTestScanner(t)
+	s.Runner = lanRunner
+	return s
+}
+
+// queryRows returns the rows of q with their columns joined by " | ", NULL as "".
+func queryRows(t *testing.T, s *Scanner, q string) []string {
+	t.Helper()
+	rows, err := s.Store.DB.Query(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for rows.Next() {
+		vals := make([]sql.NullString, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			t.Fatal(err)
+		}
+		fields := make([]string, len(vals))
+		for i, v := range vals {
+			fields[i] = v.String
+		}
+		out = append(out, strings.Join(fields, " | "))
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func checkRows(t *testing.T, s *Scanner, q string, want []string) {
+	t.Helper()
+	if got := queryRows(t, s, q); !reflect.DeepEqual(got, want) {
+		t.Errorf("%s =\n\t%s\nwant\n\t%s", q, strings.Join(got, "\n\t"), strings.Join(want, "\n\t"))
+	}
+}
+
+func TestFastScanReplay(t *testing.T) {
+	s := newLANScanner(t)
+	if err := s.FastScan(); err != nil {
+		t.Fatalf("FastScan: %v", err)
+	}
+
+	// Both lan0 subnets are found, the printer's MAC comes from the neighbor table and IPv6
+	// hosts are reached through the IPv6 default gateway
+	checkRows(t, s, `SELECT ip, name, mac_address, next_hop, interface_name, online_status, address_family, vendor FROM hosts ORDER BY ip`, []string{
+		"192.168.1.1 | router.lan | 00:11:32:aa:bb:cc | 192.168.1.1 | lan0 | online | ipv4 | Synology",
+		"192.168.1.10 | nas.lan | 52:54:00:12:34:56 | 192.168.1.1 | lan0 | online | ipv4 | QEMU virtual NIC",
+		"192.168.1.20 | printer.lan | 00:1b:a9:01:02:03 | 192.168.1.1 | lan0 | online | ipv4 | ",
+		"192.168.1.5 | atlas.lan | Unknown | 192.168.1.1 | lan0 | online | ipv4 | ",
+		"2001:db8:1::1 | NoName | 00:11:32:aa:bb:cc | fe80::1 | lan0 | online | ipv6 | Synology",
+		"2001:db8:1::20 | printer.lan | 00:1b:a9:01:02:03 | fe80::1 | lan0 | online | ipv6 | ",
+		"2001:db8:1::5 | NoName | Unknown | fe80::1 | lan0 | online | ipv6 | ",
+	})
+	checkRows(t, s, `SELECT public_ip FROM external_networks`, []string{"203.0.113.45"})
+	checkRows(t, s, `SELECT scan_type, targets, status, hosts_found, hosts_updated, error, version FROM scan_runs`, []string{
+		"fastscan | 192.168.1.0/24,2001:db8:1::/64 | success | 7 | 7 |  | test",
+	})
+	if _, err := os.Stat(filepath.Join(s.LogDir, "fast_scan_progress.log")); err != nil {
+		t.Errorf("no progress log: %v", err)
+	}
+
+	// A second scan updates the same rows
+	if err := s.FastScan(); err != nil {
+		t.Fatalf("second FastScan: %v", err)
+	}
+	checkRows(t, s, `SELECT COUNT(*), MIN(last_scan_run_id) FROM hosts`, []string{"7 | 2"})
+	// Every host was first seen by the first scan; the second changed nothing
+	checkRows(t, s, `SELECT event_type, COUNT(*) FROM host_events GROUP BY event_type`, []string{"first_seen | 7"})
+}
+
+func TestDeepScanReplay(t *testing.T) {
+	s := newLANScanner(t)
+	if err := s.FastScan(); err != nil {
+		t.Fatalf("FastScan: %v", err)
+	}
+	if err := s.DeepScan(context.Background(), ""); err != nil {
+		t.Fatalf("DeepScan: %v", err)
+	}
+
+	// Hosts whose scan was recorded get its ports and OS; the others keep what the fast scan
+	// found. 192.168.1.20 and 2001:db8:1::1 answer neither nmap nor ping and go offline; this
+	// host's own addresses stay online.
+	checkRows(t, s, `SELECT ip, name, open_ports, os_details, os_accuracy, uptime_seconds, distance, online_status, scan_profile
+		FROM hosts ORDER BY ip`, []string{
+		"192.168.1.1 | router.lan | 22/tcp (ssh), 53/tcp (domain), 80/tcp (http) | Linux 4.15 - 5.8 | 96 | 1209600 | 1 | online | default",
+		"192.168.1.10 | nas.lan | 22/tcp (ssh), 443/tcp (https), 445/tcp (microsoft-ds) | Linux 5.0 - 5.14 | 95 | 0 | 1 | online | default",
+		"192.168.1.20 | printer.lan | Unknown | Unknown |  |  |  | offline | ",
+		"192.168.1.5 | atlas.lan | Unknown | Unknown |  |  |  | online | ",
+		"2001:db8:1::1 | NoName | Unknown | Unknown |  |  |  | offline | ",
+		"2001:db8:1::20 | printer.lan | 80/tcp (http), 631/tcp (ipp) | Brother HL-L2350DW printer | 91 | 0 | 1 | online | default",
+		"2001:db8:1::5 | NoName | Unknown | Unknown |  |  |  | online | ",
+	})
+	checkRows(t, s, `SELECT h.ip, p.port, p.protocol, p.state, p.service, p.product, p.version, p.method
+		FROM host_ports p JOIN hosts h ON p.host_id = h.id WHERE p.host_kind = 'host' ORDER BY h.ip, p.port`, []string{
+		"192.168.1.1 | 22 | tcp | open | ssh |  |  | table",
+		"192.168.1.1 | 53 | tcp | open | domain |  |  | table",
+		"192.168.1.1 | 80 | tcp | open | http |  |  | table",
+		"192.168.1.10 | 22 | tcp | open | ssh |  |  | table",
+		"192.168.1.10 | 443 | tcp | open | https |  |  | table",
+		"192.168.1.10 | 445 | tcp | open | microsoft-ds |  |  | table",
+		"2001:db8:1::20 | 80 | tcp | open | http |  |  | table",
+		"2001:db8:1::20 | 631 | tcp | open | ipp |  |  | table",
+	})
+	checkRows(t, s, `SELECT ip, event_type, old_value, new_value FROM host_events
+		WHERE scan_type = 'deepscan' AND ip IN ('192.168.1.1', '192.168.1.20') ORDER BY ip, id`, []string{
+		"192.168.1.1 | os_changed | Unknown | Linux 4.15 - 5.8",
+		"192.168.1.1 | port_opened |  | 22/tcp",
+		"192.168.1.1 | port_opened |  | 53/tcp",
+		"192.168.1.1 | port_opened |  | 80/tcp",
+		"192.168.1.20 | offline | online | offline",
+	})
+	// The NAS is a VM with a locally administered MAC
+	checkRows(t, s, `SELECT ip, mac_address, vendor, mac_local_admin FROM hosts WHERE mac_address != 'Unknown' ORDER BY ip`, []string{
+		"192.168.1.1 | 00:11:32:aa:bb:cc | Synology | 0",
+		"192.168.1.10 | 52:54:00:12:34:56 | QEMU virtual NIC | 1",
+		"192.168.1.20 | 00:1b:a9:01:02:03 |  | 0",
+		"2001:db8:1::1 | 00:11:32:aa:bb:cc | Synology | 0",
+		"2001:db8:1::20 | 00:1b:a9:01:02:03 | Brother Industries | 0",
+	})
+	// The router is the gateway, the printer serves ipp and the NAS is named after its role
+	checkRows(t, s, `SELECT ip, device_type FROM hosts WHERE ip IN ('192.168.1.1', '192.168.1.10', '2001:db8:1::20') ORDER BY ip`, []string{
+		"192.168.1.1 | router",
+		"192.168.1.10 | nas",
+		"2001:db8:1::20 | printer",
+	})
+	// The addresses of a dual-stack device share its MAC and so its device
+	checkRows(t, s, `SELECT group_concat(ip) FROM (SELECT ip, device_id FROM hosts ORDER BY ip) GROUP BY device_id ORDER BY MIN(ip)`, []string{
+		"192.168.1.1,2001:db8:1::1",
+		"192.168.1.10",
+		"192.168.1.20,2001:db8:1::20",
+		"192.168.1.5",
+		"2001:db8:1::5",
+	})
+	checkRows(t, s, `SELECT scan_type, status, hosts_found, profile FROM scan_runs WHERE scan_type = 'deepscan'`, []string{
+		"deepscan | success | 7 | default",
+	})
+}
+
+func TestDeepScanServiceDetection(t *testing.T) {
+	s := newLANScanner(t)
+	t.Setenv("DEEPSCAN_SERVICE_DETECTION", "nmap")
+	if err := s.FastScan(); err != nil {
+		t.Fatalf("FastScan: %v", err)
+	}
+	if err := s.DeepScan(context.Background(), ""); err != nil {
+		t.Fatalf("DeepScan: %v", err)
+	}
+
+	// Only the NAS's version scan was recorded; the others keep nmap's guess from the port number
+	checkRows(t, s, `SELECT h.ip, p.port, p.service, p.product, p.version, p.method FROM host_ports p JOIN hosts h ON p.host_id = h.id
+		WHERE p.host_kind = 'host' AND h.ip IN ('192.168.1.1', '192.168.1.10') ORDER BY h.ip, p.port`, []string{
+		"192.168.1.1 | 22 | ssh |  |  | table",
+		"192.168.1.1 | 53 | domain |  |  | table",
+		"192.168.1.1 | 80 | http |  |  | table",
+		"192.168.1.10 | 22 | ssh | OpenSSH | 9.2p1 Debian 2+deb12u3 | probed",
+		"192.168.1.10 | 443 | http | nginx | 1.22.1 | probed",
+		"192.168.1.10 | 445 | netbios-ssn | Samba smbd | 4.6.2 | probed",
+	})
+	checkRows(t, s, `SELECT open_ports FROM hosts WHERE ip = '192.168.1.10'`, []string{
+		"22/tcp (ssh), 443/tcp (http), 445/tcp (netbios-ssn)",
+	})
+}
+
+// engineFiles serves the Engine API responses recorded under ../docker/testdata/engine.
+func engineFiles(w http.ResponseWriter, r *http.Request) {
+	name := ""
+	switch path := r.URL.Path; {
+	case path == "/_ping":
+		w.Write([]byte("OK"))
+		return
+	case path == "/version":
+		name = "version_podman.json"
+	case path == "/containers/json":
+		name = "containers.json"
+	case path == "/networks":
+		name = "networks.json"
+	case strings.HasPrefix(path, "/containers/") && strings.HasSuffix(path, "/json"):
+		name = "container_" + strings.TrimSuffix(strings.TrimPrefix(path, "/containers/"), "/json") + ".json"
+	}
+	data, err := os.ReadFile(filepath.Join("..", "docker", "testdata", "engine", name))
+	if name == "" || err != nil {
+		http.Error(w, `{"message":"page not found"}`, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// startEngine serves engineFiles on a unix socket and returns the server and the socket path.
+func startEngine(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "podman.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(engineFiles))
+	srv.Listener.Close()
+	srv.Listener = ln
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv, socket
+}
+
+func TestDockerScanReplay(t *testing.T) {
+	s := newLANScanner(t)
+	srv, socket := startEngine(t)
+	engines := "engines:\n" +
+		"  - name: local\n    host: unix://" + socket + "\n" +
+		"  - name: edge\n    host: unix:///run/containerd/containerd.sock\n    runtime: containerd\n"
+	if err := os.WriteFile(os.Getenv("DOCKER_ENGINES_FILE"), []byte(engines), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DockerScan(); err != nil {
+		t.Fatalf("DockerScan: %v", err)
+	}
+	// The local engine is detected as Podman from its version; one row per container network, whose
+	// gateway is the next hop, and the stopped container has no address
+	checkRows(t, s, `SELECT engine, runtime, name, ip, mac_address, os_details, open_ports, next_hop, network_name, online_status
+		FROM docker_hosts ORDER BY engine, name, network_name`, []string{
+		"edge | containerd | dns | 10.4.0.5 | 3a:1f:9c:00:04:05 | docker.io/coredns/coredns:1.11.1 | 53/udp -> 0.0.0.0:53 | 10.4.0.1 | bridge | online",
+		"local | podman | backup |  |  | restic/restic:0.16.4 | no_ports | 172.17.0.1 | bridge | offline",
+		"local | podman | web | 172.17.0.2 | 02:42:ac:11:00:02 | nginx:1.25 | 443/tcp (internal),80/tcp -> 0.0.0.0:8080 | 172.17.0.1 | bridge | online",
+		"local | podman | web | 172.20.0.5 | 02:42:ac:14:00:05 | nginx:1.25 | 443/tcp (internal),80/tcp -> 0.0.0.0:8080 | 172.20.0.1 | site_default | online",
+	})
+	// Every network of both engines, on the machine the engine runs on
+	checkRows(t, s, `SELECT engine, name, driver, subnet, gateway, host_address FROM docker_networks ORDER BY engine, name`, []string{
+		"edge | bridge |  | 10.4.0.0/24 | 10.4.0.1 | 192.168.1.5",
+		"local | bridge | bridge | 172.17.0.0/16 | 172.17.0.1 | 192.168.1.5",
+		"local | host | host |  |  | 192.168.1.5",
+		"local | site_default | bridge | 172.20.0.0/16 | 172.20.0.1 | 192.168.1.5",
+	})
+	// Published ports are open; exposed ones are only reachable from other containers
+	checkRows(t, s, `SELECT d.engine, d.name, d.network_name, p.port, p.protocol, p.state FROM host_ports p JOIN docker_hosts d ON p.host_id = d.id
+		WHERE p.host_kind = 'docker' ORDER BY d.engine, d.network_name, p.port`, []string{
+		"edge | dns | bridge | 53 | udp | open",
+		"local | web | bridge | 80 | tcp | open",
+		"local | web | bridge | 443 | tcp | exposed",
+		"local | web | site_default | 80 | tcp | open",
+		"local | web | site_default | 443 | tcp | exposed",
+	})
+	checkRows(t, s, `SELECT scan_type, targets, status, hosts_found, hosts_updated, error FROM scan_runs`, []string{
+		"dockerscan | local,edge | success | 3 | 4 | ",
+	})
+
+	// Containers that disappeared are removed on the next scan, while an engine that went away
+	// keeps its rows from the last one
+	if _, err := s.Store.DB.Exec(`INSERT INTO docker_hosts (engine, container_id, name, network_name) VALUES ('edge', '0a1b2c3d4e5f', 'old', 'bridge')`); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+	if err := s.DockerScan(); err != nil {
+		t.Fatalf("DockerScan without the local engine: %v", err)
+	}
+	checkRows(t, s, `SELECT engine, COUNT(*), MAX(last_scan_run_id) FROM docker_hosts GROUP BY engine ORDER BY engine`, []string{
+		"edge | 1 | 2",
+		"local | 3 | 1",
+	})
+	checkRows(t, s, `SELECT status, hosts_found, error != '' FROM scan_runs WHERE id = 2`, []string{"success | 1 | 1"})
+
+	// And when no engine answers, the scan fails
+	t.Setenv("DOCKER_ENGINES_FILE", "")
+	s.Runtimes = []ContainerRuntime{containerdRuntime{name: "gone", address: "/run/gone.sock", namespace: "default", runner: lanRunner}}
+	if err := s.DockerScan(); err == nil {
+		t.Error("DockerScan succeeded although no engine could be scanned")
+	}
+}
@@ -1,20 +1,25 @@
 package scan
 
 import (
-    "database/sql"
+    "bytes"
+    "context"
     "fmt"
+    "net"
     "os"
-    "os/exec"
     "strings"
     "time"
 
-    _ "github.com/mattn/go-sqlite3"
+    "atlas/internal/db"
     "atlas/internal/utils"
 )
 
-// POINT 1: Get the default gateway IP (internal)
-func getDefaultGateway() (string, error) {
-    out, err := exec.Command("ip", "route").Output()
+// POINT 1: Get the default gateway IP (internal) for IPv4, or IPv6 when ipv6 is set
+func (s *Scanner) getDefaultGateway(ipv6 bool) (string, error) {
+    args := []string{"route"}
+    if ipv6 {
+        args = []string{"-6", "route"}
+    }
+    out, err := s.Runner.Output(context.Background(), "ip", args...)
     if err != nil {
         return "", err
     }
@@ -31,64 +36,158 @@ func getDefaultGateway() (string, error) {
     return "", fmt.Errorf("no default gateway found")
 }
 
-func runNmap(subnet string) (map[string]string, error) {
-    out, err := exec.Command("nmap", "-sn", subnet).Output()
+// runNmap ping-sweeps a subnet with `nmap -sn`. Run as root on an attached network, nmap
+// discovers hosts by ARP and reports each one's MAC address and vendor.
+func (s *Scanner) runNmap(subnet string, exclude string) (map[string]DiscoveredHost, error) {
+    args := []string{"-sn", subnet, "-oX", "-"}
+    if exclude != "" {
+        args = append(args, "--exclude", exclude)
+    }
+    out, err := s.Runner.Output(context.Background(), "nmap", args...)
+    if err != nil {
+        return nil, err
+    }
+    run, err := parseNmapXML(bytes.NewReader(out))
     if err != nil {
         return nil, err
     }
 
-    hosts := make(map[string]string)
-    for _, line := range strings.Split(string(out), "\n") {
-        if strings.HasPrefix(line, "Nmap scan report for") {
-            fields := strings.Fields(line)
-            if len(fields) == 6 && strings.HasPrefix(fields[5], "(") {
-                name := fields[4]
-                ip := strings.Trim(fields[5], "()")
-                hosts[ip] = name
-            } else if len(fields) == 5 {
-                ip := fields[4]
-                name := "NoName"
-                hosts[ip] = name
-            }
+    hosts := make(map[string]DiscoveredHost)
+    for i := range run.Hosts {
+        h := &run.Hosts[i]
+        if h.Status.State != "up" || h.Addr() == "" {
+            continue
+        }
+        name := h.Hostname()
+        if name == "" {
+            name = "NoName"
         }
+        mac, vendor := h.MAC()
+        hosts[h.Addr()] = DiscoveredHost{Name: name, MAC: strings.ToLower(mac), Vendor: vendor}
     }
     return hosts, nil
 }
 
 // POINT 2: Assign next_hop for LAN hosts to the gateway IP
-func updateSQLiteDB(hosts map[string]string, gatewayIP string, interfaceName string) error {
-    dbPath := "/config/db/atlas.db"
-    db, err := sql.Open("sqlite3", dbPath)
+// Hosts discovered without a MAC keep whatever MAC and vendor a previous scan recorded.
+// Changes are appended to the host history in the same transaction.
+// It returns the number of hosts written.
+func (s *Scanner) updateSQLiteDB(hosts map[string]DiscoveredHost, gatewayIP string, iface utils.InterfaceInfo, scan db.ScanRef) (int, error) {
+    // Load the vendor list before the transaction takes the store's only connection
+    s.vendors()
+    tx, err := s.Store.DB.Begin()
     if err != nil {
-        return err
+        return 0, err
     }
-    defer db.Close()
+    defer tx.Rollback()
 
-    // Mark all hosts as offline before scanning (only for this specific interface)
-    _, err = db.Exec("UPDATE hosts SET online_status = 'offline' WHERE interface_name = ?", interfaceName)
+    prev, err := db.LoadHostStates(tx, iface.Name)
     if err != nil {
-        fmt.Printf("Failed to mark hosts as offline for interface %s: %v\n", interfaceName, err)
+        return 0, fmt.Errorf("failed to load host states: %v", err)
+    }
+
+    // Mark hosts as offline before scanning (only those of this interface inside the scanned subnet,
+    // so the IPv4 and IPv6 prefixes of one interface don't knock each other offline)
+    if err := markSubnetOffline(tx, iface); err != nil {
+        fmt.Printf("Failed to mark hosts as offline for interface %s: %v\n", iface.Name, err)
     }
 
-    for ip, name := range hosts {
-        _, err = db.Exec(`
-            INSERT INTO hosts (ip, name, os_details, mac_address, open_ports, next_hop, network_name, interface_name, last_seen, online_status)
-            VALUES (?, ?, 'Unknown', 'Unknown', 'Unknown', ?, 'LAN', ?, CURRENT_TIMESTAMP, 'online')
+    updated := 0
+    for ip, h := range hosts {
+        mac := h.MAC
+        if mac == "" {
+            mac = "Unknown"
+        }
+        vendor, localMAC := s.macVendor(mac)
+        if vendor == "" {
+            vendor = h.Vendor
+        }
+        _, err := tx.Exec(`
+            INSERT INTO hosts (ip, name, os_details, mac_address, open_ports, next_hop, network_name, interface_name, last_seen, online_status, address_family, last_scan_run_id, vendor, mac_local_admin)
+            VALUES (?, ?, 'Unknown', ?, 'Unknown', ?, 'LAN', ?, CURRENT_TIMESTAMP, 'online', ?, ?, ?, ?)
             ON CONFLICT(ip, interface_name) DO UPDATE SET
                 name=excluded.name,
                 last_seen=excluded.last_seen,
                 online_status=excluded.online_status,
-                next_hop=excluded.next_hop
-        `, ip, name, gatewayIP, interfaceName, time.Now().Format("2006-01-02 15:04:05"))
+                next_hop=excluded.next_hop,
+                address_family=excluded.address_family,
+                last_scan_run_id=excluded.last_scan_run_id,
+                mac_address=CASE WHEN excluded.mac_address != 'Unknown' THEN excluded.mac_address ELSE hosts.mac_address END,
+                vendor=CASE WHEN excluded.mac_address != 'Unknown' THEN excluded.vendor ELSE hosts.vendor END,
+                mac_local_admin=CASE WHEN excluded.mac_address != 'Unknown' THEN excluded.mac_local_admin ELSE hosts.mac_local_admin END
+        `, ip, h.Name, mac, gatewayIP, iface.Name, addressFamily(ip), scan.RunIDValue(), vendor, localMAC)
         if err != nil {
-            fmt.Printf("Insert/update failed for %s on interface %s: %v\n", ip, interfaceName, err)
+            fmt.Printf("Insert/update failed for %s on interface %s: %v\n", ip, iface.Name, err)
+            continue
         }
+        updated++
     }
 
+    // Snapshot every host seen by this scan; hosts that were not seen only get their offline event
+    cur, err := db.LoadHostStates(tx, iface.Name)
+    if err != nil {
+        return 0, fmt.Errorf("failed to load host states: %v", err)
+    }
+    for ip, state := range cur {
+        var before *db.HostState
+        if p, ok := prev[ip]; ok {
+            before = &p
+        }
+        _, seen := hosts[ip]
+        if err := db.RecordHostObservation(tx, before, state, scan, seen); err != nil {
+            return 0, err
+        }
+        if seen {
+            if _, err := db.LinkDevice(tx, state, nil); err != nil {
+                return 0, err
+            }
+            evidence, err := hostEvidence(tx, state, hosts[ip].Announced)
+            if err != nil {
+                return 0, err
+            }
+            if err := storeDeviceType(tx, state.ID, s.classifier().Classify(evidence), true); err != nil {
+                return 0, err
+            }
+        }
+    }
+
+    return updated, tx.Commit()
+}
+
+func markSubnetOffline(q db.DBTX, iface utils.InterfaceInfo) error {
+    _, subnet, err := net.ParseCIDR(iface.Subnet)
+    if err != nil {
+        return err
+    }
+    rows, err := q.Query("SELECT id, ip FROM hosts WHERE interface_name = ?", iface.Name)
+    if err != nil {
+        return err
+    }
+    var ids []int64
+    for rows.Next() {
+        var id int64
+        var ip string
+        if err := rows.Scan(&id, &ip); err != nil {
+            rows.Close()
+            return err
+        }
+        if subnet.Contains(net.ParseIP(ip)) {
+            ids = append(ids, id)
+        }
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return err
+    }
+    for _, id := range ids {
+        if _, err := q.Exec("UPDATE hosts SET online_status = 'offline' WHERE id = ?", id); err != nil {
+            return err
+        }
+    }
     return nil
 }
 
-func updateExternalIPInDB(dbPath string) {
+func (s *Scanner) updateExternalIPInDB() {
     urls := []string{
         "https://ifconfig.me",
         "https://api.ipify.org",
@@ -96,7 +195,7 @@ func updateExternalIPInDB(dbPath string) {
 
     var ip string
     for _, url := range urls {
-        out, err := exec.Command("curl", "-s", url).Output()
+        out, err := s.Runner.Output(context.Background(), "curl", "-s", url)
         if err == nil && len(out) > 0 {
             ip = strings.TrimSpace(string(out))
             break
@@ -108,19 +207,13 @@ func updateExternalIPInDB(dbPath string) {
         return
     }
 
-    db, err := sql.Open("sqlite3", dbPath)
-    if err != nil {
-        fmt.Println("❌ Failed to open DB:", err)
-        return
-    }
-    defer db.Close()
-
-    _, _ = db.Exec(`
+    conn := s.Store.DB
+    _, _ = conn.Exec(`
         INSERT OR IGNORE INTO external_networks (public_ip)
         VALUES (?)
     `, ip)
 
-    _, _ = db.Exec(`
+    _, _ = conn.Exec(`
         UPDATE external_networks
         SET last_seen = CURRENT_TIMESTAMP
         WHERE public_ip = ?
@@ -129,23 +222,41 @@ func updateExternalIPInDB(dbPath string) {
     fmt.Println("🌐 External IP recorded:", ip)
 }
 
-func FastScan() error {
+// neighborMACs returns ip -> MAC for the kernel neighbor entries of an interface (both families).
+func (s *Scanner) neighborMACs(ifName string) map[string]string {
+    macs := make(map[string]string)
+    neighbors, err := utils.GetNeighbors(s.Runner)
+    if err != nil {
+        return macs
+    }
+    for _, n := range neighbors {
+        if n.Interface == ifName {
+            macs[n.IP] = n.MAC
+        }
+    }
+    return macs
+}
+
+func (s *Scanner) FastScan() (err error) {
+    run := s.startRun("fastscan")
+    defer func() { run.Finish(err) }()
+
     // progress log similar to deep scan
-    logFile := "/config/logs/fast_scan_progress.log"
+    logFile := s.logPath("fast_scan_progress.log")
     lf, _ := os.Create(logFile)
     if lf == nil {
         // fallback to stdout only
-        return fastScanCore(nil)
+        return s.fastScanCore(nil, run)
     }
     defer lf.Close()
     start := time.Now()
-    fmt.Fprintf(lf, "🚀 Fast scan started at %s\n", start.Format(time.RFC3339))
-    err := fastScanCore(lf)
+    fmt.Fprintf(lf, "🚀 Fast scan %d started at %s\n", run.ID, start.Format(time.RFC3339))
+    err = s.fastScanCore(lf, run)
     fmt.Fprintf(lf, "Fast scan complete in %s\n", time.Since(start))
     return err
 }
 
-func fastScanCore(lf *os.File) error {
+func (s *Scanner) fastScanCore(lf *os.File, run *scanRun) error {
     logf := func(format string, args ...any) {
         msg := fmt.Sprintf(format, args...)
         fmt.Println(msg)
@@ -154,39 +265,71 @@ func fastScanCore(lf *os.File) error {
         }
     }
 
-    // Get all network interfaces
-    interfaces, err := utils.GetAllInterfaces()
+    // Resolve scan targets (SCAN_SUBNETS / auto-detected interfaces, minus SCAN_EXCLUDE)
+    targets, err := utils.ResolveTargets(s.Runner)
     if err != nil {
-        return fmt.Errorf("failed to detect network interfaces: %v", err)
+        return fmt.Errorf("failed to resolve scan targets: %v", err)
     }
 
-    gatewayIP, err := getDefaultGateway()
+    discoveryCfg := DiscoveryConfigFromEnv()
+    discoverer, err := s.NewDiscoverer(discoveryCfg)
+    if err != nil {
+        return err
+    }
+
+    gatewayIP, err := s.getDefaultGateway(false)
     if err != nil {
         logf("⚠️ Could not determine gateway: %v", err)
         gatewayIP = ""
     }
+    gatewayIPv6, _ := s.getDefaultGateway(true)
 
     totalHosts := 0
-    // Scan each interface separately
-    for _, iface := range interfaces {
+    // Scan each target separately
+    for _, target := range targets {
+        iface := target.InterfaceInfo
+        run.Targets = append(run.Targets, iface.Subnet)
         logf("Discovering live hosts on %s (interface: %s)...", iface.Subnet, iface.Name)
-        hosts, err := runNmap(iface.Subnet)
+        hosts, err := discoverer.Discover(target)
         if err != nil {
             logf("⚠️ Failed to scan subnet %s on interface %s: %v", iface.Subnet, iface.Name, err)
+            run.Warnf("discovery on %s failed: %v", iface.Subnet, err)
             continue
         }
         logf("Discovered %d hosts on %s", len(hosts), iface.Subnet)
         totalHosts += len(hosts)
 
+        // Discovery just talked to these hosts, so the kernel neighbor table knows the MACs
+        // that the discovery output did not carry (ICMP sweeps, nmap without root)
+        neighbors := s.neighborMACs(iface.Name)
+        for ip, h := range hosts {
+            if h.MAC == "" && neighbors[ip] != "" {
+                h.MAC = neighbors[ip]
+                hosts[ip] = h
+            }
+        }
+        addAnnouncements(hosts, target, discoveryCfg)
+        nextHop := gatewayIP
+        if iface.IsIPv6() {
+            nextHop = gatewayIPv6
+        }
+        // Routed subnets are reached through their own gateway, not necessarily the default one
+        if target.Gateway != "" {
+            nextHop = target.Gateway
+        }
+
         // Update database with hosts from this interface
-        err = updateSQLiteDB(hosts, gatewayIP, iface.Name)
+        updated, err := s.updateSQLiteDB(hosts, nextHop, iface, run.Ref())
         if err != nil {
             logf("⚠️ Failed to update database for interface %s: %v", iface.Name, err)
+            run.Warnf("database update for %s failed: %v", iface.Subnet, err)
             continue
         }
+        run.Updated += updated
     }
+    run.Found = totalHosts
 
-    updateExternalIPInDB("/config/db/atlas.db")
-    logf("Total hosts updated: %d", totalHosts)
+    s.updateExternalIPInDB()
+    logf("Total hosts found: %d, updated: %d", totalHosts, run.Updated)
     return nil
 }
\ No newline at end of file
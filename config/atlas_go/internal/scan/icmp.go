@@ -0,0 +1,192 @@
+package scan
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	icmpEchoReply   = 0
+	icmpEchoRequest = 8
+)
+
+// icmpPinger sends ICMP echo requests over a single socket and routes replies back to the waiting prober.
+type icmpPinger struct {
+	conn net.PacketConn
+	raw  bool // raw sockets see every ICMP packet on the host, so replies must be matched by id
+	id   uint16
+
+	mu      sync.Mutex
+	seq     uint16
+	waiting map[string]chan struct{}
+}
+
+// newICMPPinger opens a raw ICMP socket, falling back to an unprivileged datagram socket
+// (net.ipv4.ping_group_range) when CAP_NET_RAW is not available.
+func newICMPPinger() (*icmpPinger, error) {
+	p := &icmpPinger{id: uint16(os.Getpid() & 0xffff), waiting: make(map[string]chan struct{})}
+	conn, rawErr := net.ListenPacket("ip4:icmp", "0.0.0.0")
+	if rawErr == nil {
+		p.conn, p.raw = conn, true
+		return p, nil
+	}
+	conn, dgramErr := listenICMPDatagram(syscall.AF_INET, syscall.IPPROTO_ICMP, &syscall.SockaddrInet4{})
+	if dgramErr != nil {
+		return nil, fmt.Errorf("no ICMP socket available (raw: %v, datagram: %v)", rawErr, dgramErr)
+	}
+	p.conn = conn
+	return p, nil
+}
+
+// listenICMPDatagram opens an unprivileged ICMP socket of the given family bound to sa.
+// Replies are read without the IP header and addressed as *net.UDPAddr.
+func listenICMPDatagram(domain, proto int, sa syscall.Sockaddr) (net.PacketConn, error) {
+	fd, err := syscall.Socket(domain, syscall.SOCK_DGRAM, proto)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	f := os.NewFile(uintptr(fd), "icmp")
+	defer f.Close()
+	return net.FilePacketConn(f)
+}
+
+func (p *icmpPinger) Close() error {
+	return p.conn.Close()
+}
+
+// listen dispatches echo replies until the socket is closed.
+func (p *icmpPinger) listen() {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := p.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if n < 8 || buf[0] != icmpEchoReply {
+			continue
+		}
+		if p.raw && binary.BigEndian.Uint16(buf[4:6]) != p.id {
+			continue
+		}
+		var src string
+		switch a := addr.(type) {
+		case *net.IPAddr:
+			src = a.IP.String()
+		case *net.UDPAddr:
+			src = a.IP.String()
+		}
+		p.mu.Lock()
+		if ch, ok := p.waiting[src]; ok {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+		p.mu.Unlock()
+	}
+}
+
+// ping sends one echo request to ip and reports whether a reply arrived within timeout.
+func (p *icmpPinger) ping(ip net.IP, timeout time.Duration) bool {
+	key := ip.String()
+	ch := make(chan struct{}, 1)
+
+	p.mu.Lock()
+	p.seq++
+	seq := p.seq
+	p.waiting[key] = ch
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.waiting, key)
+		p.mu.Unlock()
+	}()
+
+	var dst net.Addr = &net.IPAddr{IP: ip}
+	if !p.raw {
+		dst = &net.UDPAddr{IP: ip}
+	}
+	if _, err := p.conn.WriteTo(icmpEcho(p.id, seq), dst); err != nil {
+		return false
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-ch:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// icmpEcho builds an ICMP echo request. The kernel rewrites id on datagram sockets.
+func icmpEcho(id, seq uint16) []byte {
+	msg := make([]byte, 16)
+	msg[0] = icmpEchoRequest
+	binary.BigEndian.PutUint16(msg[4:6], id)
+	binary.BigEndian.PutUint16(msg[6:8], seq)
+	copy(msg[8:], "atlas-ok")
+	binary.BigEndian.PutUint16(msg[2:4], icmpChecksum(msg))
+	return msg
+}
+
+func icmpChecksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = (sum & 0xffff) + (sum >> 16)
+	}
+	return ^uint16(sum)
+}
+
+// icmpSweep pings every target with at most cfg.Concurrency probes in flight and returns the responders.
+func icmpSweep(targets []net.IP, cfg DiscoveryConfig) ([]string, error) {
+	p, err := newICMPPinger()
+	if err != nil {
+		return nil, err
+	}
+	defer p.Close()
+	go p.listen()
+
+	concurrency := cfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	alive := make(map[string]bool)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for _, ip := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(ip net.IP) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			for attempt := 0; attempt <= cfg.Retries; attempt++ {
+				if p.ping(ip, cfg.Timeout) {
+					mu.Lock()
+					alive[ip.String()] = true
+					mu.Unlock()
+					return
+				}
+			}
+		}(ip)
+	}
+	wg.Wait()
+	return sortedKeys(alive), nil
+}
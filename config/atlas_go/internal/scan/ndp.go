@@ -0,0 +1,139 @@
+package scan
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"atlas/internal/utils"
+)
+
+const (
+	icmpv6EchoRequest = 128
+	icmpv6EchoReply   = 129
+)
+
+// ndpDiscover finds IPv6 neighbors on an interface prefix. An IPv6 subnet cannot be swept address by
+// address, so it pings the all-nodes multicast group (ff02::1) from an address inside the prefix and
+// then merges the repliers with the kernel neighbor table, which also holds hosts that ignore
+// multicast echo but have talked to us recently.
+// Excluded addresses cannot be kept out of a multicast probe, so they are only filtered from the result.
+func ndpDiscover(r utils.Runner, target utils.ScanTarget, cfg DiscoveryConfig) (map[string]DiscoveredHost, error) {
+	iface := target.InterfaceInfo
+	_, prefix, err := net.ParseCIDR(iface.Subnet)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subnet %q: %v", iface.Subnet, err)
+	}
+
+	alive := make(map[string]bool)
+	repliers, err := multicastEcho6(iface, cfg)
+	if err != nil {
+		fmt.Printf("⚠️ IPv6 multicast echo on %s failed, using neighbor table only: %v\n", iface.Name, err)
+	}
+	for _, ip := range repliers {
+		if prefix.Contains(net.ParseIP(ip)) {
+			alive[ip] = true
+		}
+	}
+
+	neighbors, err := utils.GetNeighbors(r)
+	if err != nil && len(alive) == 0 {
+		return nil, fmt.Errorf("failed to read neighbor table: %v", err)
+	}
+	macs := make(map[string]string)
+	for _, n := range neighbors {
+		if n.Interface == iface.Name && prefix.Contains(net.ParseIP(n.IP)) {
+			alive[n.IP] = true
+			macs[n.IP] = n.MAC
+		}
+	}
+
+	// nmap reports the scanning host itself; keep that behaviour so the local node stays on the map.
+	if iface.IP != "" && prefix.Contains(net.ParseIP(iface.IP)) {
+		alive[iface.IP] = true
+	}
+	for ip := range alive {
+		if target.Excluded(ip) {
+			delete(alive, ip)
+		}
+	}
+
+	return withMACs(resolveNames(r, sortedKeys(alive), cfg.Concurrency), macs), nil
+}
+
+// multicastEcho6 sends echo requests to ff02::1 on the interface and returns the source addresses
+// of every reply received within the discovery timeout.
+func multicastEcho6(iface utils.InterfaceInfo, cfg DiscoveryConfig) ([]string, error) {
+	nif, err := net.InterfaceByName(iface.Name)
+	if err != nil {
+		return nil, err
+	}
+	src := net.ParseIP(iface.IP)
+	if src == nil {
+		return nil, fmt.Errorf("interface %s has no IPv6 address", iface.Name)
+	}
+
+	raw := true
+	zone := ""
+	if src.IsLinkLocalUnicast() {
+		zone = iface.Name
+	}
+	conn, rawErr := net.ListenPacket("ip6:ipv6-icmp", (&net.IPAddr{IP: src, Zone: zone}).String())
+	if rawErr != nil {
+		sa := &syscall.SockaddrInet6{ZoneId: uint32(nif.Index)}
+		copy(sa.Addr[:], src.To16())
+		var dgramErr error
+		conn, dgramErr = listenICMPDatagram(syscall.AF_INET6, syscall.IPPROTO_ICMPV6, sa)
+		if dgramErr != nil {
+			return nil, fmt.Errorf("no ICMPv6 socket available (raw: %v, datagram: %v)", rawErr, dgramErr)
+		}
+		raw = false
+	}
+	defer conn.Close()
+
+	id := uint16(os.Getpid() & 0xffff)
+	group := net.ParseIP("ff02::1")
+	var dst net.Addr = &net.IPAddr{IP: group, Zone: iface.Name}
+	if !raw {
+		dst = &net.UDPAddr{IP: group, Zone: iface.Name}
+	}
+
+	repliers := make(map[string]bool)
+	buf := make([]byte, 1500)
+	for attempt := 0; attempt <= cfg.Retries; attempt++ {
+		// The kernel fills in the ICMPv6 checksum, which covers the IPv6 pseudo-header.
+		msg := make([]byte, 16)
+		msg[0] = icmpv6EchoRequest
+		binary.BigEndian.PutUint16(msg[4:6], id)
+		binary.BigEndian.PutUint16(msg[6:8], uint16(attempt+1))
+		copy(msg[8:], "atlas-ok")
+		if _, err := conn.WriteTo(msg, dst); err != nil {
+			return nil, err
+		}
+
+		deadline := time.Now().Add(cfg.Timeout)
+		conn.SetReadDeadline(deadline)
+		for time.Now().Before(deadline) {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				break
+			}
+			if n < 8 || buf[0] != icmpv6EchoReply {
+				continue
+			}
+			if raw && binary.BigEndian.Uint16(buf[4:6]) != id {
+				continue
+			}
+			switch a := addr.(type) {
+			case *net.IPAddr:
+				repliers[a.IP.String()] = true
+			case *net.UDPAddr:
+				repliers[a.IP.String()] = true
+			}
+		}
+	}
+	return sortedKeys(repliers), nil
+}
@@ -0,0 +1,294 @@
+package scan
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"atlas/internal/db"
+)
+
+// NmapRun is the root element of nmap's -oX output.
+type NmapRun struct {
+	XMLName xml.Name   `xml:"nmaprun"`
+	Args    string     `xml:"args,attr"`
+	Start   int64      `xml:"start,attr"`
+	Version string     `xml:"version,attr"`
+	Hosts   []NmapHost `xml:"host"`
+}
+
+// NmapHost is a single <host> entry of an nmap run.
+type NmapHost struct {
+	Status    NmapStatus     `xml:"status"`
+	Addresses []NmapAddress  `xml:"address"`
+	Hostnames []NmapHostname `xml:"hostnames>hostname"`
+	Ports     []NmapPort     `xml:"ports>port"`
+	OSMatches []NmapOSMatch  `xml:"os>osmatch"`
+	Uptime    *NmapUptime    `xml:"uptime"`
+	Distance  *NmapDistance  `xml:"distance"`
+}
+
+type NmapStatus struct {
+	State  string `xml:"state,attr"`
+	Reason string `xml:"reason,attr"`
+}
+
+type NmapAddress struct {
+	Addr     string `xml:"addr,attr"`
+	AddrType string `xml:"addrtype,attr"`
+	Vendor   string `xml:"vendor,attr"`
+}
+
+type NmapHostname struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type NmapPort struct {
+	Protocol string       `xml:"protocol,attr"`
+	PortID   int          `xml:"portid,attr"`
+	State    NmapState    `xml:"state"`
+	Service  NmapService  `xml:"service"`
+	Scripts  []NmapScript `xml:"script"`
+}
+
+// NmapScript is the output of an NSE script; structured results are nested tables and elems.
+type NmapScript struct {
+	ID     string      `xml:"id,attr"`
+	Output string      `xml:"output,attr"`
+	Elems  []NmapElem  `xml:"elem"`
+	Tables []NmapTable `xml:"table"`
+}
+
+type NmapTable struct {
+	Key    string      `xml:"key,attr"`
+	Elems  []NmapElem  `xml:"elem"`
+	Tables []NmapTable `xml:"table"`
+}
+
+type NmapElem struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// elem returns the value of the elem with the given key, or "".
+func elem(elems []NmapElem, key string) string {
+	for _, e := range elems {
+		if e.Key == key {
+			return strings.TrimSpace(e.Value)
+		}
+	}
+	return ""
+}
+
+type NmapState struct {
+	State  string `xml:"state,attr"`
+	Reason string `xml:"reason,attr"`
+}
+
+type NmapService struct {
+	Name      string `xml:"name,attr"`
+	Product   string `xml:"product,attr"`
+	Version   string `xml:"version,attr"`
+	ExtraInfo string `xml:"extrainfo,attr"`
+	Method    string `xml:"method,attr"`
+	Conf      int    `xml:"conf,attr"`
+}
+
+type NmapOSMatch struct {
+	Name     string        `xml:"name,attr"`
+	Accuracy int           `xml:"accuracy,attr"`
+	Classes  []NmapOSClass `xml:"osclass"`
+}
+
+type NmapOSClass struct {
+	Type     string   `xml:"type,attr"`
+	Vendor   string   `xml:"vendor,attr"`
+	OSFamily string   `xml:"osfamily,attr"`
+	OSGen    string   `xml:"osgen,attr"`
+	Accuracy int      `xml:"accuracy,attr"`
+	CPE      []string `xml:"cpe"`
+}
+
+type NmapUptime struct {
+	Seconds  int64  `xml:"seconds,attr"`
+	LastBoot string `xml:"lastboot,attr"`
+}
+
+type NmapDistance struct {
+	Value int `xml:"value,attr"`
+}
+
+// parseNmapXML decodes an nmap -oX document.
+func parseNmapXML(r io.Reader) (*NmapRun, error) {
+	var run NmapRun
+	dec := xml.NewDecoder(r)
+	// nmap output references a DTD and an XSL stylesheet; neither is needed to decode it.
+	dec.Strict = false
+	if err := dec.Decode(&run); err != nil {
+		return nil, fmt.Errorf("failed to decode nmap XML: %v", err)
+	}
+	return &run, nil
+}
+
+// Host returns the entry for ip, or nil if the run did not report it.
+func (r *NmapRun) Host(ip string) *NmapHost {
+	for i := range r.Hosts {
+		if r.Hosts[i].Addr() == ip {
+			return &r.Hosts[i]
+		}
+	}
+	return nil
+}
+
+// Addr returns the host's IP address (IPv4 preferred over IPv6).
+func (h *NmapHost) Addr() string {
+	var v6 string
+	for _, a := range h.Addresses {
+		switch a.AddrType {
+		case "ipv4":
+			return a.Addr
+		case "ipv6":
+			if v6 == "" {
+				v6 = a.Addr
+			}
+		}
+	}
+	return v6
+}
+
+// MAC returns the host's MAC address and vendor as seen by nmap, if any.
+func (h *NmapHost) MAC() (string, string) {
+	for _, a := range h.Addresses {
+		if a.AddrType == "mac" {
+			return a.Addr, a.Vendor
+		}
+	}
+	return "", ""
+}
+
+// Hostname returns the first name nmap resolved for the host, preferring user-supplied names.
+func (h *NmapHost) Hostname() string {
+	for _, hn := range h.Hostnames {
+		if hn.Type == "user" && hn.Name != "" {
+			return hn.Name
+		}
+	}
+	for _, hn := range h.Hostnames {
+		if hn.Name != "" {
+			return hn.Name
+		}
+	}
+	return ""
+}
+
+// OpenPorts returns the ports in the open or filtered state, ordered by protocol and number.
+func (h *NmapHost) OpenPorts() []NmapPort {
+	var open []NmapPort
+	for _, p := range h.Ports {
+		if p.State.State == "open" || p.State.State == "filtered" {
+			open = append(open, p)
+		}
+	}
+	sort.SliceStable(open, func(i, j int) bool {
+		if open[i].Protocol != open[j].Protocol {
+			return open[i].Protocol < open[j].Protocol
+		}
+		return open[i].PortID < open[j].PortID
+	})
+	return open
+}
+
+// BestOS returns the most accurate OS match, or nil if nmap made no guess.
+func (h *NmapHost) BestOS() *NmapOSMatch {
+	var best *NmapOSMatch
+	for i := range h.OSMatches {
+		if best == nil || h.OSMatches[i].Accuracy > best.Accuracy {
+			best = &h.OSMatches[i]
+		}
+	}
+	return best
+}
+
+// KeyFingerprints returns the SSH host key and TLS certificate fingerprints reported by the
+// ssh-hostkey and ssl-cert scripts, e.g. "ssh-ed25519:3f1c..." and "tls-sha1:9a0b...". They identify
+// a device across address changes.
+func (h *NmapHost) KeyFingerprints() []string {
+	seen := make(map[string]bool)
+	var fps []string
+	add := func(fp string) {
+		if !seen[fp] {
+			seen[fp] = true
+			fps = append(fps, fp)
+		}
+	}
+	for _, p := range h.Ports {
+		for _, s := range p.Scripts {
+			switch s.ID {
+			case "ssh-hostkey":
+				for _, t := range s.Tables {
+					if fp, typ := elem(t.Elems, "fingerprint"), elem(t.Elems, "type"); fp != "" && typ != "" {
+						add(typ + ":" + strings.ToLower(fp))
+					}
+				}
+			case "ssl-cert":
+				if fp := elem(s.Elems, "sha1"); fp != "" {
+					add("tls-sha1:" + strings.ToLower(strings.ReplaceAll(fp, " ", "")))
+				}
+			}
+		}
+	}
+	sort.Strings(fps)
+	return fps
+}
+
+// hostPorts converts the open ports of h with the given protocol to host_ports rows.
+func hostPorts(h *NmapHost, protocol string) []db.HostPort {
+	var ports []db.HostPort
+	for _, p := range h.OpenPorts() {
+		if p.Protocol != protocol {
+			continue
+		}
+		ports = append(ports, db.HostPort{
+			Port:      p.PortID,
+			Protocol:  p.Protocol,
+			State:     p.State.State,
+			Service:   p.Service.Name,
+			Product:   p.Service.Product,
+			Version:   p.Service.Version,
+			ExtraInfo: p.Service.ExtraInfo,
+			Method:    p.Service.Method,
+		})
+	}
+	return ports
+}
+
+// formatOpenPorts renders ports in the legacy open_ports column format, e.g.
+// "22/tcp (ssh), 80/tcp (http)"; product and version are only kept in host_ports. Returns
+// "Unknown" when empty.
+func formatOpenPorts(ports []NmapPort) string {
+	var readable []string
+	for _, p := range ports {
+		if p.Service.Name != "" {
+			readable = append(readable, fmt.Sprintf("%d/%s (%s)", p.PortID, p.Protocol, p.Service.Name))
+		} else {
+			readable = append(readable, fmt.Sprintf("%d/%s", p.PortID, p.Protocol))
+		}
+	}
+	if len(readable) == 0 {
+		return "Unknown"
+	}
+	return strings.Join(readable, ", ")
+}
+
+// formatOSGuesses renders every OS match with its accuracy, e.g. "Linux 5.0 - 5.4 (96%); Linux 4.15 (92%)".
+func formatOSGuesses(matches []NmapOSMatch) string {
+	var guesses []string
+	for _, m := range matches {
+		guesses = append(guesses, m.Name+" ("+strconv.Itoa(m.Accuracy)+"%)")
+	}
+	return strings.Join(guesses, "; ")
+}
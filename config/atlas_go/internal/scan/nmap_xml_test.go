@@ -0,0 +1,142 @@
+package scan
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files under testdata")
+
+// parseNmapXMLFile is parseNmapXML over a recorded nmap -oX file.
+func parseNmapXMLFile(path string) (*NmapRun, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseNmapXML(f)
+}
+
+// describeNmapRun renders what Atlas reads from an nmap run, one block per host.
+func describeNmapRun(run *NmapRun) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "version: %s\nargs: %s\n", run.Version, run.Args)
+	for i := range run.Hosts {
+		h := &run.Hosts[i]
+		mac, vendor := h.MAC()
+		fmt.Fprintf(&b, "\nhost %s (%s)\n", h.Addr(), h.Status.State)
+		fmt.Fprintf(&b, "  mac: %s %s\n", mac, vendor)
+		fmt.Fprintf(&b, "  hostname: %s\n", h.Hostname())
+		for _, p := range h.OpenPorts() {
+			fmt.Fprintf(&b, "  port: %d/%s %s %q %q %q\n", p.PortID, p.Protocol, p.State.State, p.Service.Name, p.Service.Product, p.Service.Version)
+		}
+		if best := h.BestOS(); best != nil {
+			fmt.Fprintf(&b, "  os: %s (%d%%)\n", best.Name, best.Accuracy)
+		} else {
+			b.WriteString("  os: none\n")
+		}
+		for _, fp := range h.KeyFingerprints() {
+			fmt.Fprintf(&b, "  fingerprint: %s\n", fp)
+		}
+		fmt.Fprintf(&b, "  open_ports: %s\n", formatOpenPorts(h.OpenPorts()))
+		fmt.Fprintf(&b, "  os_guesses: %s\n", formatOSGuesses(h.OSMatches))
+	}
+	return b.String()
+}
+
+func TestNmapXMLGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "nmap", "*.xml"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no nmap fixtures: %v", err)
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".xml")
+		t.Run(name, func(t *testing.T) {
+			run, err := parseNmapXMLFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := describeNmapRun(run)
+			golden := strings.TrimSuffix(file, ".xml") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run go test -update to create it)", err)
+			}
+			if got != string(want) {
+				t.Errorf("%s differs from %s:\n--- got\n%s\n--- want\n%s", file, golden, got, want)
+			}
+		})
+	}
+}
+
+func TestNmapHostAddr(t *testing.T) {
+	tests := []struct {
+		name  string
+		addrs []NmapAddress
+		want  string
+	}{
+		{"ipv4 only", []NmapAddress{{Addr: "10.0.0.1", AddrType: "ipv4"}}, "10.0.0.1"},
+		{"ipv4 preferred", []NmapAddress{{Addr: "fe80::1", AddrType: "ipv6"}, {Addr: "10.0.0.1", AddrType: "ipv4"}}, "10.0.0.1"},
+		{"first ipv6", []NmapAddress{{Addr: "fe80::1", AddrType: "ipv6"}, {Addr: "2001:db8::1", AddrType: "ipv6"}}, "fe80::1"},
+		{"mac only", []NmapAddress{{Addr: "00:11:22:33:44:55", AddrType: "mac"}}, ""},
+		{"none", nil, ""},
+	}
+	for _, tt := range tests {
+		h := NmapHost{Addresses: tt.addrs}
+		if got := h.Addr(); got != tt.want {
+			t.Errorf("%s: Addr() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNmapRunHost(t *testing.T) {
+	run, err := parseNmapXMLFile(filepath.Join("testdata", "nmap", "dual_stack.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := run.Host("192.168.1.1"); h == nil || h.Hostname() != "router" {
+		t.Errorf("Host(192.168.1.1) = %+v, want the router", h)
+	}
+	if h := run.Host("fe80::5054:ff:fe12:3456"); h == nil {
+		t.Error("Host(fe80::5054:ff:fe12:3456) = nil, want the IPv6-only host")
+	}
+	if h := run.Host("192.168.1.99"); h != nil {
+		t.Errorf("Host(192.168.1.99) = %+v, want nil", h)
+	}
+}
+
+func TestFormatOpenPorts(t *testing.T) {
+	tests := []struct {
+		name  string
+		ports []NmapPort
+		want  string
+	}{
+		{"none", nil, "Unknown"},
+		{"service", []NmapPort{{PortID: 22, Protocol: "tcp", Service: NmapService{Name: "ssh", Product: "OpenSSH", Version: "8.9p1"}}}, "22/tcp (ssh)"},
+		{"no service", []NmapPort{{PortID: 8443, Protocol: "tcp"}}, "8443/tcp"},
+		{"several", []NmapPort{
+			{PortID: 22, Protocol: "tcp", Service: NmapService{Name: "ssh"}},
+			{PortID: 53, Protocol: "udp", Service: NmapService{Name: "domain"}},
+		}, "22/tcp (ssh), 53/udp (domain)"},
+	}
+	for _, tt := range tests {
+		if got := formatOpenPorts(tt.ports); got != tt.want {
+			t.Errorf("%s: formatOpenPorts() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseNmapXMLInvalid(t *testing.T) {
+	if _, err := parseNmapXML(strings.NewReader("Starting Nmap 7.94 ( https://nmap.org )\n")); err == nil {
+		t.Error("parseNmapXML accepted non-XML output")
+	}
+}
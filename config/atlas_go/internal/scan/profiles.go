@@ -0,0 +1,193 @@
+package scan
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"atlas/internal/utils"
+)
+
+//go:embed profiles.yaml
+var builtinProfiles []byte
+
+// DefaultProfile is the profile a deep scan uses when none is selected: every setting comes from
+// the DEEPSCAN_* environment variables.
+const DefaultProfile = "default"
+
+// Profile is a named set of deep scan settings. Unset fields keep the value from the environment.
+type Profile struct {
+	Name             string         `yaml:"-"`
+	Description      string         `yaml:"description"`
+	TCPPorts         *string        `yaml:"tcp_ports"`         // "all", "top:N" or an nmap port list
+	OSDetection      *bool          `yaml:"os_detection"`      // nmap -O
+	ServiceDetection *string        `yaml:"service_detection"` // nmap, native or off
+	Timing           *string        `yaml:"timing"`            // nmap -T template, 0-5 or its name
+	Concurrency      *int           `yaml:"concurrency"`
+	HostTimeout      *time.Duration `yaml:"host_timeout"`
+	UDP              *bool          `yaml:"udp"`
+	UDPPorts         *string        `yaml:"udp_ports"`
+}
+
+type profileFile struct {
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+// LoadProfiles returns the built-in profiles (profiles.yaml) overlaid with the profiles defined in
+// path. A profile in path replaces the built-in one of the same name. A missing file is not an error.
+func LoadProfiles(path string) (map[string]Profile, error) {
+	profiles, err := parseProfiles(builtinProfiles)
+	if err != nil {
+		return nil, fmt.Errorf("invalid built-in profiles: %v", err)
+	}
+	if path == "" {
+		return profiles, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return profiles, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	custom, err := parseProfiles(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	for name, p := range custom {
+		profiles[name] = p
+	}
+	return profiles, nil
+}
+
+func parseProfiles(data []byte) (map[string]Profile, error) {
+	var f profileFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	profiles := make(map[string]Profile)
+	for name, p := range f.Profiles {
+		p.Name = name
+		if err := p.validate(); err != nil {
+			return nil, fmt.Errorf("profile %s: %v", name, err)
+		}
+		profiles[name] = p
+	}
+	return profiles, nil
+}
+
+func (p Profile) validate() error {
+	if p.ServiceDetection != nil {
+		switch *p.ServiceDetection {
+		case "nmap", "native", "off":
+		default:
+			return fmt.Errorf("unknown service_detection %q (expected nmap, native or off)", *p.ServiceDetection)
+		}
+	}
+	if p.Timing != nil {
+		switch *p.Timing {
+		case "0", "1", "2", "3", "4", "5", "paranoid", "sneaky", "polite", "normal", "aggressive", "insane":
+		default:
+			return fmt.Errorf("unknown timing %q (expected 0-5 or an nmap template name)", *p.Timing)
+		}
+	}
+	if p.Concurrency != nil && *p.Concurrency <= 0 {
+		return fmt.Errorf("concurrency must be positive")
+	}
+	return nil
+}
+
+// ProfileNames returns the profile names in alphabetical order.
+func ProfileNames(profiles map[string]Profile) []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Apply overrides cfg with the settings the profile sets and records the profile's name.
+func (p Profile) Apply(cfg *DeepScanConfig) {
+	cfg.Profile = p.Name
+	if p.TCPPorts != nil {
+		cfg.TCPPorts = *p.TCPPorts
+	}
+	if p.OSDetection != nil {
+		cfg.OSDetection = *p.OSDetection
+	}
+	if p.ServiceDetection != nil {
+		cfg.ServiceDetection = *p.ServiceDetection
+	}
+	if p.Timing != nil {
+		cfg.Timing = *p.Timing
+	}
+	if p.Concurrency != nil {
+		cfg.Concurrency = *p.Concurrency
+	}
+	if p.HostTimeout != nil {
+		cfg.HostTimeout = *p.HostTimeout
+	}
+	if p.UDP != nil {
+		cfg.UDP.Enabled = *p.UDP
+	}
+	if p.UDPPorts != nil {
+		cfg.UDP.Ports = *p.UDPPorts
+	}
+}
+
+// ResolveDeepScanConfig returns the deep scan settings for the named profile ("" selects
+// DEEPSCAN_PROFILE, then DefaultProfile). Profiles are read from DEEPSCAN_PROFILES_FILE
+// (default /config/scan_profiles.yaml) on top of the built-in ones.
+func ResolveDeepScanConfig(profile string) (DeepScanConfig, error) {
+	cfg := DeepScanConfigFromEnv()
+	if profile == "" {
+		profile = utils.EnvString("DEEPSCAN_PROFILE", DefaultProfile)
+	}
+	profiles, err := LoadProfiles(utils.EnvString("DEEPSCAN_PROFILES_FILE", "/config/scan_profiles.yaml"))
+	if err != nil {
+		return cfg, err
+	}
+	p, ok := profiles[profile]
+	if !ok {
+		return cfg, fmt.Errorf("unknown scan profile %q (available: %s)", profile, strings.Join(ProfileNames(profiles), ", "))
+	}
+	p.Apply(&cfg)
+	return cfg, nil
+}
+
+// allTCPPorts reports whether the scan covers every TCP port.
+func (c DeepScanConfig) allTCPPorts() bool {
+	return c.TCPPorts == "" || c.TCPPorts == "all" || c.TCPPorts == "-"
+}
+
+// tcpPortArgs returns the nmap arguments selecting the TCP ports to scan.
+func (c DeepScanConfig) tcpPortArgs() []string {
+	switch ports := c.TCPPorts; {
+	case c.allTCPPorts():
+		return []string{"-p" + tcpPortArg}
+	case strings.HasPrefix(ports, "top:"):
+		return []string{"--top-ports", strings.TrimPrefix(ports, "top:")}
+	default:
+		return []string{"-p", ports}
+	}
+}
+
+// nmapOptions returns the arguments every nmap stage of the scan shares: the host timeout and
+// the timing template.
+func (c DeepScanConfig) nmapOptions(hostTimeout time.Duration) []string {
+	var args []string
+	if hostTimeout > 0 {
+		args = append(args, "--host-timeout", fmt.Sprintf("%ds", int(hostTimeout.Seconds())))
+	}
+	if c.Timing != "" {
+		args = append(args, "-T"+c.Timing)
+	}
+	return args
+}
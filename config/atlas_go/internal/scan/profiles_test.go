@@ -0,0 +1,121 @@
+package scan
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuiltinProfiles(t *testing.T) {
+	profiles, err := LoadProfiles("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ProfileNames(profiles), []string{"default", "full", "quick", "standard", "stealth"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("built-in profiles = %v, want %v", got, want)
+	}
+
+	env := DeepScanConfig{TCPPorts: "all", OSDetection: true, ServiceDetection: "native", Timing: "4", Concurrency: 8, HostTimeout: 20 * time.Minute}
+	tests := []struct {
+		profile     string
+		tcpPorts    string
+		os          bool
+		services    string
+		udp         bool
+		concurrency int
+	}{
+		{"default", "all", true, "native", false, 8},
+		{"quick", "top:100", false, "off", false, 8},
+		{"standard", "top:1000", true, "off", false, 8},
+		{"full", "all", true, "nmap", true, 8},
+		{"stealth", "top:1000", false, "off", false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.profile, func(t *testing.T) {
+			cfg := env
+			profiles[tt.profile].Apply(&cfg)
+			if cfg.Profile != tt.profile || cfg.TCPPorts != tt.tcpPorts || cfg.OSDetection != tt.os ||
+				cfg.ServiceDetection != tt.services || cfg.UDP.Enabled != tt.udp || cfg.Concurrency != tt.concurrency {
+				t.Errorf("config = %+v, want ports %s, OS %v, services %s, UDP %v, concurrency %d",
+					cfg, tt.tcpPorts, tt.os, tt.services, tt.udp, tt.concurrency)
+			}
+		})
+	}
+}
+
+func TestParseProfiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		err     string // substring of the expected error, "" for none
+		profile string // a profile that must be parsed
+	}{
+		{"valid", "profiles:\n  web:\n    tcp_ports: 80,443\n    service_detection: native\n    timing: polite\n    host_timeout: 10m\n", "", "web"},
+		{"empty", "", "", ""},
+		{"bad service detection", "profiles:\n  x:\n    service_detection: fast\n", "profile x: unknown service_detection", ""},
+		{"bad timing", "profiles:\n  x:\n    timing: ludicrous\n", "profile x: unknown timing", ""},
+		{"zero concurrency", "profiles:\n  x:\n    concurrency: 0\n", "profile x: concurrency must be positive", ""},
+		{"bad duration", "profiles:\n  x:\n    host_timeout: soon\n", "into time.Duration", ""},
+		{"not yaml", "profiles: [", "yaml", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profiles, err := parseProfiles([]byte(tt.yaml))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.profile != "" && profiles[tt.profile].Name != tt.profile {
+				t.Errorf("profiles = %+v, want %s", profiles, tt.profile)
+			}
+		})
+	}
+}
+
+func TestLoadProfilesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan_profiles.yaml")
+	custom := "profiles:\n  quick:\n    tcp_ports: top:20\n  web:\n    tcp_ports: 80,443,8080\n    os_detection: false\n"
+	if err := os.WriteFile(path, []byte(custom), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	profiles, err := LoadProfiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ProfileNames(profiles), []string{"default", "full", "quick", "standard", "stealth", "web"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("profiles = %v, want %v", got, want)
+	}
+	// A profile in the file replaces the built-in one entirely, so quick keeps only its port setting
+	var cfg DeepScanConfig
+	cfg.OSDetection = true
+	profiles["quick"].Apply(&cfg)
+	if cfg.TCPPorts != "top:20" || !cfg.OSDetection {
+		t.Errorf("quick from the file = %+v, want top:20 ports and the environment's OS detection", cfg)
+	}
+
+	if _, err := LoadProfiles(filepath.Join(t.TempDir(), "missing.yaml")); err != nil {
+		t.Errorf("missing profiles file: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("profiles:\n  x:\n    timing: 9\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadProfiles(path); err == nil || !strings.Contains(err.Error(), "failed to parse "+path) {
+		t.Errorf("invalid profiles file: error = %v", err)
+	}
+}
+
+func TestResolveDeepScanConfigUnknownProfile(t *testing.T) {
+	t.Setenv("DEEPSCAN_PROFILES_FILE", filepath.Join(t.TempDir(), "missing.yaml"))
+	_, err := ResolveDeepScanConfig("turbo")
+	if err == nil || err.Error() != `unknown scan profile "turbo" (available: default, full, quick, standard, stealth)` {
+		t.Errorf("error = %v", err)
+	}
+}
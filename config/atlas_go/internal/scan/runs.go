@@ -0,0 +1,72 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"atlas/internal/db"
+)
+
+// scanRun tracks one scan invocation and writes its scan_runs row. Bookkeeping failures are
+// reported but never fail the scan itself.
+type scanRun struct {
+	store    *db.Store
+	ID       int64
+	Type     string
+	Profile  string // deep scan profile
+	Targets  []string
+	Found    int
+	Updated  int
+	warnings []string
+}
+
+// startRun records the start of a scan of the given type.
+func (s *Scanner) startRun(scanType string) *scanRun {
+	run := &scanRun{store: s.Store, Type: scanType}
+	id, err := s.Store.StartRun(scanType, s.Version)
+	if err != nil {
+		fmt.Printf("⚠️ %v\n", err)
+		return run
+	}
+	run.ID = id
+	return run
+}
+
+// Ref identifies the run in host updates and history.
+func (r *scanRun) Ref() db.ScanRef {
+	return db.ScanRef{Type: r.Type, RunID: r.ID, Profile: r.Profile}
+}
+
+// Warnf records a non-fatal problem for the run's error summary.
+func (r *scanRun) Warnf(format string, args ...any) {
+	r.warnings = append(r.warnings, fmt.Sprintf(format, args...))
+}
+
+// Finish stores the outcome: err is the error the scan returns (nil on success).
+func (r *scanRun) Finish(err error) {
+	if r.ID == 0 {
+		return
+	}
+	status := db.RunSuccess
+	summary := r.warnings
+	switch {
+	case errors.Is(err, context.Canceled):
+		status = db.RunCancelled
+	case err != nil:
+		status = db.RunFailed
+		summary = append([]string{err.Error()}, summary...)
+	}
+	if err := r.store.FinishRun(db.ScanRun{
+		ID:           r.ID,
+		Status:       status,
+		Profile:      r.Profile,
+		Targets:      r.Targets,
+		HostsFound:   r.Found,
+		HostsUpdated: r.Updated,
+		Error:        strings.Join(summary, "; "),
+	}); err != nil {
+		fmt.Printf("⚠️ %v\n", err)
+	}
+}
@@ -0,0 +1,267 @@
+package scan
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"atlas/internal/docker"
+	"atlas/internal/utils"
+)
+
+// Container runtimes the Docker scan can read, stored in docker_hosts.runtime.
+const (
+	RuntimeDocker     = "docker"
+	RuntimePodman     = "podman"
+	RuntimeContainerd = "containerd"
+)
+
+// ContainerRuntime is an engine the Docker scan reads containers from. Every runtime reports its
+// containers in the Docker inspect format, so they all end up in the same docker_hosts rows.
+type ContainerRuntime interface {
+	Name() string // engine name, stored in docker_hosts.engine
+	Kind() string // RuntimeDocker, RuntimePodman or RuntimeContainerd
+	// RemoteHost is the machine a remote engine runs on, "" for a local one
+	RemoteHost() string
+	ContainerIDs(ctx context.Context) ([]string, error)
+	Inspect(ctx context.Context, id string) (docker.Container, error)
+	Networks(ctx context.Context) ([]docker.Network, error)
+}
+
+// eventRuntime is a runtime dockerwatch can follow.
+type eventRuntime interface {
+	ContainerRuntime
+	Events(ctx context.Context, filters map[string][]string) (*docker.EventStream, error)
+}
+
+// apiRuntime is Docker or Podman, both served over the Docker Engine API.
+type apiRuntime struct {
+	*docker.Client
+	kind string
+}
+
+func (r apiRuntime) Name() string { return r.Client.Name }
+func (r apiRuntime) Kind() string { return r.kind }
+
+func (r apiRuntime) ContainerIDs(ctx context.Context) ([]string, error) {
+	list, err := r.ContainerList(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(list))
+	for i, c := range list {
+		ids[i] = c.ID
+	}
+	return ids, nil
+}
+
+func (r apiRuntime) Inspect(ctx context.Context, id string) (docker.Container, error) {
+	return r.ContainerInspect(ctx, id)
+}
+
+func (r apiRuntime) Networks(ctx context.Context) ([]docker.Network, error) {
+	return r.NetworkList(ctx)
+}
+
+// containerdRuntime reads a containerd namespace through nerdctl, whose inspect output is
+// Docker-compatible. containerd has no Docker-style event stream, so dockerwatch skips it.
+type containerdRuntime struct {
+	name      string
+	address   string // containerd socket path
+	namespace string
+	runner    utils.Runner
+}
+
+func (r containerdRuntime) Name() string       { return r.name }
+func (r containerdRuntime) Kind() string       { return RuntimeContainerd }
+func (r containerdRuntime) RemoteHost() string { return "" }
+
+func (r containerdRuntime) nerdctl(ctx context.Context, args ...string) ([]byte, error) {
+	args = append([]string{"--address", r.address, "--namespace", r.namespace}, args...)
+	out, err := r.runner.Output(ctx, "nerdctl", args...)
+	if err != nil {
+		return nil, fmt.Errorf("nerdctl %s: %v", args[4], err)
+	}
+	return out, nil
+}
+
+func (r containerdRuntime) ContainerIDs(ctx context.Context) ([]string, error) {
+	out, err := r.nerdctl(ctx, "ps", "-a", "-q", "--no-trunc")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(out)), nil
+}
+
+func (r containerdRuntime) Inspect(ctx context.Context, id string) (docker.Container, error) {
+	out, err := r.nerdctl(ctx, "inspect", "--mode", "dockercompat", id)
+	if err != nil {
+		return docker.Container{}, err
+	}
+	var list []docker.Container
+	if err := json.Unmarshal(out, &list); err != nil {
+		return docker.Container{}, fmt.Errorf("failed to decode nerdctl inspect: %v", err)
+	}
+	if len(list) == 0 {
+		return docker.Container{}, fmt.Errorf("no inspect data for container %s", id)
+	}
+	return list[0], nil
+}
+
+func (r containerdRuntime) Networks(ctx context.Context) ([]docker.Network, error) {
+	out, err := r.nerdctl(ctx, "network", "ls", "--format", "{{.Name}}")
+	if err != nil {
+		return nil, err
+	}
+	// host and none are not CNI networks and cannot be inspected
+	var names []string
+	for _, name := range strings.Fields(string(out)) {
+		if name != "host" && name != "none" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	out, err = r.nerdctl(ctx, append([]string{"network", "inspect", "--mode", "dockercompat"}, names...)...)
+	if err != nil {
+		return nil, err
+	}
+	var list []docker.Network
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("failed to decode nerdctl network inspect: %v", err)
+	}
+	return list, nil
+}
+
+// containerRuntimes returns the runtimes to scan: Scanner.Runtimes, or one per engine in
+// DOCKER_ENGINES_FILE (default /config/docker_engines.yaml), or the local runtimes CONTAINER_RUNTIME
+// selects (default auto: every one found).
+func (s *Scanner) containerRuntimes(ctx context.Context) ([]ContainerRuntime, error) {
+	if len(s.Runtimes) > 0 {
+		return s.Runtimes, nil
+	}
+	engines, err := docker.LoadEngines(utils.EnvString("DOCKER_ENGINES_FILE", "/config/docker_engines.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	if len(engines) == 0 {
+		selected := utils.EnvString("CONTAINER_RUNTIME", "auto")
+		switch selected {
+		case "auto", RuntimeDocker, RuntimePodman, RuntimeContainerd:
+		default:
+			return nil, fmt.Errorf("unknown CONTAINER_RUNTIME %q (expected auto, docker, podman or containerd)", selected)
+		}
+		engines = localEngines(s.Runner, selected)
+	}
+	var runtimes []ContainerRuntime
+	for _, e := range engines {
+		r, err := s.newRuntime(ctx, e)
+		if err != nil {
+			return nil, err
+		}
+		runtimes = append(runtimes, r)
+	}
+	return runtimes, nil
+}
+
+// newRuntime returns the runtime of an engine. A Docker API engine without a configured runtime
+// is asked whether it is Docker or Podman; one that does not answer is taken for Docker.
+func (s *Scanner) newRuntime(ctx context.Context, e docker.Engine) (ContainerRuntime, error) {
+	if e.Runtime == RuntimeContainerd {
+		u, err := url.Parse(e.Host)
+		if err != nil || u.Scheme != "unix" {
+			return nil, fmt.Errorf("engine %s: containerd needs a unix:// socket, got %q", e.Name, e.Host)
+		}
+		namespace := e.Namespace
+		if namespace == "" {
+			namespace = "default"
+		}
+		return containerdRuntime{name: e.Name, address: u.Path, namespace: namespace, runner: s.Runner}, nil
+	}
+	client, err := docker.NewEngineClient(e, s.Runner.Conn)
+	if err != nil {
+		return nil, err
+	}
+	kind := e.Runtime
+	if kind == "" {
+		kind = RuntimeDocker
+		vctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		v, err := client.Version(vctx)
+		cancel()
+		if err == nil && v.IsPodman() {
+			kind = RuntimePodman
+		}
+	}
+	return apiRuntime{Client: client, kind: kind}, nil
+}
+
+// Sockets looked for on this machine. Rootless Podman has one socket per user under /run/user.
+const (
+	podmanSocket       = "/run/podman/podman.sock"
+	rootlessPodmanGlob = "/run/user/*/podman/podman.sock"
+	containerdSocket   = "/run/containerd/containerd.sock"
+)
+
+// localEngines returns the engines of the selected runtime ("auto" for all) found on this machine.
+// The Docker engine is always LocalEngine (DOCKER_HOST); Podman engines are named podman and
+// podman-<uid> for rootless ones. A socket reachable under two names is listed once. Without any
+// socket the result is the LocalEngine, so the scan reports why it cannot be reached.
+func localEngines(r utils.Runner, selected string) []docker.Engine {
+	var engines []docker.Engine
+	seen := make(map[string]bool)
+	add := func(e docker.Engine, socket string) {
+		if socket != "" {
+			if _, err := os.Stat(socket); err != nil {
+				return
+			}
+			if real, err := filepath.EvalSymlinks(socket); err == nil {
+				socket = real
+			}
+			if seen[socket] {
+				return
+			}
+			seen[socket] = true
+		}
+		engines = append(engines, e)
+	}
+
+	want := func(kind string) bool { return selected == "auto" || selected == kind }
+	// DOCKER_HOST may point at Docker or Podman; in auto mode the runtime is detected when scanning
+	if want(RuntimeDocker) || (selected == RuntimePodman && os.Getenv("DOCKER_HOST") != "") {
+		local := docker.EnvEngine()
+		if selected != "auto" {
+			local.Runtime = selected
+		}
+		socket := ""
+		if u, err := url.Parse(local.Host); err == nil && u.Scheme == "unix" {
+			socket = u.Path
+		}
+		add(local, socket)
+	}
+	if want(RuntimePodman) {
+		add(docker.Engine{Name: "podman", Host: "unix://" + podmanSocket, Runtime: RuntimePodman}, podmanSocket)
+		rootless, _ := filepath.Glob(rootlessPodmanGlob)
+		for _, socket := range rootless {
+			uid := filepath.Base(filepath.Dir(filepath.Dir(socket)))
+			add(docker.Engine{Name: "podman-" + uid, Host: "unix://" + socket, Runtime: RuntimePodman}, socket)
+		}
+	}
+	if want(RuntimeContainerd) {
+		// Docker keeps its containers in containerd too, in the moby namespace nerdctl is not
+		// pointed at by default
+		if _, err := r.LookPath("nerdctl"); err == nil || selected == RuntimeContainerd {
+			add(docker.Engine{Name: RuntimeContainerd, Host: "unix://" + containerdSocket, Runtime: RuntimeContainerd,
+				Namespace: utils.EnvString("CONTAINERD_NAMESPACE", "default")}, containerdSocket)
+		}
+	}
+	if len(engines) == 0 {
+		engines = append(engines, docker.EnvEngine())
+	}
+	return engines
+}
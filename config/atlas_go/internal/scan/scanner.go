@@ -0,0 +1,66 @@
+package scan
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"atlas/internal/classify"
+	"atlas/internal/db"
+	"atlas/internal/oui"
+	"atlas/internal/utils"
+)
+
+// Scanner runs the fast, deep and Docker scans. Every external command (nmap,
+// ping, ip, curl, nbtscan) and host lookup (PATH, /proc/net/arp, DNS) goes
+// through Runner, so a ReplayRunner can drive a scan from recorded output
+// without the real tools or root. The Docker scan reads its container
+// Runtimes, which can point at any socket serving recorded responses. Results
+// are written to Store and progress logs to LogDir. Every scan is recorded in
+// scan_runs together with Version.
+type Scanner struct {
+	Runner   utils.Runner
+	Store    *db.Store
+	LogDir   string
+	Version  string
+	Runtimes []ContainerRuntime // nil: the configured engines, see containerRuntimes
+
+	ouiOnce sync.Once
+	ouiDB   *oui.DB
+
+	rulesOnce sync.Once
+	rules     *classify.Classifier
+}
+
+// NewScanner returns a Scanner that runs commands on the host.
+func NewScanner(store *db.Store, logDir string) *Scanner {
+	return &Scanner{Runner: utils.ExecRunner{}, Store: store, LogDir: logDir}
+}
+
+// vendors returns the MAC vendor database, loaded from the store on first use. It is safe for
+// concurrent use by scan workers.
+func (s *Scanner) vendors() *oui.DB {
+	s.ouiOnce.Do(func() {
+		d, err := s.Store.LoadOUI()
+		if err != nil {
+			fmt.Printf("⚠️ Could not load OUI data, using built-in list: %v\n", err)
+			d = oui.Embedded()
+		}
+		s.ouiDB = d
+	})
+	return s.ouiDB
+}
+
+// macVendor returns the vendor of mac and whether it is locally administered. Unknown MACs
+// have neither.
+func (s *Scanner) macVendor(mac string) (string, bool) {
+	if mac == "" || mac == "Unknown" {
+		return "", false
+	}
+	return s.vendors().Lookup(mac), oui.IsLocallyAdministered(mac)
+}
+
+// logPath returns the path of a log file inside LogDir.
+func (s *Scanner) logPath(name string) string {
+	return filepath.Join(s.LogDir, name)
+}
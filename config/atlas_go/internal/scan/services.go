@@ -0,0 +1,204 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// bannerTimeout bounds connecting to a port and reading a probe's response
+	bannerTimeout = 3 * time.Second
+	// bannerWait is how long a server gets to speak first before it is probed
+	bannerWait = time.Second
+)
+
+// grabBanner identifies the service on a TCP port without nmap. It reads what the server sends
+// on connect (SSH, FTP, SMTP, POP3, IMAP, MySQL); servers that wait for the client get a Redis
+// INFO on 6379 and an HTTP HEAD request otherwise. It returns a zero NmapService when nothing
+// could be recognised.
+func grabBanner(ctx context.Context, ip string, port int) NmapService {
+	d := net.Dialer{Timeout: bannerTimeout}
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(ip, strconv.Itoa(port)))
+	if err != nil {
+		return NmapService{}
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(bannerWait))
+	if n, _ := conn.Read(buf); n > 0 {
+		return parseBanner(buf[:n])
+	}
+
+	probe := "HEAD / HTTP/1.0\r\nHost: " + ip + "\r\n\r\n"
+	if port == 6379 {
+		probe = "INFO server\r\n"
+	}
+	conn.SetDeadline(time.Now().Add(bannerTimeout))
+	if _, err := conn.Write([]byte(probe)); err != nil {
+		return NmapService{}
+	}
+	n, _ := readAll(conn, buf)
+	return parseBanner(buf[:n])
+}
+
+// readAll reads until buf is full, the peer closes or the deadline passes.
+func readAll(conn net.Conn, buf []byte) (int, error) {
+	total := 0
+	for total < len(buf) {
+		n, err := conn.Read(buf[total:])
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+var (
+	sshBanner   = regexp.MustCompile(`^SSH-[\d.]+-([^_\s-]+)[_-]?(\S*)\s*(.*)`)
+	ftpProduct  = regexp.MustCompile(`(?i)(vsFTPd|ProFTPD|Pure-FTPd|FileZilla Server|Microsoft FTP Service)[ /v]*([\d.]*[a-z]?)`)
+	smtpProduct = regexp.MustCompile(`(?i)ESMTP\s+(Postfix|Exim|Sendmail|Microsoft ESMTP MAIL Service|OpenSMTPD|Haraka)?[ /]*([\d.]*)`)
+	httpServer  = regexp.MustCompile(`(?im)^Server:\s*([^/\s\r]+)(?:/([^\s\r]+))?\s*(.*?)\r?$`)
+	redisInfo   = regexp.MustCompile(`redis_version:([^\s\r]+)`)
+	productVer  = regexp.MustCompile(`^([\d.]+)-?(.*)$`)
+)
+
+// parseBanner recognises the service behind a banner or probe response.
+func parseBanner(b []byte) NmapService {
+	text := string(b)
+	first, _, _ := strings.Cut(text, "\n")
+	first = strings.TrimSpace(first)
+	svc := NmapService{Method: "banner"}
+
+	switch {
+	case strings.HasPrefix(first, "SSH-"):
+		svc.Name = "ssh"
+		if m := sshBanner.FindStringSubmatch(first); m != nil {
+			svc.Product, svc.Version, svc.ExtraInfo = m[1], m[2], strings.TrimSpace(m[3])
+		}
+	case strings.HasPrefix(first, "HTTP/"):
+		svc.Name = "http"
+		if m := httpServer.FindStringSubmatch(text); m != nil {
+			svc.Product, svc.Version, svc.ExtraInfo = m[1], m[2], strings.Trim(strings.TrimSpace(m[3]), "()")
+		}
+	case strings.HasPrefix(text, "$") && strings.Contains(text, "redis_version:"):
+		svc.Name, svc.Product = "redis", "Redis"
+		if m := redisInfo.FindStringSubmatch(text); m != nil {
+			svc.Version = m[1]
+		}
+	case strings.HasPrefix(first, "+OK"):
+		svc.Name = "pop3"
+	case strings.HasPrefix(first, "* OK"):
+		svc.Name = "imap"
+	case strings.HasPrefix(first, "220") && strings.Contains(strings.ToUpper(first), "SMTP"):
+		svc.Name = "smtp"
+		if m := smtpProduct.FindStringSubmatch(first); m != nil {
+			svc.Product, svc.Version = m[1], m[2]
+		}
+	case strings.HasPrefix(first, "220"):
+		svc.Name = "ftp"
+		if m := ftpProduct.FindStringSubmatch(first); m != nil {
+			svc.Product, svc.Version = m[1], m[2]
+		}
+	default:
+		if product, version, ok := parseMySQLGreeting(b); ok {
+			svc.Name, svc.Product, svc.Version = "mysql", product, version
+		} else {
+			return NmapService{}
+		}
+	}
+	return svc
+}
+
+// parseMySQLGreeting decodes the server version of a MySQL/MariaDB initial handshake packet:
+// a 3-byte length, a sequence number, protocol version 10 and a NUL-terminated version string.
+func parseMySQLGreeting(b []byte) (product, version string, ok bool) {
+	if len(b) < 6 || b[4] != 10 {
+		return "", "", false
+	}
+	end := strings.IndexByte(string(b[5:]), 0)
+	if end <= 0 {
+		return "", "", false
+	}
+	raw := string(b[5 : 5+end])
+	// MariaDB prefixes its version with "5.5.5-" for old clients
+	raw = strings.TrimPrefix(raw, "5.5.5-")
+	m := productVer.FindStringSubmatch(raw)
+	if m == nil {
+		return "", "", false
+	}
+	product = "MySQL"
+	if strings.Contains(m[2], "MariaDB") {
+		product = "MariaDB"
+	}
+	return product, m[1], true
+}
+
+// grabBanners identifies the services on host's open TCP ports with grabBanner and fills in the
+// ones it recognised.
+func grabBanners(ctx context.Context, ip string, host *NmapHost) {
+	for i := range host.Ports {
+		p := &host.Ports[i]
+		if p.Protocol != "tcp" || p.State.State != "open" {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if svc := grabBanner(ctx, ip, p.PortID); svc.Name != "" {
+			p.Service = svc
+		}
+	}
+}
+
+// versionScan runs nmap -sV against host's open TCP ports and replaces their services with the
+// probed ones, with the deep scan's host timeout and timing. The XML is kept in the log directory
+// next to the port scan's.
+func (s *Scanner) versionScan(ctx context.Context, ip string, host *NmapHost, cfg DeepScanConfig) error {
+	var ports []string
+	for _, p := range host.Ports {
+		if p.Protocol == "tcp" && p.State.State == "open" {
+			ports = append(ports, strconv.Itoa(p.PortID))
+		}
+	}
+	if len(ports) == 0 {
+		return nil
+	}
+
+	args := []string{"-sV", "-Pn", "-p", "T:" + strings.Join(ports, ","), ip, "-oX", "-"}
+	args = append(args, cfg.nmapOptions(cfg.HostTimeout)...)
+	if strings.Contains(ip, ":") {
+		args = append([]string{"-6"}, args...)
+	}
+	out, _ := s.Runner.Output(ctx, "nmap", args...)
+	if ctx.Err() != nil {
+		return fmt.Errorf("version scan aborted: %v", ctx.Err())
+	}
+	_ = os.WriteFile(s.hostLogPath("sv", ip), out, 0644)
+
+	run, err := parseNmapXML(bytes.NewReader(out))
+	if err != nil {
+		return fmt.Errorf("failed to parse version scan: %v", err)
+	}
+	probed := run.Host(strings.SplitN(ip, "%", 2)[0])
+	if probed == nil {
+		return fmt.Errorf("version scan reported nothing")
+	}
+	for _, vp := range probed.Ports {
+		for i := range host.Ports {
+			p := &host.Ports[i]
+			if p.Protocol == vp.Protocol && p.PortID == vp.PortID && vp.Service.Name != "" {
+				p.Service = vp.Service
+			}
+		}
+	}
+	return nil
+}
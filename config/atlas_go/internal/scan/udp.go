@@ -0,0 +1,113 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"atlas/internal/utils"
+)
+
+// defaultUDPPorts are the UDP services worth finding on a LAN: DNS, DHCP, TFTP, RPC, NTP, NetBIOS,
+// SNMP, IKE, syslog, RIP, IPMI, IPP, OpenVPN, MSSQL browser, L2TP, RADIUS, SSDP, IPsec NAT-T, SIP,
+// mDNS, memcached, BACnet and WireGuard. Scanning all 65535 UDP ports takes hours per host.
+const defaultUDPPorts = "53,67,68,69,111,123,137,138,161,162,500,514,520,623,631,1194,1434,1701,1812,1900,4500,5060,5353,11211,47808,51820"
+
+// UDPScanConfig controls the optional UDP stage of the deep scan. It has its own concurrency and
+// timeout because UDP scans are slow (closed ports are only detected by rate-limited ICMP replies).
+type UDPScanConfig struct {
+	Enabled     bool
+	Ports       string        // nmap port list, or "top:N" for nmap's N most common UDP ports
+	Concurrency int           // hosts UDP-scanned at once, across all deep scan workers
+	HostTimeout time.Duration // give up on a single host's UDP scan after this long
+}
+
+// UDPScanConfigFromEnv reads DEEPSCAN_UDP (default false), DEEPSCAN_UDP_PORTS (default a curated
+// list), DEEPSCAN_UDP_CONCURRENCY (default 2) and DEEPSCAN_UDP_HOST_TIMEOUT (default 10m).
+func UDPScanConfigFromEnv() UDPScanConfig {
+	return UDPScanConfig{
+		Enabled:     utils.EnvBool("DEEPSCAN_UDP", false),
+		Ports:       utils.EnvString("DEEPSCAN_UDP_PORTS", defaultUDPPorts),
+		Concurrency: utils.EnvInt("DEEPSCAN_UDP_CONCURRENCY", 2),
+		HostTimeout: utils.EnvDuration("DEEPSCAN_UDP_HOST_TIMEOUT", 10*time.Minute),
+	}
+}
+
+// portArgs returns the nmap arguments selecting the configured ports.
+func (c UDPScanConfig) portArgs() []string {
+	if n, ok := strings.CutPrefix(c.Ports, "top:"); ok {
+		return []string{"--top-ports", n}
+	}
+	return []string{"-p", "U:" + c.Ports}
+}
+
+// withUDPStage wraps a host scan with a UDP scan of the same host. At most cfg.Concurrency UDP
+// scans run at once, whatever the number of deep scan workers; the others wait for a slot.
+func (s *Scanner) withUDPStage(next hostScanFunc, cfg UDPScanConfig) hostScanFunc {
+	concurrency := cfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	slots := make(chan struct{}, concurrency)
+	return func(ctx context.Context, host HostInfo, deep DeepScanConfig) deepScanResult {
+		res := next(ctx, host, deep)
+		start := time.Now()
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return res
+		}
+		defer func() { <-slots }()
+
+		ports, err := s.scanAllUdp(ctx, scanTarget(host), deep)
+		if err != nil {
+			if res.Err == nil {
+				res.Err = fmt.Errorf("UDP scan failed: %v", err)
+			}
+		} else {
+			res.UDPComplete = true
+			res.UDPPorts = ports
+		}
+		res.Duration += time.Since(start)
+		return res
+	}
+}
+
+// scanAllUdp UDP-scans ip with the deep scan's UDP settings and timing and returns the open
+// ports. Ports nmap reports as open|filtered (no answer either way) are left out. Each host's XML
+// is kept in its own log file.
+func (s *Scanner) scanAllUdp(ctx context.Context, ip string, deep DeepScanConfig) ([]NmapPort, error) {
+	cfg := deep.UDP
+	args := append([]string{"-sU", "-Pn"}, cfg.portArgs()...)
+	args = append(args, ip, "-oX", "-")
+	args = append(args, deep.nmapOptions(cfg.HostTimeout)...)
+	if strings.Contains(ip, ":") {
+		args = append([]string{"-6"}, args...)
+	}
+	hostCtx, cancel := context.WithTimeout(ctx, cfg.HostTimeout+time.Minute)
+	defer cancel()
+	out, _ := s.Runner.Output(hostCtx, "nmap", args...)
+	if hostCtx.Err() != nil {
+		return nil, fmt.Errorf("aborted: %v", hostCtx.Err())
+	}
+	_ = os.WriteFile(s.hostLogPath("udp", ip), out, 0644)
+
+	run, err := parseNmapXML(bytes.NewReader(out))
+	if err != nil {
+		return nil, err
+	}
+	host := run.Host(strings.SplitN(ip, "%", 2)[0])
+	if host == nil {
+		return nil, fmt.Errorf("nmap reported nothing")
+	}
+	var open []NmapPort
+	for _, p := range host.Ports {
+		if p.Protocol == "udp" && p.State.State == "open" {
+			open = append(open, p)
+		}
+	}
+	return open, nil
+}
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cmdConn is a net.Conn over the standard input and output of a process. Both sides are pipes,
+// which support deadlines.
+type cmdConn struct {
+	cmd    *exec.Cmd
+	stdin  *os.File // write end of the process's stdin
+	stdout *os.File // read end of the process's stdout
+	stderr *syncBuffer
+	name   string
+
+	closeOnce sync.Once
+}
+
+// startCmdConn starts name and returns a connection to it. The process is not tied to ctx, since
+// the connection outlives the call that dialed it; it is killed by Close.
+func startCmdConn(ctx context.Context, name string, args ...string) (net.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		inR.Close()
+		inW.Close()
+		return nil, err
+	}
+	c := &cmdConn{cmd: exec.Command(name, args...), stdin: inW, stdout: outR, stderr: &syncBuffer{}, name: name}
+	c.cmd.Stdin = inR
+	c.cmd.Stdout = outW
+	c.cmd.Stderr = c.stderr
+	err = c.cmd.Start()
+	// The child holds its own copies of these ends
+	inR.Close()
+	outW.Close()
+	if err != nil {
+		inW.Close()
+		outR.Close()
+		return nil, fmt.Errorf("failed to start %s: %v", name, err)
+	}
+	return c, nil
+}
+
+// Read returns io.EOF when the process exits, or its error output if it wrote any, which is how
+// ssh reports a failed connection.
+func (c *cmdConn) Read(p []byte) (int, error) {
+	n, err := c.stdout.Read(p)
+	if err == io.EOF {
+		if msg := strings.TrimSpace(c.stderr.String()); msg != "" {
+			return n, errors.New(msg)
+		}
+	}
+	return n, err
+}
+
+func (c *cmdConn) Write(p []byte) (int, error) { return c.stdin.Write(p) }
+
+func (c *cmdConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.stdin.Close()
+		c.stdout.Close()
+		c.cmd.Process.Kill()
+		c.cmd.Wait()
+	})
+	return nil
+}
+
+func (c *cmdConn) LocalAddr() net.Addr  { return cmdAddr(c.name) }
+func (c *cmdConn) RemoteAddr() net.Addr { return cmdAddr(c.name) }
+
+func (c *cmdConn) SetDeadline(t time.Time) error {
+	if err := c.stdout.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.stdin.SetWriteDeadline(t)
+}
+
+func (c *cmdConn) SetReadDeadline(t time.Time) error  { return c.stdout.SetReadDeadline(t) }
+func (c *cmdConn) SetWriteDeadline(t time.Time) error { return c.stdin.SetWriteDeadline(t) }
+
+type cmdAddr string
+
+func (a cmdAddr) Network() string { return "cmd" }
+func (a cmdAddr) String() string  { return string(a) }
+
+// syncBuffer collects a process's error output while it runs; only the first 4 KiB are kept.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if room := 4096 - b.buf.Len(); room > 0 {
+		if len(p) > room {
+			b.buf.Write(p[:room])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
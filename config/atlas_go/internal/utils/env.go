@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvString returns the trimmed value of the environment variable name, or def if it is unset or blank.
+func EnvString(name, def string) string {
+	if v := strings.TrimSpace(os.Getenv(name)); v != "" {
+		return v
+	}
+	return def
+}
+
+// EnvInt returns the environment variable name parsed as a positive integer, or def if it is unset or invalid.
+func EnvInt(name string, def int) int {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return def
+	}
+	return n
+}
+
+// EnvBool returns the environment variable name parsed as a boolean ("true", "1", "yes", "false", "0",
+// "no", ...), or def if it is unset or invalid.
+func EnvBool(name string, def bool) bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(name))) {
+	case "1", "true", "yes", "on":
+		return true
+	case "0", "false", "no", "off":
+		return false
+	}
+	return def
+}
+
+// EnvDuration returns the environment variable name parsed as a duration, or def if it is unset or invalid.
+// Both Go duration strings ("1500ms", "2m") and plain integers (seconds, like the *_INTERVAL variables) are accepted.
+func EnvDuration(name string, def time.Duration) time.Duration {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return def
+	}
+	if n, err := strconv.Atoi(v); err == nil {
+		if n <= 0 {
+			return def
+		}
+		return time.Duration(n) * time.Second
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return def
+	}
+	return d
+}
+
+// EnvList returns the comma-separated environment variable name as a list of trimmed, non-empty entries.
+func EnvList(name string) []string {
+	var result []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if trimmed := strings.TrimSpace(item); trimmed != "" {
+			result = append(result, trimmed)
+		}
+	}
+	return result
+}
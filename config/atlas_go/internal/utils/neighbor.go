@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"strings"
+)
+
+// Neighbor is an entry of the kernel neighbor table (ARP for IPv4, NDP for IPv6).
+type Neighbor struct {
+	IP        string
+	Interface string
+	MAC       string
+	State     string
+	Router    bool
+}
+
+// GetNeighbors returns the kernel neighbor table for both address families via `ip neigh`.
+// Entries without a link-layer address (INCOMPLETE/FAILED) are skipped.
+func GetNeighbors(r Runner) ([]Neighbor, error) {
+	out, err := r.Output(context.Background(), "ip", "neigh", "show")
+	if err != nil {
+		return nil, err
+	}
+	return parseNeighbors(string(out)), nil
+}
+
+// parseNeighbors parses `ip neigh show` output, e.g.
+// "fe80::1 dev eth0 lladdr 02:fc:00:00:00:05 router REACHABLE".
+func parseNeighbors(out string) []Neighbor {
+	var neighbors []Neighbor
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		n := Neighbor{IP: fields[0], State: fields[len(fields)-1]}
+		for i := 1; i < len(fields); i++ {
+			switch fields[i] {
+			case "dev":
+				if i+1 < len(fields) {
+					n.Interface = fields[i+1]
+				}
+			case "lladdr":
+				if i+1 < len(fields) {
+					n.MAC = strings.ToLower(fields[i+1])
+				}
+			case "router":
+				n.Router = true
+			}
+		}
+		if n.MAC == "" || n.State == "FAILED" || n.State == "INCOMPLETE" {
+			continue
+		}
+		neighbors = append(neighbors, n)
+	}
+	return neighbors
+}
+
+// LookupMAC returns the link-layer address the kernel has cached for ip, or "" if unknown.
+// IPv4 addresses are looked up in /proc/net/arp first, which works without iproute2.
+func LookupMAC(r Runner, ip string) string {
+	ip = strings.SplitN(ip, "%", 2)[0]
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() != nil {
+		if mac := lookupProcARP(r, ip); mac != "" {
+			return mac
+		}
+	}
+	neighbors, err := GetNeighbors(r)
+	if err != nil {
+		return ""
+	}
+	for _, n := range neighbors {
+		if n.IP == ip {
+			return n.MAC
+		}
+	}
+	return ""
+}
+
+func lookupProcARP(r Runner, ip string) string {
+	data, err := r.ReadFile("/proc/net/arp")
+	if err != nil {
+		return ""
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Scan() // Skip header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// Incomplete entries carry an all-zero hardware address
+		if len(fields) >= 4 && fields[0] == ip && fields[3] != "00:00:00:00:00:00" {
+			return fields[3]
+		}
+	}
+	return ""
+}
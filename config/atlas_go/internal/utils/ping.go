@@ -1,21 +1,26 @@
 package utils
 
 import (
-	"os/exec"
+	"context"
 	"strings"
 )
 
 // PingOrLocalCheck returns online if the IP is on the host or responds to ping.
-func PingHost(ip string) string {
+// IPv6 link-local addresses must carry their zone, e.g. fe80::1%eth0.
+func PingHost(r Runner, ip string) string {
 	// 1. Try ping
-	out, err := exec.Command("ping", "-c", "1", "-W", "1", ip).CombinedOutput()
+	args := []string{"-c", "1", "-W", "1", ip}
+	if strings.Contains(ip, ":") {
+		args = append([]string{"-6"}, args...)
+	}
+	out, err := r.CombinedOutput(context.Background(), "ping", args...)
 	if err == nil && strings.Contains(string(out), "1 received") {
 		return "online"
 	}
 
 	// 2. Try checking if IP belongs to host (for overlay/docker gateways)
-	hostIPs, err := exec.Command("hostname", "-I").Output()
-	if err == nil && strings.Contains(string(hostIPs), ip) {
+	hostIPs, err := r.Output(context.Background(), "hostname", "-I")
+	if err == nil && strings.Contains(string(hostIPs), strings.SplitN(ip, "%", 2)[0]) {
 		return "online"
 	}
 
@@ -0,0 +1,200 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Runner executes external commands and answers the few host lookups that do not run one (PATH,
+// kernel tables under /proc, DNS). Scanners and helpers take a Runner instead of calling
+// exec.Command, os.ReadFile or the resolver directly, so they can be driven by canned output in tests.
+type Runner interface {
+	// Output runs the command and returns its standard output.
+	Output(ctx context.Context, name string, args ...string) ([]byte, error)
+	// CombinedOutput runs the command and returns standard output and standard error together.
+	CombinedOutput(ctx context.Context, name string, args ...string) ([]byte, error)
+	// Conn starts a long-running command and returns a connection to its standard input and
+	// output, e.g. ssh tunnelling to a remote Docker engine. Closing it kills the process.
+	Conn(ctx context.Context, name string, args ...string) (net.Conn, error)
+	// LookPath reports where the command name is installed, like exec.LookPath.
+	LookPath(name string) (string, error)
+	// ReadFile returns the contents of a host file such as /proc/net/arp.
+	ReadFile(path string) ([]byte, error)
+	// LookupAddr returns the reverse DNS names of ip.
+	LookupAddr(ctx context.Context, ip string) ([]string, error)
+	// LookupHost returns the addresses host resolves to.
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// ExecRunner runs commands on the host with os/exec. Cancelling ctx kills the process.
+type ExecRunner struct{}
+
+func (ExecRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, name, args...).Output()
+}
+
+func (ExecRunner) CombinedOutput(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, name, args...).CombinedOutput()
+}
+
+func (ExecRunner) Conn(ctx context.Context, name string, args ...string) (net.Conn, error) {
+	return startCmdConn(ctx, name, args...)
+}
+
+func (ExecRunner) LookPath(name string) (string, error) {
+	return exec.LookPath(name)
+}
+
+func (ExecRunner) ReadFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+func (ExecRunner) LookupAddr(ctx context.Context, ip string) ([]string, error) {
+	return net.DefaultResolver.LookupAddr(ctx, ip)
+}
+
+func (ExecRunner) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return net.DefaultResolver.LookupHost(ctx, host)
+}
+
+// RecordingRunner runs commands through Inner and saves each output under Dir in the layout
+// ReplayRunner reads, so a real scan can be captured once and replayed as test data. Lookups are
+// saved as the pseudo-commands lookpath, readfile, lookupaddr and lookuphost; Conn streams are not
+// recorded.
+type RecordingRunner struct {
+	Inner Runner
+	Dir   string
+}
+
+func (r RecordingRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	out, err := r.Inner.Output(ctx, name, args...)
+	return out, r.record(name, args, out, err)
+}
+
+func (r RecordingRunner) CombinedOutput(ctx context.Context, name string, args ...string) ([]byte, error) {
+	out, err := r.Inner.CombinedOutput(ctx, name, args...)
+	return out, r.record(name, args, out, err)
+}
+
+func (r RecordingRunner) Conn(ctx context.Context, name string, args ...string) (net.Conn, error) {
+	return r.Inner.Conn(ctx, name, args...)
+}
+
+func (r RecordingRunner) LookPath(name string) (string, error) {
+	path, err := r.Inner.LookPath(name)
+	return path, r.record("lookpath", []string{name}, []byte(path), err)
+}
+
+func (r RecordingRunner) ReadFile(path string) ([]byte, error) {
+	data, err := r.Inner.ReadFile(path)
+	return data, r.record("readfile", []string{path}, data, err)
+}
+
+func (r RecordingRunner) LookupAddr(ctx context.Context, ip string) ([]string, error) {
+	names, err := r.Inner.LookupAddr(ctx, ip)
+	return names, r.record("lookupaddr", []string{ip}, []byte(strings.Join(names, "\n")), err)
+}
+
+func (r RecordingRunner) LookupHost(ctx context.Context, host string) ([]string, error) {
+	addrs, err := r.Inner.LookupHost(ctx, host)
+	return addrs, r.record("lookuphost", []string{host}, []byte(strings.Join(addrs, "\n")), err)
+}
+
+func (r RecordingRunner) record(name string, args []string, out []byte, runErr error) error {
+	if err := os.MkdirAll(r.Dir, 0755); err != nil {
+		return fmt.Errorf("failed to create recording dir: %v", err)
+	}
+	base := filepath.Join(r.Dir, CommandKey(name, args...))
+	if err := os.WriteFile(base+".out", out, 0644); err != nil {
+		return fmt.Errorf("failed to record %s: %v", name, err)
+	}
+	if runErr != nil {
+		if err := os.WriteFile(base+".err", []byte(runErr.Error()), 0644); err != nil {
+			return fmt.Errorf("failed to record %s: %v", name, err)
+		}
+	}
+	return runErr
+}
+
+// ReplayRunner serves recorded output from Dir instead of running anything. A command with a
+// <key>.err file fails with that message; a command with no recording fails with ErrNotRecorded.
+type ReplayRunner struct {
+	Dir string
+}
+
+// ErrNotRecorded is returned by ReplayRunner for commands that have no recording.
+var ErrNotRecorded = errors.New("command not recorded")
+
+func (r ReplayRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return r.replay(name, args)
+}
+
+func (r ReplayRunner) CombinedOutput(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return r.replay(name, args)
+}
+
+// Conn fails: a stream cannot be replayed.
+func (r ReplayRunner) Conn(ctx context.Context, name string, args ...string) (net.Conn, error) {
+	return nil, fmt.Errorf("%w: %s %s", ErrNotRecorded, name, strings.Join(args, " "))
+}
+
+func (r ReplayRunner) LookPath(name string) (string, error) {
+	out, err := r.replay("lookpath", []string{name})
+	return string(out), err
+}
+
+func (r ReplayRunner) ReadFile(path string) ([]byte, error) {
+	return r.replay("readfile", []string{path})
+}
+
+func (r ReplayRunner) LookupAddr(ctx context.Context, ip string) ([]string, error) {
+	out, err := r.replay("lookupaddr", []string{ip})
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(out)), nil
+}
+
+func (r ReplayRunner) LookupHost(ctx context.Context, host string) ([]string, error) {
+	out, err := r.replay("lookuphost", []string{host})
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(out)), nil
+}
+
+func (r ReplayRunner) replay(name string, args []string) ([]byte, error) {
+	base := filepath.Join(r.Dir, CommandKey(name, args...))
+	out, err := os.ReadFile(base + ".out")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s %s", ErrNotRecorded, name, strings.Join(args, " "))
+	}
+	if msg, err := os.ReadFile(base + ".err"); err == nil {
+		return out, errors.New(string(msg))
+	}
+	return out, nil
+}
+
+var unsafeKeyChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// CommandKey turns a command line into the file name used by RecordingRunner and ReplayRunner,
+// e.g. "nmap -sn 192.168.1.0/24" -> "nmap_-sn_192.168.1.0_24". Very long command lines are
+// shortened and suffixed with a hash of the full line so keys stay valid file names.
+func CommandKey(name string, args ...string) string {
+	line := strings.Join(append([]string{name}, args...), " ")
+	key := unsafeKeyChars.ReplaceAllString(strings.ReplaceAll(line, " ", "_"), "_")
+	if len(key) > 150 {
+		sum := sha1.Sum([]byte(line))
+		key = key[:150] + "-" + hex.EncodeToString(sum[:8])
+	}
+	return key
+}
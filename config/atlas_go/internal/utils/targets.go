@@ -0,0 +1,284 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// ScanTarget is a network to scan together with the interface that reaches it.
+// Subnet is a canonical CIDR; Name and IP are the outgoing interface and its source address.
+type ScanTarget struct {
+	InterfaceInfo
+	// Gateway is the next hop for routed targets ("" when the subnet is directly attached)
+	Gateway string
+	// Exclude lists addresses inside Subnet that must never be probed
+	Exclude []netip.Prefix
+}
+
+// Excluded reports whether ip falls inside one of the target's exclusions.
+func (t ScanTarget) Excluded(ip string) bool {
+	addr, err := netip.ParseAddr(strings.SplitN(ip, "%", 2)[0])
+	if err != nil {
+		return false
+	}
+	for _, p := range t.Exclude {
+		if p.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExcludeList returns the exclusions as a comma-separated list (the format of nmap --exclude).
+func (t ScanTarget) ExcludeList() string {
+	var parts []string
+	for _, p := range t.Exclude {
+		if p.IsSingleIP() {
+			parts = append(parts, p.Addr().String())
+		} else {
+			parts = append(parts, p.String())
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// ResolveTargets builds the list of networks fastscan and deepscan scan.
+//
+// SCAN_SUBNETS is a comma-separated list of subnets (10.0.0.0/24), single hosts (10.0.0.7),
+// ranges (10.0.0.10-10.0.0.50 or 10.0.0.10-50) and the keyword "auto" for the auto-detected
+// interface subnets; when it is unset only the auto-detected subnets are scanned. SCAN_EXCLUDE
+// takes the same kinds of entries and removes them from every target. Explicit targets are mapped
+// to the interface that reaches them through the routing table, so routed remote subnets get the
+// right interface_name.
+func ResolveTargets(r Runner) ([]ScanTarget, error) {
+	entries := EnvList("SCAN_SUBNETS")
+	exclusions, err := ParseTargetList(EnvList("SCAN_EXCLUDE"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SCAN_EXCLUDE: %v", err)
+	}
+
+	auto := len(entries) == 0
+	var explicit []string
+	for _, e := range entries {
+		if strings.EqualFold(e, "auto") {
+			auto = true
+			continue
+		}
+		explicit = append(explicit, e)
+	}
+	prefixes, err := ParseTargetList(explicit)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SCAN_SUBNETS: %v", err)
+	}
+
+	interfaces, ifaceErr := GetAllInterfaces(r)
+	if ifaceErr != nil && (auto && len(prefixes) == 0) {
+		return nil, ifaceErr
+	}
+
+	var targets []ScanTarget
+	if auto {
+		for _, iface := range interfaces {
+			targets = append(targets, ScanTarget{InterfaceInfo: iface})
+		}
+	}
+
+	var requested []InterfaceInfo
+	for _, p := range prefixes {
+		requested = append(requested, InterfaceInfo{Subnet: p.String()})
+	}
+	for _, info := range LimitSubnets(requested, ScanLimitsFromEnv()) {
+		targets = append(targets, routeTarget(r, info.Subnet, interfaces))
+	}
+
+	return applyExclusions(dedupeTargets(targets), exclusions), nil
+}
+
+// ParseTargetList parses subnets, single addresses and address ranges into canonical prefixes.
+func ParseTargetList(entries []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		switch {
+		case strings.Contains(entry, "/"):
+			p, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, p.Masked())
+		case strings.Contains(entry, "-"):
+			first, last, err := parseRange(entry)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, RangeToPrefixes(first, last)...)
+		default:
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+	}
+	return prefixes, nil
+}
+
+// parseRange parses "10.0.0.10-10.0.0.50" or the shorthand "10.0.0.10-50".
+func parseRange(entry string) (netip.Addr, netip.Addr, error) {
+	parts := strings.SplitN(entry, "-", 2)
+	first, err := netip.ParseAddr(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return netip.Addr{}, netip.Addr{}, err
+	}
+	end := strings.TrimSpace(parts[1])
+	last, err := netip.ParseAddr(end)
+	if err != nil && first.Is4() && !strings.ContainsAny(end, ".:") {
+		// Shorthand: only the last octet is given
+		octets := strings.Split(first.String(), ".")
+		last, err = netip.ParseAddr(strings.Join(append(octets[:3], end), "."))
+	}
+	if err != nil {
+		return netip.Addr{}, netip.Addr{}, fmt.Errorf("invalid range %q", entry)
+	}
+	if first.BitLen() != last.BitLen() || last.Less(first) {
+		return netip.Addr{}, netip.Addr{}, fmt.Errorf("invalid range %q", entry)
+	}
+	return first, last, nil
+}
+
+// RangeToPrefixes returns the smallest set of prefixes covering first..last inclusive.
+func RangeToPrefixes(first, last netip.Addr) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for first.IsValid() && !last.Less(first) {
+		// Grow the block while it stays aligned on first and does not run past last
+		bits := first.BitLen()
+		for bits > 0 {
+			candidate := netip.PrefixFrom(first, bits-1)
+			if candidate.Masked().Addr() != first || lastAddr(candidate).Compare(last) > 0 {
+				break
+			}
+			bits--
+		}
+		block := netip.PrefixFrom(first, bits)
+		prefixes = append(prefixes, block)
+		first = lastAddr(block).Next()
+	}
+	return prefixes
+}
+
+// routeTarget maps an explicit subnet to the interface the kernel would use to reach it.
+func routeTarget(r Runner, subnet string, interfaces []InterfaceInfo) ScanTarget {
+	target := ScanTarget{InterfaceInfo: InterfaceInfo{Name: "unknown", Subnet: subnet}}
+	prefix, err := netip.ParsePrefix(subnet)
+	if err != nil {
+		return target
+	}
+
+	// A subnet on (or inside) a local interface is directly attached
+	for _, iface := range interfaces {
+		local, err := netip.ParsePrefix(iface.Subnet)
+		if err == nil && local.Contains(prefix.Addr()) && local.Bits() <= prefix.Bits() {
+			target.Name, target.IP = iface.Name, iface.IP
+			return target
+		}
+	}
+
+	if route, err := LookupRoute(r, prefix.Addr().String()); err == nil {
+		target.Name, target.IP, target.Gateway = route.Interface, route.Source, route.Gateway
+	}
+	return target
+}
+
+// Route is the kernel's answer to `ip route get`.
+type Route struct {
+	Interface string
+	Source    string
+	Gateway   string
+}
+
+// LookupRoute asks the routing table which interface, source address and gateway reach ip.
+func LookupRoute(r Runner, ip string) (Route, error) {
+	out, err := r.Output(context.Background(), "ip", "route", "get", ip)
+	if err != nil {
+		return Route{}, err
+	}
+	return parseRouteGet(string(out))
+}
+
+// parseRouteGet parses `ip route get` output, e.g.
+// "10.20.0.5 via 192.168.1.1 dev eth0 src 192.168.1.5 uid 0".
+func parseRouteGet(out string) (Route, error) {
+	var route Route
+	fields := strings.Fields(out)
+	for i := 0; i+1 < len(fields); i++ {
+		switch fields[i] {
+		case "dev":
+			route.Interface = fields[i+1]
+		case "src":
+			route.Source = fields[i+1]
+		case "via":
+			route.Gateway = fields[i+1]
+		}
+	}
+	if route.Interface == "" {
+		return Route{}, fmt.Errorf("no route in %q", strings.TrimSpace(out))
+	}
+	return route, nil
+}
+
+// dedupeTargets drops targets that repeat, or sit inside, another target on the same interface.
+func dedupeTargets(targets []ScanTarget) []ScanTarget {
+	var result []ScanTarget
+	for i, t := range targets {
+		prefix, err := netip.ParsePrefix(t.Subnet)
+		covered := false
+		for j, other := range targets {
+			if i == j || other.Name != t.Name {
+				continue
+			}
+			if other.Subnet == t.Subnet {
+				covered = j < i
+			} else if op, oerr := netip.ParsePrefix(other.Subnet); err == nil && oerr == nil {
+				covered = op.Bits() < prefix.Bits() && op.Contains(prefix.Addr())
+			}
+			if covered {
+				break
+			}
+		}
+		if !covered {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// applyExclusions drops targets that are entirely excluded and attaches the overlapping
+// exclusions to the rest.
+func applyExclusions(targets []ScanTarget, exclusions []netip.Prefix) []ScanTarget {
+	var result []ScanTarget
+	for _, t := range targets {
+		prefix, err := netip.ParsePrefix(t.Subnet)
+		if err != nil {
+			result = append(result, t)
+			continue
+		}
+		covered := false
+		for _, ex := range exclusions {
+			if !ex.Overlaps(prefix) {
+				continue
+			}
+			if ex.Bits() <= prefix.Bits() {
+				covered = true
+				break
+			}
+			t.Exclude = append(t.Exclude, ex)
+		}
+		if covered {
+			fmt.Printf("⚠️ Skipping %s: excluded by SCAN_EXCLUDE\n", t.Subnet)
+			continue
+		}
+		result = append(result, t)
+	}
+	return result
+}
@@ -1,10 +1,10 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"net"
-	"os"
-	"os/exec"
+	"net/netip"
 	"strings"
 )
 
@@ -15,125 +15,259 @@ type InterfaceInfo struct {
 	IP     string
 }
 
-// GetAllInterfaces returns all non-loopback network interfaces with their subnets
-func GetAllInterfaces() ([]InterfaceInfo, error) {
-	// First, try parsing via `ip` command for portability across distros
-	out, err := exec.Command("ip", "-o", "-f", "inet", "addr", "show").Output()
-	var interfaces []InterfaceInfo
-	seenInterfaces := make(map[string]bool)
-
-	if err == nil {
-		for _, line := range strings.Split(string(out), "\n") {
-			if line == "" {
-				continue
-			}
-			fields := strings.Fields(line)
-			// Expected format: 1: eth0 inet 192.168.1.5/24 ...
-			if len(fields) < 4 {
-				continue
-			}
-
-			// Interface name is at index 1
-			ifName := strings.TrimSuffix(fields[1], ":")
+// IsIPv6 reports whether the interface entry describes an IPv6 prefix.
+func (i InterfaceInfo) IsIPv6() bool {
+	return strings.Contains(i.IP, ":")
+}
 
-			// Skip common virtual/bridge interfaces by name
-			if strings.HasPrefix(ifName, "docker") || strings.HasPrefix(ifName, "br-") || strings.HasPrefix(ifName, "veth") || ifName == "lo" {
-				continue
-			}
+// GetAllInterfaces returns all non-loopback network interfaces with their subnets.
+// Subnets are canonical masked networks (10.1.5.7/16 -> 10.1.0.0/16) and IPv4 prefixes larger
+// than SCAN_MAX_HOSTS are split or dropped according to SCAN_LARGE_SUBNETS (see LimitSubnets).
+// IPv6 prefixes (global and link-local) are returned as separate entries after the IPv4 ones.
+func GetAllInterfaces(r Runner) ([]InterfaceInfo, error) {
+	var interfaces []InterfaceInfo
 
-			// Find inet keyword and get the subnet
-			for i, f := range fields {
-				if f == "inet" && i+1 < len(fields) {
-					subnet := fields[i+1]
-					if strings.HasPrefix(subnet, "127.") {
-						continue
-					}
-
-					// Avoid duplicate interfaces
-					key := ifName + subnet
-					if seenInterfaces[key] {
-						continue
-					}
-					seenInterfaces[key] = true
-
-					// Extract IP and ensure subnet has CIDR notation
-					parts := strings.Split(subnet, "/")
-					ip := parts[0]
-					fullSubnet := subnet
-					if len(parts) == 1 {
-						fullSubnet = ip + "/24"
-					}
-
-					// Convert IP to subnet base (e.g., 192.168.1.5/24 -> 192.168.1.0/24)
-					ipParts := strings.Split(ip, ".")
-					if len(ipParts) == 4 {
-						maskBits := strings.Split(fullSubnet, "/")[1]
-						subnetBase := fmt.Sprintf("%s.%s.%s.0/%s", ipParts[0], ipParts[1], ipParts[2], maskBits)
-						interfaces = append(interfaces, InterfaceInfo{
-							Name:   ifName,
-							Subnet: subnetBase,
-							IP:     ip,
-						})
-					}
-				}
-			}
-		}
+	// First, try parsing via `ip` command for portability across distros
+	if out, err := r.Output(context.Background(), "ip", "-o", "addr", "show"); err == nil {
+		interfaces = parseIPAddrOutput(string(out))
 	}
 
 	// Fallback: if nothing found (or `ip` unavailable), use Go's net package
 	if len(interfaces) == 0 {
 		netIfaces, nerr := net.Interfaces()
 		if nerr == nil {
+			var links []netLink
 			for _, nif := range netIfaces {
-				// Skip loopback and down interfaces
-				if (nif.Flags&net.FlagLoopback) != 0 || (nif.Flags&net.FlagUp) == 0 {
-					continue
-				}
-				if strings.HasPrefix(nif.Name, "docker") || strings.HasPrefix(nif.Name, "br-") || strings.HasPrefix(nif.Name, "veth") {
-					continue
-				}
 				addrs, _ := nif.Addrs()
-				for _, addr := range addrs {
-					ipNet, ok := addr.(*net.IPNet)
-					if !ok {
-						continue
-					}
-					ip4 := ipNet.IP.To4()
-					if ip4 == nil || ip4.IsLoopback() {
-						continue
-					}
-					// Compute network base; if mask unknown, assume /24
-					ones, _ := ipNet.Mask.Size()
-					maskBits := 24
-					if ones > 0 {
-						maskBits = ones
-					}
-					ipParts := strings.Split(ip4.String(), ".")
-					if len(ipParts) != 4 {
-						continue
-					}
-					subnetBase := fmt.Sprintf("%s.%s.%s.0/%d", ipParts[0], ipParts[1], ipParts[2], maskBits)
-					key := nif.Name + subnetBase
-					if seenInterfaces[key] {
-						continue
-					}
-					seenInterfaces[key] = true
-					interfaces = append(interfaces, InterfaceInfo{
-						Name:   nif.Name,
-						Subnet: subnetBase,
-						IP:     ip4.String(),
-					})
-				}
+				links = append(links, netLink{Name: nif.Name, Flags: nif.Flags, Addrs: addrs})
 			}
+			interfaces = interfacesFromNet(links)
 		}
 	}
 
+	interfaces = LimitSubnets(interfaces, ScanLimitsFromEnv())
 	if len(interfaces) == 0 {
 		return nil, fmt.Errorf("no valid non-loopback interfaces found")
 	}
 	return interfaces, nil
 }
 
+// parseIPAddrOutput parses `ip -o addr show` output, e.g.
+// "2: eth0    inet 192.168.1.5/24 brd 192.168.1.255 scope global eth0".
+func parseIPAddrOutput(out string) []InterfaceInfo {
+	var v4, v6 []InterfaceInfo
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+
+		// Interface name is at index 1 (VLAN interfaces are printed as eth0.10@eth0)
+		ifName := strings.SplitN(strings.TrimSuffix(fields[1], ":"), "@", 2)[0]
+		if skipInterface(ifName) {
+			continue
+		}
+
+		for i, f := range fields {
+			if (f != "inet" && f != "inet6") || i+1 >= len(fields) {
+				continue
+			}
+			prefix, ok := parseAddrPrefix(fields[i+1])
+			if !ok {
+				continue
+			}
+			info, ok := newInterfaceInfo(ifName, prefix)
+			if !ok || seen[info.Name+info.Subnet] {
+				continue
+			}
+			seen[info.Name+info.Subnet] = true
+			if info.IsIPv6() {
+				v6 = append(v6, info)
+			} else {
+				v4 = append(v4, info)
+			}
+		}
+	}
+	return append(v4, v6...)
+}
+
+// netLink is the subset of net.Interface the fallback path needs, split out so it can be faked.
+type netLink struct {
+	Name  string
+	Flags net.Flags
+	Addrs []net.Addr
+}
+
+// interfacesFromNet builds interface entries from Go's view of the host interfaces.
+func interfacesFromNet(links []netLink) []InterfaceInfo {
+	var v4, v6 []InterfaceInfo
+	seen := make(map[string]bool)
+	for _, link := range links {
+		// Skip loopback and down interfaces
+		if (link.Flags&net.FlagLoopback) != 0 || (link.Flags&net.FlagUp) == 0 || skipInterface(link.Name) {
+			continue
+		}
+		for _, addr := range link.Addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			prefix, ok := parseAddrPrefix(ipNet.String())
+			if !ok {
+				continue
+			}
+			info, ok := newInterfaceInfo(link.Name, prefix)
+			if !ok || seen[info.Name+info.Subnet] {
+				continue
+			}
+			seen[info.Name+info.Subnet] = true
+			if info.IsIPv6() {
+				v6 = append(v6, info)
+			} else {
+				v4 = append(v4, info)
+			}
+		}
+	}
+	return append(v4, v6...)
+}
+
+// skipInterface filters loopback and common virtual/bridge interfaces by name.
+func skipInterface(name string) bool {
+	return name == "lo" || strings.HasPrefix(name, "docker") || strings.HasPrefix(name, "br-") || strings.HasPrefix(name, "veth")
+}
+
+// parseAddrPrefix parses an interface address in CIDR form, keeping the host bits.
+// A bare IPv4 address is assumed to be a /24, a bare IPv6 address a /64.
+func parseAddrPrefix(s string) (netip.Prefix, bool) {
+	if !strings.Contains(s, "/") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, false
+		}
+		bits := 24
+		if addr.Is6() && !addr.Is4In6() {
+			bits = 64
+		}
+		return netip.PrefixFrom(addr.Unmap(), bits), true
+	}
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	return netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()), true
+}
+
+// newInterfaceInfo turns an interface address into an entry with its canonical masked subnet,
+// skipping loopback, multicast and unspecified addresses.
+func newInterfaceInfo(ifName string, prefix netip.Prefix) (InterfaceInfo, bool) {
+	addr := prefix.Addr()
+	if addr.IsLoopback() || addr.IsMulticast() || addr.IsUnspecified() {
+		return InterfaceInfo{}, false
+	}
+	return InterfaceInfo{
+		Name:   ifName,
+		Subnet: prefix.Masked().String(),
+		IP:     addr.WithZone("").String(),
+	}, true
+}
+
+// ScanLimits bounds how large an IPv4 subnet may be before it is split or refused.
+type ScanLimits struct {
+	MaxHosts int    // largest number of addresses scanned as one subnet
+	Policy   string // "split" into MaxHosts-sized blocks, or "refuse" to scan it at all
+}
+
+// ScanLimitsFromEnv reads SCAN_MAX_HOSTS (default 65536, a /16) and SCAN_LARGE_SUBNETS (default "refuse").
+func ScanLimitsFromEnv() ScanLimits {
+	return ScanLimits{
+		MaxHosts: EnvInt("SCAN_MAX_HOSTS", 65536),
+		Policy:   EnvString("SCAN_LARGE_SUBNETS", "refuse"),
+	}
+}
+
+// LimitSubnets applies limits to IPv4 subnets that hold more than MaxHosts addresses. IPv6
+// prefixes are left alone: they are discovered through the neighbor table, never swept.
+func LimitSubnets(interfaces []InterfaceInfo, limits ScanLimits) []InterfaceInfo {
+	maxBits := 32
+	for maxBits > 0 && 1<<(32-(maxBits-1)) <= limits.MaxHosts {
+		maxBits--
+	}
+
+	var result []InterfaceInfo
+	for _, iface := range interfaces {
+		prefix, err := netip.ParsePrefix(iface.Subnet)
+		if err != nil || !prefix.Addr().Is4() || prefix.Bits() >= maxBits {
+			result = append(result, iface)
+			continue
+		}
+		if limits.Policy != "split" {
+			fmt.Printf("⚠️ Skipping %s: %d addresses exceeds SCAN_MAX_HOSTS=%d (set SCAN_LARGE_SUBNETS=split to scan it in blocks)\n", iface.Subnet, 1<<(32-prefix.Bits()), limits.MaxHosts)
+			continue
+		}
+		for _, block := range SplitPrefix(prefix, maxBits) {
+			result = append(result, InterfaceInfo{Name: iface.Name, Subnet: block.String(), IP: iface.IP})
+		}
+	}
+	return result
+}
+
+// SplitPrefix divides prefix into consecutive blocks of length bits.
+// A prefix that is already that small or smaller is returned unchanged.
+func SplitPrefix(prefix netip.Prefix, bits int) []netip.Prefix {
+	prefix = prefix.Masked()
+	if bits <= prefix.Bits() || bits > prefix.Addr().BitLen() {
+		return []netip.Prefix{prefix}
+	}
+	var blocks []netip.Prefix
+	addr := prefix.Addr()
+	for prefix.Contains(addr) {
+		block := netip.PrefixFrom(addr, bits)
+		blocks = append(blocks, block)
+		// Step to the first address after this block
+		last := lastAddr(block)
+		next := last.Next()
+		if !next.IsValid() {
+			break
+		}
+		addr = next
+	}
+	return blocks
+}
+
+// lastAddr returns the highest address inside prefix.
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Masked().Addr().AsSlice()
+	hostBits := len(b)*8 - prefix.Bits()
+	for i := len(b) - 1; i >= 0 && hostBits > 0; i-- {
+		if hostBits >= 8 {
+			b[i] = 0xff
+			hostBits -= 8
+		} else {
+			b[i] |= byte(1<<hostBits - 1)
+			hostBits = 0
+		}
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// CanonicalSubnet normalises a CIDR to its masked network (192.168.1.130/25 -> 192.168.1.128/25).
+// Bare addresses become single-host prefixes. Unparseable input is returned as-is.
+func CanonicalSubnet(subnet string) string {
+	if !strings.Contains(subnet, "/") {
+		if addr, err := netip.ParseAddr(subnet); err == nil {
+			return netip.PrefixFrom(addr, addr.BitLen()).String()
+		}
+		return subnet
+	}
+	prefix, err := netip.ParsePrefix(subnet)
+	if err != nil {
+		return subnet
+	}
+	return prefix.Masked().String()
+}
+
 // isDockerSubnet attempts to detect Docker-managed IPv4 networks. Docker commonly places
 // containers in the 172.16.0.0/12 range (172.16.0.0 - 172.31.255.255). We treat those
 // as internal/docker subnets to avoid scanning them in host network scans.
@@ -142,55 +276,40 @@ func isDockerSubnet(subnet string) bool { return false }
 
 // Shared function for subnet detection (kept for backwards compatibility)
 func GetLocalSubnet() (string, error) {
-	interfaces, err := GetAllInterfaces()
+	interfaces, err := GetAllInterfaces(ExecRunner{})
 	if err != nil {
 		return "", err
 	}
-	if len(interfaces) > 0 {
-		return interfaces[0].Subnet, nil
+	for _, iface := range interfaces {
+		if !iface.IsIPv6() {
+			return iface.Subnet, nil
+		}
 	}
 	return "", fmt.Errorf("no valid non-loopback subnet found")
 }
 
-// GetSubnetsToScan returns subnets to scan from environment variable or auto-detected local subnets
+// GetSubnetsToScan returns the subnets fastscan and deepscan will scan (see ResolveTargets).
 // Environment variable SCAN_SUBNETS can contain comma-separated subnets, e.g., "192.168.1.0/24,10.0.0.0/24"
 func GetSubnetsToScan() ([]string, error) {
-	// Check if SCAN_SUBNETS environment variable is set
-	if subnetsEnv := os.Getenv("SCAN_SUBNETS"); subnetsEnv != "" {
-		// Split by comma and trim whitespace
-		subnets := strings.Split(subnetsEnv, ",")
-		var result []string
-		for _, subnet := range subnets {
-			trimmed := strings.TrimSpace(subnet)
-			if trimmed != "" {
-				result = append(result, trimmed)
-			}
-		}
-		if len(result) > 0 {
-			return result, nil
-		}
-	}
-
-	// Fall back to auto-detection of all interfaces if no environment variable is set
-	interfaces, err := GetAllInterfaces()
+	targets, err := ResolveTargets(ExecRunner{})
 	if err != nil {
 		return nil, err
 	}
-
 	var subnets []string
-	for _, iface := range interfaces {
-		subnets = append(subnets, iface.Subnet)
+	for _, t := range targets {
+		subnets = append(subnets, t.Subnet)
 	}
 	return subnets, nil
 }
 
 // GetInterfaceForSubnet returns the interface name for a given subnet
 func GetInterfaceForSubnet(subnet string) (string, error) {
-	interfaces, err := GetAllInterfaces()
+	interfaces, err := GetAllInterfaces(ExecRunner{})
 	if err != nil {
 		return "", err
 	}
 
+	subnet = CanonicalSubnet(subnet)
 	for _, iface := range interfaces {
 		if iface.Subnet == subnet {
 			return iface.Name, nil
@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestParseIPAddrOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want []InterfaceInfo
+	}{
+		{
+			name: "ipv4",
+			out:  "2: eth0    inet 192.168.1.5/24 brd 192.168.1.255 scope global dynamic eth0\\       valid_lft 86011sec preferred_lft 86011sec\n",
+			want: []InterfaceInfo{{Name: "eth0", Subnet: "192.168.1.0/24", IP: "192.168.1.5"}},
+		},
+		{
+			name: "canonical subnet",
+			out:  "3: ens18    inet 10.1.5.7/16 brd 10.1.255.255 scope global ens18\n",
+			want: []InterfaceInfo{{Name: "ens18", Subnet: "10.1.0.0/16", IP: "10.1.5.7"}},
+		},
+		{
+			name: "loopback and virtual interfaces skipped",
+			out: "1: lo    inet 127.0.0.1/8 scope host lo\n" +
+				"1: lo    inet6 ::1/128 scope host \n" +
+				"4: docker0    inet 172.17.0.1/16 brd 172.17.255.255 scope global docker0\n" +
+				"5: br-3f2a9c1d    inet 172.18.0.1/16 brd 172.18.255.255 scope global br-3f2a9c1d\n" +
+				"6: veth12ab@if5    inet6 fe80::1c2d:3eff:fe4f:5a6b/64 scope link \n",
+			want: nil,
+		},
+		{
+			name: "vlan parent stripped",
+			out:  "7: eth0.10@eth0    inet 192.168.10.2/24 brd 192.168.10.255 scope global eth0.10\n",
+			want: []InterfaceInfo{{Name: "eth0.10", Subnet: "192.168.10.0/24", IP: "192.168.10.2"}},
+		},
+		{
+			name: "ipv6 after ipv4",
+			out: "2: eth0    inet6 2001:db8:1::5/64 scope global dynamic mngtmpaddr \n" +
+				"2: eth0    inet6 fe80::5054:ff:fe12:3456/64 scope link \n" +
+				"2: eth0    inet 192.168.1.5/24 brd 192.168.1.255 scope global eth0\n",
+			want: []InterfaceInfo{
+				{Name: "eth0", Subnet: "192.168.1.0/24", IP: "192.168.1.5"},
+				{Name: "eth0", Subnet: "2001:db8:1::/64", IP: "2001:db8:1::5"},
+				{Name: "eth0", Subnet: "fe80::/64", IP: "fe80::5054:ff:fe12:3456"},
+			},
+		},
+		{
+			name: "duplicate subnet kept once",
+			out: "2: eth0    inet 192.168.1.5/24 brd 192.168.1.255 scope global eth0\n" +
+				"2: eth0    inet 192.168.1.6/24 brd 192.168.1.255 scope global secondary eth0\n" +
+				"3: wlan0    inet 192.168.1.7/24 brd 192.168.1.255 scope global wlan0\n",
+			want: []InterfaceInfo{
+				{Name: "eth0", Subnet: "192.168.1.0/24", IP: "192.168.1.5"},
+				{Name: "wlan0", Subnet: "192.168.1.0/24", IP: "192.168.1.7"},
+			},
+		},
+		{
+			name: "bare address",
+			out:  "8: tun0    inet 10.8.0.6 peer 10.8.0.5/32 scope global tun0\n",
+			want: []InterfaceInfo{{Name: "tun0", Subnet: "10.8.0.0/24", IP: "10.8.0.6"}},
+		},
+		{
+			name: "malformed lines",
+			out:  "\ngarbage\n2: eth0    inet\n2: eth0    inet not-an-address scope global eth0\n",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		if got := parseIPAddrOutput(tt.out); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parseIPAddrOutput() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInterfacesFromNet(t *testing.T) {
+	ipNet := func(cidr string) *net.IPNet {
+		ip, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n.IP = ip
+		return n
+	}
+	up := net.FlagUp | net.FlagBroadcast
+
+	tests := []struct {
+		name  string
+		links []netLink
+		want  []InterfaceInfo
+	}{
+		{
+			name:  "ipv4",
+			links: []netLink{{Name: "eth0", Flags: up, Addrs: []net.Addr{ipNet("192.168.1.5/24")}}},
+			want:  []InterfaceInfo{{Name: "eth0", Subnet: "192.168.1.0/24", IP: "192.168.1.5"}},
+		},
+		{
+			name: "loopback and down interfaces skipped",
+			links: []netLink{
+				{Name: "lo", Flags: net.FlagUp | net.FlagLoopback, Addrs: []net.Addr{ipNet("127.0.0.1/8")}},
+				{Name: "eth1", Flags: net.FlagBroadcast, Addrs: []net.Addr{ipNet("10.0.0.5/24")}},
+				{Name: "docker0", Flags: up, Addrs: []net.Addr{ipNet("172.17.0.1/16")}},
+			},
+			want: nil,
+		},
+		{
+			name: "ipv6 after ipv4",
+			links: []netLink{
+				{Name: "eth0", Flags: up, Addrs: []net.Addr{ipNet("fe80::5054:ff:fe12:3456/64"), ipNet("192.168.1.5/24")}},
+				{Name: "wlan0", Flags: up, Addrs: []net.Addr{ipNet("10.1.5.7/16")}},
+			},
+			want: []InterfaceInfo{
+				{Name: "eth0", Subnet: "192.168.1.0/24", IP: "192.168.1.5"},
+				{Name: "wlan0", Subnet: "10.1.0.0/16", IP: "10.1.5.7"},
+				{Name: "eth0", Subnet: "fe80::/64", IP: "fe80::5054:ff:fe12:3456"},
+			},
+		},
+		{
+			name: "non-IPNet and duplicate addresses",
+			links: []netLink{{Name: "eth0", Flags: up, Addrs: []net.Addr{
+				&net.IPAddr{IP: net.ParseIP("192.168.2.1")},
+				ipNet("192.168.1.5/24"),
+				ipNet("192.168.1.6/24"),
+			}}},
+			want: []InterfaceInfo{{Name: "eth0", Subnet: "192.168.1.0/24", IP: "192.168.1.5"}},
+		},
+		{
+			name:  "ipv4-mapped address",
+			links: []netLink{{Name: "eth0", Flags: up, Addrs: []net.Addr{&net.IPNet{IP: net.ParseIP("192.168.1.5"), Mask: net.CIDRMask(24, 32)}}}},
+			want:  []InterfaceInfo{{Name: "eth0", Subnet: "192.168.1.0/24", IP: "192.168.1.5"}},
+		},
+	}
+	for _, tt := range tests {
+		if got := interfacesFromNet(tt.links); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: interfacesFromNet() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLimitSubnets(t *testing.T) {
+	in := []InterfaceInfo{
+		{Name: "eth0", Subnet: "192.168.1.0/24", IP: "192.168.1.5"},
+		{Name: "eth1", Subnet: "10.0.0.0/22", IP: "10.0.0.5"},
+		{Name: "eth0", Subnet: "2001:db8::/64", IP: "2001:db8::5"},
+	}
+	tests := []struct {
+		name   string
+		limits ScanLimits
+		want   []string
+	}{
+		{"within limit", ScanLimits{MaxHosts: 1024, Policy: "refuse"}, []string{"192.168.1.0/24", "10.0.0.0/22", "2001:db8::/64"}},
+		{"refuse", ScanLimits{MaxHosts: 256, Policy: "refuse"}, []string{"192.168.1.0/24", "2001:db8::/64"}},
+		{"split", ScanLimits{MaxHosts: 512, Policy: "split"}, []string{"192.168.1.0/24", "10.0.0.0/23", "10.0.2.0/23", "2001:db8::/64"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, iface := range LimitSubnets(in, tt.limits) {
+			got = append(got, iface.Subnet)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: LimitSubnets() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -1,49 +1,359 @@
 package main
 
 import (
+    "context"
+    "flag"
     "fmt"
     "log"
     "os"
+    "os/signal"
+    "strconv"
+    "strings"
+    "syscall"
 
     "atlas/internal/scan"
     "atlas/internal/db"
+    "atlas/internal/oui"
+    "atlas/internal/utils"
 )
 
+// version is set at build time: go build -ldflags "-X main.version=v1.2.3"
+var version = "dev"
+
 func main() {
-    if len(os.Args) < 2 {
-        log.Fatalf("Usage: ./atlas <command>\nAvailable commands: fastscan, dockerscan")
+    // Global options come before the command: ./atlas --db /tmp/atlas.db fastscan
+    dbPath := flag.String("db", utils.EnvString("ATLAS_DB_PATH", db.DefaultPath), "SQLite database path (env ATLAS_DB_PATH)")
+    logDir := flag.String("log-dir", utils.EnvString("ATLAS_LOG_DIR", "/config/logs"), "directory for scan logs (env ATLAS_LOG_DIR)")
+    flag.Parse()
+    args := flag.Args()
+
+    if len(args) < 1 {
+        log.Fatalf("Usage: ./atlas [--db path] [--log-dir dir] <command>\nAvailable commands: fastscan, deepscan, dockerscan, dockerwatch, initdb, migrate, runs, oui, ports, profiles")
+    }
+
+    // Only the scans write logs; the other commands must work without the log dir
+    if args[0] == "fastscan" || args[0] == "deepscan" {
+        if err := os.MkdirAll(*logDir, 0755); err != nil {
+            log.Fatalf("❌ Failed to create log dir %s: %v", *logDir, err)
+        }
+    }
+    store, err := db.Open(*dbPath)
+    if err != nil {
+        log.Fatalf("❌ %v", err)
     }
+    defer store.Close()
 
-    switch os.Args[1] {
+    // Every command except migrate brings the schema up to date first
+    if args[0] != "migrate" {
+        if err := store.InitDB(); err != nil {
+            log.Fatalf("❌ DB init failed: %v", err)
+        }
+    }
+    scanner := scan.NewScanner(store, *logDir)
+    scanner.Version = version
+
+    switch args[0] {
     case "fastscan":
         fmt.Println("🚀 Running fast scan...")
-        err := scan.FastScan()
+        err := scanner.FastScan()
         if err != nil {
             log.Fatalf("❌ Fast scan failed: %v", err)
         }
         fmt.Println("✅ Fast scan complete.")
     case "dockerscan":
         fmt.Println("🐳 Running Docker scan...")
-        err := scan.DockerScan()
+        err := scanner.DockerScan()
         if err != nil {
             log.Fatalf("❌ Docker scan failed: %v", err)
         }
         fmt.Println("✅ Docker scan complete.")
+    case "dockerwatch":
+        fmt.Println("🐳 Watching Docker events...")
+        // Runs until Ctrl-C / docker stop
+        ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+        err := scanner.DockerWatch(ctx)
+        stop()
+        if err != nil {
+            log.Fatalf("❌ Docker watch failed: %v", err)
+        }
+        fmt.Println("✅ Docker watch stopped.")
     case "deepscan":
+        fs := flag.NewFlagSet("deepscan", flag.ContinueOnError)
+        profile := fs.String("profile", "", "scan profile (env DEEPSCAN_PROFILE, see `atlas profiles`)")
+        if err := fs.Parse(args[1:]); err != nil {
+            log.Fatalf("❌ %v", err)
+        }
         fmt.Println("🚀 Running deep scan...")
-        err := scan.DeepScan()
+        // Ctrl-C / docker stop cancel the scan and kill running nmap processes
+        ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+        err := scanner.DeepScan(ctx, *profile)
+        // stop cancels ctx too, so check for a signal first
+        cancelled := ctx.Err() != nil
+        stop()
+        if err != nil && cancelled {
+            // The run is recorded as cancelled and the hosts finished so far are stored
+            fmt.Println("🛑 Deep scan cancelled.")
+            os.Exit(130)
+        }
         if err != nil {
             log.Fatalf("❌ Deep scan failed: %v", err)
         }
         fmt.Println("✅ Deep scan complete.")
     case "initdb":
+        // The schema was migrated above
         fmt.Println("📦 Initializing database...")
-        err := db.InitDB()
+        fmt.Println("✅ Database initialized.")
+    case "migrate":
+        if err := runMigrate(store, args[1:]); err != nil {
+            log.Fatalf("❌ Migration failed: %v", err)
+        }
+    case "runs":
+        if err := runRuns(store, args[1:]); err != nil {
+            log.Fatalf("❌ %v", err)
+        }
+    case "oui":
+        if err := runOUI(store, args[1:]); err != nil {
+            log.Fatalf("❌ %v", err)
+        }
+    case "ports":
+        if err := runPorts(store, args[1:]); err != nil {
+            log.Fatalf("❌ %v", err)
+        }
+    case "profiles":
+        if err := runProfiles(); err != nil {
+            log.Fatalf("❌ %v", err)
+        }
+    default:
+        log.Fatalf("Unknown command: %s", args[0])
+    }
+}
+
+// runMigrate implements `atlas migrate status|up [version]|down [version]`.
+// up defaults to the latest version; down without a version reverts the newest migration.
+func runMigrate(store *db.Store, args []string) error {
+    if len(args) < 1 {
+        return fmt.Errorf("usage: ./atlas migrate status|up [version]|down [version]")
+    }
+    target := -1
+    if len(args) > 1 {
+        v, err := strconv.Atoi(args[1])
+        if err != nil || v < 0 {
+            return fmt.Errorf("invalid version %q", args[1])
+        }
+        target = v
+    }
+
+    switch args[0] {
+    case "status":
+        states, err := store.MigrationStatus()
         if err != nil {
-            log.Fatalf("❌ DB init failed: %v", err)
+            return err
         }
-        fmt.Println("✅ Database initialized.")
+        for _, st := range states {
+            if st.Applied {
+                fmt.Printf("✅ %04d_%s (applied %s)\n", st.Version, st.Name, st.AppliedAt)
+            } else {
+                fmt.Printf("⏳ %04d_%s (pending)\n", st.Version, st.Name)
+            }
+        }
+    case "up":
+        if target < 0 {
+            target = 0
+        }
+        if err := store.MigrateUp(target); err != nil {
+            return err
+        }
+    case "down":
+        if target < 0 {
+            current, err := store.SchemaVersion()
+            if err != nil {
+                return err
+            }
+            target = current - 1
+        }
+        if err := store.MigrateDown(target); err != nil {
+            return err
+        }
+    default:
+        return fmt.Errorf("unknown migrate command: %s", args[0])
+    }
+
+    if args[0] != "status" {
+        version, err := store.SchemaVersion()
+        if err != nil {
+            return err
+        }
+        fmt.Printf("✅ Schema at version %d\n", version)
+    }
+    return nil
+}
+
+// runRuns implements `atlas runs list [--type T] [--limit N]` and `atlas runs show <id>`.
+func runRuns(store *db.Store, args []string) error {
+    if len(args) < 1 {
+        return fmt.Errorf("usage: ./atlas runs list [--type fastscan|deepscan|dockerscan|dockerwatch] [--limit N] | show <id>")
+    }
+
+    switch args[0] {
+    case "list":
+        fs := flag.NewFlagSet("runs list", flag.ContinueOnError)
+        scanType := fs.String("type", "", "only show runs of this scan type")
+        limit := fs.Int("limit", 20, "number of runs to show")
+        if err := fs.Parse(args[1:]); err != nil {
+            return err
+        }
+        runs, err := store.ListRuns(*scanType, *limit)
+        if err != nil {
+            return err
+        }
+        for _, r := range runs {
+            fmt.Printf("%5d  %-10s  %-9s  %s → %s  found %d, updated %d  %s\n",
+                r.ID, r.Type, r.Status, r.StartedAt, r.FinishedAt, r.HostsFound, r.HostsUpdated, strings.Join(r.Targets, ","))
+        }
+    case "show":
+        if len(args) < 2 {
+            return fmt.Errorf("usage: ./atlas runs show <id>")
+        }
+        id, err := strconv.ParseInt(args[1], 10, 64)
+        if err != nil {
+            return fmt.Errorf("invalid run id %q", args[1])
+        }
+        r, err := store.GetRun(id)
+        if err != nil {
+            return err
+        }
+        if r == nil {
+            return fmt.Errorf("scan run %d not found", id)
+        }
+        fmt.Printf("Run:      %d\n", r.ID)
+        fmt.Printf("Type:     %s\n", r.Type)
+        fmt.Printf("Status:   %s\n", r.Status)
+        fmt.Printf("Version:  %s\n", r.Version)
+        if r.Profile != "" {
+            fmt.Printf("Profile:  %s\n", r.Profile)
+        }
+        fmt.Printf("Started:  %s\n", r.StartedAt)
+        fmt.Printf("Finished: %s\n", r.FinishedAt)
+        fmt.Printf("Targets:  %s\n", strings.Join(r.Targets, ", "))
+        fmt.Printf("Hosts:    %d found, %d updated\n", r.HostsFound, r.HostsUpdated)
+        if r.Error != "" {
+            fmt.Printf("Errors:   %s\n", r.Error)
+        }
+        events, err := store.RunEvents(id)
+        if err != nil {
+            return err
+        }
+        if len(events) > 0 {
+            fmt.Printf("Changes:\n")
+        }
+        for _, e := range events {
+            fmt.Printf("  %s  %-15s  %-12s  %s → %s\n", e.ObservedAt, e.IP, e.Type, e.OldValue, e.NewValue)
+        }
+    default:
+        return fmt.Errorf("unknown runs command: %s", args[0])
+    }
+    return nil
+}
+
+// runOUI implements `atlas oui update --file <path>` and `atlas oui lookup <mac>`. update loads a
+// locally downloaded IEEE registry (oui.csv, mam.csv, oui36.csv or oui.txt) or nmap-mac-prefixes.
+func runOUI(store *db.Store, args []string) error {
+    if len(args) < 1 {
+        return fmt.Errorf("usage: ./atlas oui update --file <path> | lookup <mac>")
+    }
+
+    switch args[0] {
+    case "update":
+        fs := flag.NewFlagSet("oui update", flag.ContinueOnError)
+        files := fs.String("file", "", "comma-separated vendor files to load")
+        if err := fs.Parse(args[1:]); err != nil {
+            return err
+        }
+        if *files == "" {
+            return fmt.Errorf("usage: ./atlas oui update --file <path>[,<path>...]")
+        }
+        vendors := oui.New(nil)
+        for _, path := range strings.Split(*files, ",") {
+            f, err := os.Open(strings.TrimSpace(path))
+            if err != nil {
+                return err
+            }
+            d, err := oui.Parse(f)
+            f.Close()
+            if err != nil {
+                return fmt.Errorf("%s: %v", path, err)
+            }
+            vendors = vendors.Merge(d)
+        }
+        if err := store.ReplaceOUI(vendors); err != nil {
+            return fmt.Errorf("failed to store vendor prefixes: %v", err)
+        }
+        merged, err := store.LoadOUI()
+        if err != nil {
+            return err
+        }
+        n, err := store.UpdateHostVendors(merged)
+        if err != nil {
+            return fmt.Errorf("failed to update host vendors: %v", err)
+        }
+        fmt.Printf("✅ Loaded %d vendor prefixes, updated %d hosts\n", vendors.Len(), n)
+    case "lookup":
+        if len(args) < 2 {
+            return fmt.Errorf("usage: ./atlas oui lookup <mac>")
+        }
+        vendors, err := store.LoadOUI()
+        if err != nil {
+            return err
+        }
+        vendor := vendors.Lookup(args[1])
+        if vendor == "" {
+            vendor = "unknown vendor"
+        }
+        if oui.IsLocallyAdministered(args[1]) {
+            vendor += " (locally administered)"
+        }
+        fmt.Printf("%s: %s\n", args[1], vendor)
     default:
-        log.Fatalf("Unknown command: %s", os.Args[1])
+        return fmt.Errorf("unknown oui command: %s", args[0])
+    }
+    return nil
+}
+
+// runPorts implements `atlas ports <port>[/proto]`: every host and container with the port open.
+func runPorts(store *db.Store, args []string) error {
+    if len(args) < 1 {
+        return fmt.Errorf("usage: ./atlas ports <port>[/tcp|udp|sctp]")
+    }
+    num, proto, found := strings.Cut(args[0], "/")
+    if !found {
+        proto = "tcp"
+    }
+    port, err := strconv.Atoi(num)
+    if err != nil {
+        return fmt.Errorf("invalid port %q", args[0])
+    }
+    open, err := store.PortsOpen(port, proto)
+    if err != nil {
+        return err
+    }
+    for _, p := range open {
+        service := strings.TrimSpace(p.Service + " " + p.Product + " " + p.Version)
+        fmt.Printf("%-6s  %-39s  %-20s  %-12s  %s\n", p.HostKind, p.IP, p.Name, p.InterfaceName, service)
+    }
+    if len(open) == 0 {
+        fmt.Printf("No host has %d/%s open\n", port, proto)
+    }
+    return nil
+}
+
+// runProfiles implements `atlas profiles`: the deep scan profiles available to --profile.
+func runProfiles() error {
+    profiles, err := scan.LoadProfiles(utils.EnvString("DEEPSCAN_PROFILES_FILE", "/config/scan_profiles.yaml"))
+    if err != nil {
+        return err
+    }
+    for _, name := range scan.ProfileNames(profiles) {
+        fmt.Printf("%-10s  %s\n", name, profiles[name].Description)
     }
+    return nil
 }
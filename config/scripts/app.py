@@ -187,12 +187,61 @@ def get_hosts(user: str = Depends(require_auth)):
     cursor1 = conn.cursor()
     cursor2 = conn.cursor()
     cursor1.execute("SELECT * FROM hosts")
-    cursor2.execute("SELECT * FROM docker_hosts")
+    # Columns listed so engine stays at index 14 for the UI's positional reads
+    cursor2.execute("""
+        SELECT id, container_id, ip, name, os_details, mac_address, open_ports, next_hop, network_name, last_seen,
+               online_status, last_scan_run_id, device_type, device_confidence, engine
+        FROM docker_hosts
+    """)
     rows1 = cursor1.fetchall()
     rows2 = cursor2.fetchall()
     conn.close()
     return [rows1, rows2]
 
+@app.get("/docker/networks", tags=["Hosts"])
+def get_docker_networks(user: str = Depends(require_auth)):
+    # Networks of the scanned container engines, from the Docker scan's docker_networks table
+    try:
+        conn = sqlite3.connect("/config/db/atlas.db")
+        conn.row_factory = sqlite3.Row
+        cursor = conn.cursor()
+        cursor.execute("""
+            SELECT engine, network_id, name, driver, scope, subnet, gateway, ipam_config, internal, attachable,
+                   bridge_name, host_address, last_seen, last_scan_run_id
+            FROM docker_networks ORDER BY engine, name
+        """)
+        rows = [dict(r) for r in cursor.fetchall()]
+        conn.close()
+        return rows
+    except sqlite3.OperationalError:
+        # Table not migrated yet
+        return []
+    except Exception as e:
+        raise HTTPException(status_code=500, detail=str(e))
+
+@app.get("/ports", tags=["Hosts"])
+def get_open_ports(port: int, protocol: str = "tcp", user: str = Depends(require_auth)):
+    # Hosts and containers with the port open, from the normalized host_ports table
+    try:
+        conn = sqlite3.connect("/config/db/atlas.db")
+        conn.row_factory = sqlite3.Row
+        cursor = conn.cursor()
+        cursor.execute("""
+            SELECT p.host_kind, p.host_id, COALESCE(h.ip, d.ip) AS ip, COALESCE(h.name, d.name) AS name,
+                   COALESCE(h.interface_name, d.network_name) AS interface_name, p.port, p.protocol, p.state,
+                   p.service, p.product, p.version, p.extra_info, p.first_seen, p.last_seen
+            FROM host_ports p
+            LEFT JOIN hosts h ON p.host_kind = 'host' AND h.id = p.host_id
+            LEFT JOIN docker_hosts d ON p.host_kind = 'docker' AND d.id = p.host_id
+            WHERE p.port = ? AND p.protocol = ? AND p.state = 'open'
+            ORDER BY p.host_kind, p.host_id
+        """, (port, protocol))
+        rows = [dict(r) for r in cursor.fetchall()]
+        conn.close()
+        return rows
+    except Exception as e:
+        raise HTTPException(status_code=500, detail=str(e))
+
 @app.get("/external", tags=["Hosts"])
 def get_external_networks(user: str = Depends(require_auth)):
     try:
@@ -43,6 +43,12 @@ export PYTHONPATH=/config
 uvicorn scripts.app:app --host 0.0.0.0 --port "$ATLAS_API_PORT" > /config/logs/uvicorn.log 2>&1 &
 API_PID=$!
 
+# Optional real-time Docker updates between scheduled Docker scans
+if [[ "${DOCKERWATCH:-false}" == "true" && -x /config/bin/atlas ]]; then
+  log "🐳 Starting Docker event watcher..."
+  /config/bin/atlas dockerwatch >> /config/logs/dockerwatch.log 2>&1 &
+fi
+
 # Note: Scans are now scheduled automatically by the scheduler module
 # The scheduler will run scans at configured intervals (see environment variables)
 log "📅 Scan scheduler will run scans at configured intervals"
@@ -31,7 +31,7 @@ export function NetworkMap() {
   const [selectedRoute, setSelectedRoute] = useState(null);
   const [nodeInfoMap, setNodeInfoMap] = useState({});
   const [filters, setFilters] = useState({ subnet: "", group: "", name: "" });
-  const [rawData, setRawData] = useState({ nonDockerHosts: [], dockerHosts: [] });
+  const [rawData, setRawData] = useState({ nonDockerHosts: [], dockerHosts: [], dockerNetworks: [] });
   const [externalNode, setExternalNode] = useState(null);
   const [selectedSubnet, setSelectedSubnet] = useState(null);
   const [layoutStyle, setLayoutStyle] = useState("default");
@@ -57,9 +57,19 @@ export function NetworkMap() {
         const json = await apiGet("/hosts"); // was fetch("/api/hosts")
         if (aborted) return;
         const [nonDockerHosts, dockerHosts] = json;
+        // Docker networks (engine host, subnet, driver); optional
+        let dockerNetworks = [];
+        try {
+          const netJson = await apiGet("/docker/networks");
+          if (Array.isArray(netJson)) dockerNetworks = netJson;
+        } catch {
+          console.warn("No Docker networks available.");
+        }
+        if (aborted) return;
         setRawData({
           nonDockerHosts: Array.isArray(nonDockerHosts) ? nonDockerHosts : [],
           dockerHosts: Array.isArray(dockerHosts) ? dockerHosts : [],
+          dockerNetworks,
         });
 
         // External info (public IP)
@@ -119,16 +129,24 @@ export function NetworkMap() {
       return hubId;
     };
 
-    const ensureNetworkNode = (networkName, hostIp) => {
-      const networkId = `network-${networkName}`;
+    // Docker networks by engine and name (every engine has its own "bridge"); next_hop of a
+    // container is its network's gateway, so the network is linked to the machine its engine runs
+    // on through host_address
+    const dockerNetworkKey = (engine, name) => `${engine || "local"}/${name}`;
+    const dockerNetworkByKey = new Map(rawData.dockerNetworks.map((n) => [dockerNetworkKey(n.engine, n.name), n]));
+
+    const ensureNetworkNode = (networkName, gateway, engine) => {
+      const networkId = `network-${dockerNetworkKey(engine, networkName)}`;
       if (seenNetworks.has(networkId)) return networkId;
 
-      let inferredSubnet = hostIp ? getSubnet(hostIp) : "unknown";
+      const dockerNet = dockerNetworkByKey.get(dockerNetworkKey(engine, networkName));
+      const hostIp = dockerNet?.host_address || gateway;
+      let inferredSubnet = dockerNet?.subnet || (gateway ? getSubnet(gateway) : "unknown");
 
       if (!seenNetworks.has(networkId) && !nodes.get(networkId)) {
         nodes.add({
           id: networkId,
-            label: networkName,
+            label: dockerNet?.driver ? `${networkName}\n(${dockerNet.driver})` : networkName,
             shape: "box",
             color: "#10b981",
             font: { size: 12, color: labelColor },
@@ -144,7 +162,11 @@ export function NetworkMap() {
 
       nodeInfoMap[networkId] = {
         name: networkName,
+        engine: engine || "local",
         subnet: inferredSubnet,
+        gateway: dockerNet?.gateway || gateway,
+        driver: dockerNet?.driver,
+        bridge: dockerNet?.bridge_name,
         group: "network",
       };
 
@@ -163,7 +185,8 @@ export function NetworkMap() {
       nexthop,
       network_name,
       last_seen = "",
-      interface_name = ""
+      interface_name = "",
+      engine = ""
     ) => {
       if (!ip || ip === "Unknown" || !ip.includes(".")) return;
 
@@ -202,7 +225,7 @@ export function NetworkMap() {
         edges.add({ from: hubId, to: nodeId });
         hostIpToNodeId.set(ip, nodeId);
       } else if (group === "docker") {
-        const networkId = ensureNetworkNode(network_name, nexthop);
+        const networkId = ensureNetworkNode(network_name, nexthop, engine);
         if (networkId) {
           edges.add({ from: networkId, to: nodeId });
         }
@@ -256,12 +279,13 @@ export function NetworkMap() {
     );
 
     // NOTE: docker_hosts schema changed (migration). New rows look like:
-    // [id, container_id, ip, name, os_details, mac_address, open_ports, next_hop, network_name, last_seen, online_status]
+    // [id, container_id, ip, name, os_details, mac_address, open_ports, next_hop, network_name, last_seen, online_status,
+    //  last_scan_run_id, device_type, device_confidence, engine]
     // The code below maps the new positions: prefer container_id as the host id (unique container identifier),
     // and use the correct "ip" column from the new schema.
     rawData.dockerHosts.forEach(
-      ([id, container_id, ip, name, os, mac, ports, nexthop, network_name, last_seen]) =>
-        addHost(container_id || id, ip, name, os, "docker", ports, mac, nexthop, network_name, last_seen)
+      ([id, container_id, ip, name, os, mac, ports, nexthop, network_name, last_seen, , , , , engine]) =>
+        addHost(container_id || id, ip, name, os, "docker", ports, mac, nexthop, network_name, last_seen, "", engine)
     );
 
     // External / Internet node
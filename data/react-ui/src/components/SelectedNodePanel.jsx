@@ -17,7 +17,11 @@ export function SelectedNodePanel({ node, subnet, route }) {
       {node?.group === "network" && (
         <div>
           <div><strong>Name:</strong> {node.name}</div>
+          {node.engine && <div><strong>Engine:</strong> {node.engine}</div>}
           <div><strong>Prefix:</strong> {node.subnet}</div>
+          {node.gateway && <div><strong>Gateway:</strong> {node.gateway}</div>}
+          {node.driver && <div><strong>Driver:</strong> {node.driver}</div>}
+          {node.bridge && <div><strong>Bridge:</strong> {node.bridge}</div>}
         </div>
       )}
 
@@ -112,7 +112,7 @@ fi
 
 # Step 5: Build Docker image from repo root
 echo "🐳 Building Docker image: $IMAGE:$VERSION"
-DOCKER_BUILDKIT=1 docker build -t "$IMAGE:$VERSION" "$REPO_ROOT"
+DOCKER_BUILDKIT=1 docker build --build-arg ATLAS_VERSION="$VERSION" -t "$IMAGE:$VERSION" "$REPO_ROOT"
 
 # Step 5b: Optionally tag as latest
 if $DO_LATEST; then